@@ -1,45 +1,116 @@
 package bill
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
+// nonRetryable marks a business error (bad input, wrong bill state) so
+// Temporal fails the activity at once instead of retrying something that
+// cannot succeed. The errs.Error stays reachable via errors.As.
+func nonRetryable(err error) error {
+	return temporal.NewNonRetryableApplicationError(err.Error(), errs.Code(err).String(), err)
+}
+
+// lookupErr passes on a failed bill lookup: a missing bill is final, while
+// anything else (a dropped connection, a timeout) is left to the retry
+// policy.
+func lookupErr(err error) error {
+	if errs.Code(err) == errs.NotFound {
+		return nonRetryable(err)
+	}
+	return err
+}
+
+// activityLog tags an activity's logs with the bill, its workflow and the
+// attempt number, so retries show up when filtering by bill_id. Outside
+// an activity (a test calling one directly) it is plain billLog.
+func activityLog(ctx context.Context, billID string) rlog.Ctx {
+	if !activity.IsActivity(ctx) {
+		return billLog(billID)
+	}
+	info := activity.GetInfo(ctx)
+	return billLog(billID).With("activity", info.ActivityType.Name, "attempt", info.Attempt)
+}
+
 type CreateBillRowInput struct {
-	BillID   string
-	Currency Currency
+	BillID       string
+	Currency     Currency
+	TaxRateBps   int
+	RoundingMode RoundingMode // empty: HALF_UP
+	OwnerID      string
 }
 
 // CreateBillRowActivity inserts the bill row.
 // Idempotent by primary key.
+//
+// The row also records the run ID of the workflow's first run. Every run
+// (continue-as-new included) calls this activity, so a row that already
+// exists only gets it when unset: imported bills, and bills whose workflow
+// was started by a signal.
 func CreateBillRowActivity(ctx context.Context, in CreateBillRowInput) (*Bill, error) {
+	log := activityLog(ctx, in.BillID)
+
 	if !in.Currency.Valid() {
-		return nil, errs.B().Code(errs.InvalidArgument).Msg("unsupported currency").Err()
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("unsupported currency").Err())
 	}
 
-	_, err := db.Exec(ctx, `
-		INSERT INTO bills (id, status, currency, total_minor)
-		VALUES ($1, $2, $3, 0)
+	var runID string
+	if activity.IsActivity(ctx) {
+		runID = activity.GetInfo(ctx).WorkflowExecution.RunID
+	}
+
+	res, err := db.Exec(ctx, `
+		INSERT INTO bills (id, status, currency, total_minor, tax_rate_bps, rounding_mode, run_id, owner_id)
+		VALUES ($1, $2, $3, 0, $4, COALESCE(NULLIF($5, ''), 'HALF_UP'), NULLIF($6, ''), $7)
 		ON CONFLICT (id) DO NOTHING
-	`, in.BillID, string(StatusOpen), string(in.Currency))
+	`, in.BillID, string(StatusOpen), string(in.Currency), in.TaxRateBps, string(in.RoundingMode), runID, in.OwnerID)
 	if err != nil {
+		log.Error("insert bill failed", "err", err)
 		return nil, errs.B().Code(errs.Internal).Msg("insert bill").Err()
 	}
+	if res.RowsAffected() > 0 {
+		billsCreated.With(currencyLabels{Currency: string(in.Currency)}).Increment()
+		log.Info("bill created", "currency", in.Currency)
+	} else if runID != "" {
+		if _, err := db.Exec(ctx, `
+			UPDATE bills SET run_id = $2 WHERE id = $1 AND run_id IS NULL
+		`, in.BillID, runID); err != nil {
+			log.Error("record run id failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("record run id").Err()
+		}
+	}
 
 	row := db.QueryRow(ctx, `
-		SELECT id, status, currency, total_minor, created_at, closed_at
+		SELECT id, status, currency, total_minor, created_at, closed_at, updated_at,
+			tax_rate_bps, subtotal_minor, discount_minor, tax_minor
 		FROM bills WHERE id = $1
 	`, in.BillID)
 
 	var b Bill
 	var closed sql.NullTime
-	if err := row.Scan(&b.ID, &b.Status, &b.Currency, &b.TotalMinor, &b.CreatedAt, &closed); err != nil {
+	if err := row.Scan(&b.ID, &b.Status, &b.Currency, &b.TotalMinor, &b.CreatedAt, &closed, &b.UpdatedAt,
+		&b.TaxRateBps, &b.SubtotalMinor, &b.DiscountMinor, &b.TaxMinor); err != nil {
 		if err == sqldb.ErrNoRows {
 			return nil, errs.B().Code(errs.NotFound).Msg("bill not found after insert").Err()
 		}
+		log.Error("read bill failed", "err", err)
 		return nil, errs.B().Code(errs.Internal).Msg("read bill").Err()
 	}
 	if closed.Valid {
@@ -52,15 +123,52 @@ type AddLineItemInput struct {
 	LineItemID  string
 	BillID      string
 	Description string
+	Category    string
 	AmountMinor int64
 	Currency    Currency
+	Proration   *Proration
+	Credit      bool       // AmountMinor is negative
+	CreatedAt   *time.Time // backfills only; nil is now()
 }
 
-// AddLineItemActivity inserts a line item.
-// Idempotent by primary key.
+// AddLineItemActivity inserts a line item, or a credit with a negative
+// amount. Idempotent by primary key.
 func AddLineItemActivity(ctx context.Context, in AddLineItemInput) (*LineItem, error) {
-	if in.AmountMinor <= 0 {
-		return nil, errs.B().Code(errs.InvalidArgument).Msg("amount must be positive").Err()
+	log := activityLog(ctx, in.BillID)
+
+	switch {
+	case in.Credit && (in.AmountMinor >= 0 || in.Proration != nil):
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("credit amount must be negative, without proration").Err())
+	case !in.Credit && in.AmountMinor <= 0:
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("amount must be positive").Err())
+	}
+	if err := checkLineItemAmount(in.Currency, in.AmountMinor); err != nil {
+		return nil, nonRetryable(err)
+	}
+	description, err := normalizeDescription(in.Description)
+	if err != nil {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+	}
+	in.Description = description
+	if in.Category, err = normalizeCategory(in.Category); err != nil {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+	}
+
+	var proration *string
+	if in.Proration != nil {
+		if err := in.Proration.Validate(); err != nil {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		}
+		if in.Proration.AmountMinor() != in.AmountMinor {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("amount does not match proration").Err())
+		}
+		b, err := json.Marshal(in.Proration)
+		if err != nil {
+			log.Error("encode proration failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("encode proration").Err()
+		}
+		str := string(b)
+		proration = &str
 	}
 
 	row := db.QueryRow(ctx, `
@@ -70,58 +178,806 @@ func AddLineItemActivity(ctx context.Context, in AddLineItemInput) (*LineItem, e
 	var status string
 	var currency string
 	if err := row.Scan(&status, &currency); err != nil {
-		return nil, errs.B().Code(errs.NotFound).Msg("bill not found").Err()
+		if err == sqldb.ErrNoRows {
+			return nil, nonRetryable(errBillNotFound())
+		}
+		log.Error("get bill status failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("get bill status").Err()
 	}
 	if BillStatus(status) != StatusOpen {
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is closed").Err()
+		return nil, nonRetryable(errBillClosed())
 	}
 	if Currency(currency) != in.Currency {
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("currency mismatch").Err()
+		return nil, nonRetryable(errCurrencyMismatch())
 	}
 
-	_, err := db.Exec(ctx, `
-		INSERT INTO bill_line_items (id, bill_id, description, amount_minor)
-		VALUES ($1, $2, $3, $4)
+	// Running total without this item, so a retry after the insert landed
+	// doesn't count it twice
+	var total int64
+	if err := db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+		WHERE bill_id = $1 AND invoice_id IS NULL AND id <> $2
+	`, in.BillID, in.LineItemID).Scan(&total); err != nil {
+		log.Error("sum line items failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("sum line items").Err()
+	}
+	if err := checkBillTotalCap(in.Currency, total, in.AmountMinor); err != nil {
+		return nil, nonRetryable(err)
+	}
+
+	res, err := db.Exec(ctx, `
+		INSERT INTO bill_line_items (id, bill_id, description, amount_minor, proration, currency, created_at, category)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, COALESCE($7::timestamptz, now()), $8)
 		ON CONFLICT (id) DO NOTHING
-	`, in.LineItemID, in.BillID, in.Description, in.AmountMinor)
+	`, in.LineItemID, in.BillID, in.Description, in.AmountMinor, proration, string(in.Currency), in.CreatedAt, in.Category)
 	if err != nil {
+		// DB-level currency lock (trigger), in case the bill changed under us
+		if sqldb.ErrCode(err) == sqlerr.CheckViolation {
+			return nil, nonRetryable(errCurrencyMismatch())
+		}
+		log.Error("insert line item failed", "err", err)
 		return nil, errs.B().Code(errs.Internal).Msg("insert line item").Err()
 	}
+	if res.RowsAffected() > 0 {
+		lineItemsAdded.With(currencyLabels{Currency: string(in.Currency)}).Increment()
+		log.Info("line item added", "line_item_id", in.LineItemID, "amount_minor", in.AmountMinor)
+		if err := touchBill(ctx, in.BillID); err != nil {
+			return nil, err
+		}
+	}
 
 	liRow := db.QueryRow(ctx, `
-		SELECT id, bill_id, description, amount_minor, created_at
-		FROM bill_line_items WHERE id = $1
-	`, in.LineItemID)
+		SELECT id, bill_id, description, amount_minor, created_at, proration, kind, category
+		FROM bill_line_items WHERE id = $1 AND bill_id = $2
+	`, in.LineItemID, in.BillID)
 
 	var li LineItem
-	if err := liRow.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt); err != nil {
+	var rawProration []byte
+	if err := liRow.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &rawProration, &li.Kind, &li.Category); err != nil {
+		if err == sqldb.ErrNoRows {
+			// Client-supplied IDs are global; this one is another bill's
+			return nil, nonRetryable(errs.B().Code(errs.AlreadyExists).Msg("line item id already used").Err())
+		}
+		log.Error("read line item failed", "err", err)
 		return nil, errs.B().Code(errs.Internal).Msg("read line item").Err()
 	}
+	if li.Proration, err = decodeProration(rawProration); err != nil {
+		log.Error("decode proration failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("decode proration").Err()
+	}
 
 	return &li, nil
 }
 
-type CloseBillInput struct {
+type AddLineItemsInput struct {
+	BillID   string
+	Currency Currency
+	Items    []BatchLineItem
+}
+
+// AddLineItemsActivity inserts a batch of line items in one statement, so
+// either all of them land or none do. Returns the items in input order.
+// Idempotent by primary key.
+func AddLineItemsActivity(ctx context.Context, in AddLineItemsInput) ([]LineItem, error) {
+	log := activityLog(ctx, in.BillID)
+
+	if len(in.Items) == 0 {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("no line items").Err())
+	}
+	var batchTotal int64
+	for i, it := range in.Items {
+		if it.AmountMinor <= 0 {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("amount must be positive").Err())
+		}
+		if err := checkLineItemAmount(in.Currency, it.AmountMinor); err != nil {
+			return nil, nonRetryable(err)
+		}
+		if err := checkTotalDelta(batchTotal, it.AmountMinor); err != nil {
+			return nil, nonRetryable(err)
+		}
+		batchTotal += it.AmountMinor
+		description, err := normalizeDescription(it.Description)
+		if err != nil {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		}
+		in.Items[i].Description = description
+		if in.Items[i].Category, err = normalizeCategory(it.Category); err != nil {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		}
+	}
+
+	status, currency, err := getBillStatusAndCurrency(ctx, in.BillID)
+	if err != nil {
+		return nil, lookupErr(err)
+	}
+	if status != StatusOpen {
+		return nil, nonRetryable(errBillNotOpen(status))
+	}
+	if currency != in.Currency {
+		return nil, nonRetryable(errCurrencyMismatch())
+	}
+
+	// $1 bill_id, $2 currency, then (id, description, amount_minor, category) per item
+	values := make([]string, len(in.Items))
+	args := []interface{}{in.BillID, string(in.Currency)}
+	ids := make([]string, len(in.Items))
+	for i, it := range in.Items {
+		n := len(args)
+		values[i] = fmt.Sprintf("($%d, $1, $%d, $%d, $2, $%d)", n+1, n+2, n+3, n+4)
+		args = append(args, it.LineItemID, it.Description, it.AmountMinor, it.Category)
+		ids[i] = it.LineItemID
+	}
+
+	// Running total without the batch, so a retry after the insert landed
+	// doesn't count it twice
+	var total int64
+	if err := db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+		WHERE bill_id = $1 AND invoice_id IS NULL AND NOT (id = ANY($2))
+	`, in.BillID, ids).Scan(&total); err != nil {
+		log.Error("sum line items failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("sum line items").Err()
+	}
+	if err := checkBillTotalCap(in.Currency, total, batchTotal); err != nil {
+		return nil, nonRetryable(err)
+	}
+
+	res, err := db.Exec(ctx, `
+		INSERT INTO bill_line_items (id, bill_id, description, amount_minor, currency, category)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT (id) DO NOTHING
+	`, args...)
+	if err != nil {
+		if sqldb.ErrCode(err) == sqlerr.CheckViolation {
+			return nil, nonRetryable(errCurrencyMismatch())
+		}
+		log.Error("insert line items failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("insert line items").Err()
+	}
+	if n := res.RowsAffected(); n > 0 {
+		lineItemsAdded.With(currencyLabels{Currency: string(in.Currency)}).Add(uint64(n))
+		log.Info("line items added", "count", n)
+		if err := touchBill(ctx, in.BillID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, bill_id, description, amount_minor, created_at, kind, category
+		FROM bill_line_items
+		WHERE bill_id = $1 AND id = ANY($2)
+	`, in.BillID, ids)
+	if err != nil {
+		log.Error("read line items failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("read line items").Err()
+	}
+	defer rows.Close()
+
+	byID := make(map[string]LineItem, len(ids))
+	for rows.Next() {
+		var li LineItem
+		if err := rows.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &li.Kind, &li.Category); err != nil {
+			log.Error("read line items failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("read line items").Err()
+		}
+		byID[li.ID] = li
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("read line items failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("read line items").Err()
+	}
+
+	items := make([]LineItem, 0, len(ids))
+	for _, id := range ids {
+		li, ok := byID[id]
+		if !ok {
+			// ID already used by another bill's item
+			return nil, nonRetryable(errs.B().Code(errs.AlreadyExists).Msg("line item id conflict").Err())
+		}
+		items = append(items, li)
+	}
+	return items, nil
+}
+
+type UpdateLineItemInput struct {
+	BillID      string
+	LineItemID  string
+	Description *string // nil: unchanged
+	AmountMinor *int64  // nil: unchanged
+}
+
+// UpdateLineItemActivity edits a line item of an OPEN bill. Changing the
+// amount drops the item's proration, which no longer describes it.
+// Idempotent: the update writes absolute values.
+func UpdateLineItemActivity(ctx context.Context, in UpdateLineItemInput) (*LineItem, error) {
+	log := activityLog(ctx, in.BillID)
+
+	if in.AmountMinor != nil && *in.AmountMinor <= 0 {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("amount must be positive").Err())
+	}
+	if in.Description != nil {
+		description, err := normalizeDescription(*in.Description)
+		if err != nil {
+			return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		}
+		in.Description = &description
+	}
+	if in.AmountMinor != nil {
+		if err := checkUpdateCaps(ctx, in); err != nil {
+			return nil, err
+		}
+	}
+
+	row := db.QueryRow(ctx, `
+		UPDATE bill_line_items li
+		SET description = COALESCE($3::text, li.description),
+			amount_minor = COALESCE($4::bigint, li.amount_minor),
+			proration = CASE WHEN $4::bigint IS NULL OR $4::bigint = li.amount_minor THEN li.proration END
+		FROM bills b
+		WHERE li.id = $1 AND li.bill_id = $2 AND li.invoice_id IS NULL
+			AND b.id = li.bill_id AND b.status = 'OPEN'
+		RETURNING li.id, li.bill_id, li.description, li.amount_minor, li.created_at, li.proration, li.kind, li.category
+	`, in.LineItemID, in.BillID, in.Description, in.AmountMinor)
+
+	var li LineItem
+	var rawProration []byte
+	if err := row.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &rawProration, &li.Kind, &li.Category); err != nil {
+		if err == sqldb.ErrNoRows {
+			return nil, nonRetryable(errs.B().Code(errs.FailedPrecondition).Msg("bill is closed or line item not found").Err())
+		}
+		log.Error("update line item failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("update line item").Err()
+	}
+	var err error
+	if li.Proration, err = decodeProration(rawProration); err != nil {
+		log.Error("decode proration failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("decode proration").Err()
+	}
+
+	if err := touchBill(ctx, in.BillID); err != nil {
+		return nil, err
+	}
+	log.Info("line item updated", "line_item_id", li.ID, "amount_minor", li.AmountMinor)
+	return &li, nil
+}
+
+// checkUpdateCaps applies the per-item and bill total caps to a new
+// amount. A missing item or closed bill is left to the update to report.
+func checkUpdateCaps(ctx context.Context, in UpdateLineItemInput) error {
+	var currency string
+	var amount, total int64
+	err := db.QueryRow(ctx, `
+		SELECT b.currency, li.amount_minor, (
+			SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+			WHERE bill_id = b.id AND invoice_id IS NULL
+		)
+		FROM bill_line_items li
+		JOIN bills b ON b.id = li.bill_id
+		WHERE li.id = $1 AND li.bill_id = $2 AND li.invoice_id IS NULL
+	`, in.LineItemID, in.BillID).Scan(&currency, &amount, &total)
+	if err == sqldb.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		activityLog(ctx, in.BillID).Error("lookup line item failed", "err", err)
+		return errs.B().Code(errs.Internal).Msg("lookup line item").Err()
+	}
+	if err := checkLineItemUpdate(Currency(currency), total, amount, *in.AmountMinor); err != nil {
+		return nonRetryable(err)
+	}
+	return nil
+}
+
+type RemoveLineItemInput struct {
 	BillID     string
-	TotalMinor int64
+	LineItemID string
 }
 
-// CloseBillActivity marks bill closed with final total.
-func CloseBillActivity(ctx context.Context, in CloseBillInput) (*Bill, error) {
+// RemoveLineItemActivity deletes a line item of an OPEN bill.
+// Idempotent: deleting an already-deleted item is a no-op.
+func RemoveLineItemActivity(ctx context.Context, in RemoveLineItemInput) error {
+	log := activityLog(ctx, in.BillID)
+
+	res, err := db.Exec(ctx, `
+		DELETE FROM bill_line_items li
+		USING bills b
+		WHERE li.id = $1 AND li.bill_id = $2 AND li.invoice_id IS NULL
+			AND b.id = li.bill_id AND b.status = 'OPEN'
+	`, in.LineItemID, in.BillID)
+	if err != nil {
+		log.Error("delete line item failed", "err", err)
+		return errs.B().Code(errs.Internal).Msg("delete line item").Err()
+	}
+	if res.RowsAffected() > 0 {
+		log.Info("line item removed", "line_item_id", in.LineItemID)
+		return touchBill(ctx, in.BillID)
+	}
+	return nil
+}
+
+type ApplyDiscountInput struct {
+	DiscountID string
+	BillID     string
+	Type       DiscountType
+	Value      int64
+}
+
+// ApplyDiscountActivity records a discount on an OPEN bill.
+// Idempotent by primary key.
+func ApplyDiscountActivity(ctx context.Context, in ApplyDiscountInput) (*Discount, error) {
+	log := activityLog(ctx, in.BillID)
+
+	if !in.Type.Valid() || in.Value <= 0 || (in.Type == DiscountPercent && in.Value > 100) {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("invalid discount").Err())
+	}
+
+	status, _, err := getBillStatusAndCurrency(ctx, in.BillID)
+	if err != nil {
+		return nil, lookupErr(err)
+	}
+	if status != StatusOpen {
+		return nil, nonRetryable(errBillNotOpen(status))
+	}
+
+	res, err := db.Exec(ctx, `
+		INSERT INTO bill_discounts (id, bill_id, type, value)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+	`, in.DiscountID, in.BillID, string(in.Type), in.Value)
+	if err != nil {
+		log.Error("insert discount failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("insert discount").Err()
+	}
+	if res.RowsAffected() > 0 {
+		log.Info("discount applied", "discount_id", in.DiscountID, "type", in.Type, "value", in.Value)
+		if err := touchBill(ctx, in.BillID); err != nil {
+			return nil, err
+		}
+	}
+
 	row := db.QueryRow(ctx, `
+		SELECT id, bill_id, type, value, created_at
+		FROM bill_discounts WHERE id = $1
+	`, in.DiscountID)
+
+	var d Discount
+	if err := row.Scan(&d.ID, &d.BillID, &d.Type, &d.Value, &d.CreatedAt); err != nil {
+		log.Error("read discount failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("read discount").Err()
+	}
+	return &d, nil
+}
+
+type SetCurrencyInput struct {
+	BillID   string
+	Currency Currency
+}
+
+// SetCurrencyActivity changes the currency of an OPEN bill that has no line
+// items. FIXED discounts are in minor units of the old currency, so they
+// block the change too. Idempotent: setting the current currency is a no-op.
+func SetCurrencyActivity(ctx context.Context, in SetCurrencyInput) error {
+	log := activityLog(ctx, in.BillID)
+
+	if !in.Currency.Valid() {
+		return nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("unsupported currency").Err())
+	}
+
+	res, err := db.Exec(ctx, `
+		UPDATE bills
+		SET currency = $2, updated_at = now()
+		WHERE id = $1 AND status = 'OPEN' AND currency <> $2
+			AND NOT EXISTS (SELECT 1 FROM bill_line_items WHERE bill_id = $1)
+			AND NOT EXISTS (SELECT 1 FROM bill_discounts WHERE bill_id = $1 AND type = 'FIXED')
+	`, in.BillID, string(in.Currency))
+	if err != nil {
+		log.Error("set currency failed", "err", err)
+		return errs.B().Code(errs.Internal).Msg("set currency").Err()
+	}
+	if res.RowsAffected() > 0 {
+		log.Info("currency changed", "currency", in.Currency)
+		return nil
+	}
+
+	// Nothing updated: either already set (a retry) or not allowed
+	status, currency, err := getBillStatusAndCurrency(ctx, in.BillID)
+	if err != nil {
+		return lookupErr(err)
+	}
+	switch {
+	case status != StatusOpen:
+		return nonRetryable(errBillClosed())
+	case currency == in.Currency:
+		return nil
+	}
+	return nonRetryable(reasonErr(errs.FailedPrecondition, ReasonCurrencyLocked, "bill has line items or fixed discounts; currency is locked"))
+}
+
+type SetMemoInput struct {
+	BillID string
+	Memo   string
+}
+
+// SetMemoActivity replaces an OPEN bill's memo; the memo is frozen once the
+// bill closes. Idempotent: setting the current memo is a no-op.
+func SetMemoActivity(ctx context.Context, in SetMemoInput) error {
+	log := activityLog(ctx, in.BillID)
+
+	res, err := db.Exec(ctx, `
 		UPDATE bills
-		SET status = $2, total_minor = $3, closed_at = now()
+		SET memo = $2, updated_at = now()
+		WHERE id = $1 AND status = 'OPEN' AND memo <> $2
+	`, in.BillID, in.Memo)
+	if err != nil {
+		log.Error("set memo failed", "err", err)
+		return errs.B().Code(errs.Internal).Msg("set memo").Err()
+	}
+	if res.RowsAffected() > 0 {
+		log.Info("memo changed")
+		return nil
+	}
+
+	// Nothing updated: either already set (a retry) or the bill left OPEN
+	status, _, err := getBillStatusAndCurrency(ctx, in.BillID)
+	if err != nil {
+		return lookupErr(err)
+	}
+	if status != StatusOpen {
+		return nonRetryable(errBillNotOpen(status))
+	}
+	return nil
+}
+
+type CloseBillInput struct {
+	BillID        string
+	TotalMinor    int64
+	SubtotalMinor int64
+	DiscountMinor int64
+	TaxMinor      int64
+
+	// Optional close-time conversion; stored NULL when BaseCurrency is empty
+	BaseCurrency   Currency
+	BaseTotalMinor int64
+	FXRatePPM      int64
+}
+
+// CloseBillActivity marks bill closed with final total and its breakdown.
+//
+// The workflow's subtotal is checked against the sum of the uninvoiced items
+// actually stored, with the bill row locked so no add lands in between. If
+// they differ (an add the workflow never saw land, say), the DB wins: the
+// breakdown is recomputed from its sum and stored, and the drift is logged,
+// as an error beyond CloseTotalDriftToleranceMinor.
+func CloseBillActivity(ctx context.Context, in CloseBillInput) (*Bill, error) {
+	log := activityLog(ctx, in.BillID)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Error("begin close failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("begin close").Err()
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE also blocks item inserts, whose FK check locks the row
+	var (
+		currency   Currency
+		taxRateBps int
+		rounding   RoundingMode
+		itemSum    int64
+	)
+	if err := tx.QueryRow(ctx, `
+		SELECT currency, tax_rate_bps, rounding_mode,
+			(SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+			 WHERE bill_id = b.id AND invoice_id IS NULL)
+		FROM bills b
+		WHERE id = $1 AND status = 'OPEN'
+		FOR UPDATE
+	`, in.BillID).Scan(&currency, &taxRateBps, &rounding, &itemSum); err != nil {
+		if err == sqldb.ErrNoRows {
+			return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill already closed or not found").Err()
+		}
+		log.Error("read bill for close failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("read bill for close").Err()
+	}
+
+	if drift := itemSum - in.SubtotalMinor; drift != 0 {
+		if err := reconcileCloseTotals(ctx, &in, currency, taxRateBps, rounding, itemSum); err != nil {
+			return nil, err
+		}
+		billCloseTotalDrift.With(currencyLabels{Currency: string(currency)}).Increment()
+		if drift > cfg.CloseTotalDriftToleranceMinor || drift < -cfg.CloseTotalDriftToleranceMinor {
+			log.Error("workflow subtotal disagrees with stored items; storing the DB total",
+				"workflow_subtotal_minor", itemSum-drift, "db_subtotal_minor", itemSum, "drift_minor", drift)
+		} else {
+			log.Warn("workflow subtotal disagrees with stored items; storing the DB total",
+				"workflow_subtotal_minor", itemSum-drift, "db_subtotal_minor", itemSum, "drift_minor", drift)
+		}
+	}
+
+	var baseCurrency *string
+	var baseTotal, rate *int64
+	if in.BaseCurrency != "" {
+		c := string(in.BaseCurrency)
+		baseCurrency, baseTotal, rate = &c, &in.BaseTotalMinor, &in.FXRatePPM
+	}
+
+	row := tx.QueryRow(ctx, `
+		UPDATE bills
+		SET status = $2, total_minor = $3, subtotal_minor = $4, discount_minor = $5, tax_minor = $6,
+			base_currency = $7, base_total_minor = $8, fx_rate_ppm = $9,
+			closed_at = now(), updated_at = now()
 		WHERE id = $1 AND status = 'OPEN'
-		RETURNING id, status, currency, total_minor, created_at, closed_at
-	`, in.BillID, string(StatusClosed), in.TotalMinor)
+		RETURNING id, status, currency, total_minor, created_at, closed_at, updated_at,
+			tax_rate_bps, subtotal_minor, discount_minor, tax_minor
+	`, in.BillID, string(StatusClosed), in.TotalMinor, in.SubtotalMinor, in.DiscountMinor, in.TaxMinor,
+		baseCurrency, baseTotal, rate)
 
 	var b Bill
 	var closed sql.NullTime
-	if err := row.Scan(&b.ID, &b.Status, &b.Currency, &b.TotalMinor, &b.CreatedAt, &closed); err != nil {
+	if err := row.Scan(&b.ID, &b.Status, &b.Currency, &b.TotalMinor, &b.CreatedAt, &closed, &b.UpdatedAt,
+		&b.TaxRateBps, &b.SubtotalMinor, &b.DiscountMinor, &b.TaxMinor); err != nil {
 		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill already closed or not found").Err()
 	}
+	if err := tx.Commit(); err != nil {
+		log.Error("commit close failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("commit close").Err()
+	}
 	if closed.Valid {
 		b.ClosedAt = &closed.Time
 	}
+	b.BaseCurrency, b.BaseTotalMinor, b.FXRatePPM = in.BaseCurrency, in.BaseTotalMinor, in.FXRatePPM
+	billsClosed.With(currencyLabels{Currency: string(b.Currency)}).Increment()
+	log.Info("bill closed", "total_minor", b.TotalMinor, "currency", b.Currency)
 	return &b, nil
 }
+
+// reconcileCloseTotals recomputes a close's breakdown from the stored item
+// sum, with the bill's stored discounts, tax rate and rounding, and converts
+// the new total at the rate the workflow already chose.
+func reconcileCloseTotals(ctx context.Context, in *CloseBillInput, currency Currency, taxRateBps int, rounding RoundingMode, itemSum int64) error {
+	discounts, err := listDiscounts(ctx, in.BillID)
+	if err != nil {
+		return err
+	}
+	discount, tax, total, err := billTotals(itemSum, discounts, taxRateBps, rounding)
+	if err != nil {
+		return nonRetryable(err)
+	}
+	in.SubtotalMinor, in.DiscountMinor, in.TaxMinor, in.TotalMinor = itemSum, discount, tax, total
+
+	if in.BaseCurrency != "" {
+		if in.BaseTotalMinor, err = convertMinor(total, currency, in.BaseCurrency, in.FXRatePPM); err != nil {
+			return nonRetryable(err)
+		}
+	}
+	return nil
+}
+
+type ConvertCurrencyInput struct {
+	AmountMinor int64
+	From        Currency
+	To          Currency
+}
+
+type ConvertCurrencyResult struct {
+	AmountMinor int64
+	RatePPM     int64 // To units per From unit, times 10^6
+}
+
+// ConvertCurrencyActivity converts an amount at the current rate. The rate
+// lookup lives in an activity so a live FX source can replace the static
+// table without touching the workflow; same-currency is a no-op at 1.0.
+func ConvertCurrencyActivity(ctx context.Context, in ConvertCurrencyInput) (*ConvertCurrencyResult, error) {
+	rate, err := fxRate(in.From, in.To)
+	if err != nil {
+		return nil, nonRetryable(err)
+	}
+	amount, err := convertMinor(in.AmountMinor, in.From, in.To, rate)
+	if err != nil {
+		return nil, nonRetryable(err)
+	}
+	return &ConvertCurrencyResult{AmountMinor: amount, RatePPM: rate}, nil
+}
+
+const webhookTimeout = 5 * time.Second
+
+// NotifyBillClosedActivity POSTs the final bill to cfg.BillClosedWebhookURL,
+// signed with HMAC-SHA256 over the body. Temporal may deliver it more than
+// once; receivers dedupe on X-Bill-Event-ID, which is stable per bill.
+// A no-op when the webhook is not configured.
+func NotifyBillClosedActivity(ctx context.Context, result BillResult) error {
+	log := activityLog(ctx, result.BillID)
+
+	if cfg.BillClosedWebhookURL == "" {
+		return nil
+	}
+	if secrets.WebhookSigningKey == "" {
+		return nonRetryable(errs.B().Code(errs.FailedPrecondition).Msg("webhook signing key not set").Err())
+	}
+
+	// A run that continued as new only carried earlier items' IDs; the
+	// receiver gets the full items from the DB
+	if len(result.CarriedItems) > 0 {
+		items, err := listUninvoicedLineItems(ctx, result.BillID)
+		if err != nil {
+			return err
+		}
+		result.Items = make([]LineItem, len(items))
+		for i, li := range items {
+			result.Items[i] = *li
+		}
+		result.CarriedItems = nil
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Error("encode bill result failed", "err", err)
+		return nonRetryable(errs.B().Code(errs.Internal).Msg("encode bill result").Err())
+	}
+	mac := hmac.New(sha256.New, []byte(secrets.WebhookSigningKey))
+	mac.Write(body)
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.BillClosedWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Error("build webhook request failed", "err", err)
+		return nonRetryable(errs.B().Code(errs.Internal).Msg("build webhook request").Err())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Bill-Event-ID", "bill-closed-"+result.BillID)
+	req.Header.Set("X-Bill-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Error("webhook request failed", "err", err)
+		return errs.B().Code(errs.Unavailable).Msg("webhook request failed").Err()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error("webhook rejected", "status", resp.StatusCode)
+		return errs.B().Code(errs.Unavailable).Msgf("webhook returned %d", resp.StatusCode).Err()
+	}
+	log.Info("bill closed webhook delivered")
+	return nil
+}
+
+type VoidBillInput struct {
+	BillID string
+	Reason string
+}
+
+// VoidBillActivity marks an OPEN bill VOID. Idempotent: an already-void
+// bill is accepted; a CLOSED one fails.
+func VoidBillActivity(ctx context.Context, in VoidBillInput) error {
+	log := activityLog(ctx, in.BillID)
+
+	voided, err := voidBillRow(ctx, in.BillID, in.Reason)
+	if err != nil {
+		log.Error("void bill failed", "err", err)
+		return err
+	}
+	if voided {
+		log.Info("bill voided", "reason", in.Reason)
+		return nil
+	}
+
+	status, _, err := getBillStatusAndCurrency(ctx, in.BillID)
+	if err != nil {
+		return lookupErr(err)
+	}
+	if status != StatusVoid {
+		return nonRetryable(errBillClosed())
+	}
+	return nil
+}
+
+type IssueInvoiceInput struct {
+	InvoiceID   string
+	BillID      string
+	Currency    Currency
+	LineItemIDs []string // the workflow's items not yet invoiced
+}
+
+// IssueInvoiceActivity creates an invoice for an OPEN bill and freezes the
+// given items on it, in one transaction. The total is summed from the DB.
+// Idempotent by invoice ID: a retry returns the invoice already issued.
+func IssueInvoiceActivity(ctx context.Context, in IssueInvoiceInput) (*Invoice, error) {
+	log := activityLog(ctx, in.BillID)
+
+	if len(in.LineItemIDs) == 0 {
+		return nil, nonRetryable(errs.B().Code(errs.InvalidArgument).Msg("no line items to invoice").Err())
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Error("begin invoice failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("begin invoice").Err()
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, `
+		INSERT INTO invoices (id, bill_id, currency, total_minor)
+		SELECT $1, b.id, $3,
+			(SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+			 WHERE bill_id = b.id AND id = ANY($4) AND invoice_id IS NULL)
+		FROM bills b
+		WHERE b.id = $2 AND b.status = 'OPEN' AND b.deleted_at IS NULL
+		ON CONFLICT (id) DO NOTHING
+	`, in.InvoiceID, in.BillID, string(in.Currency), in.LineItemIDs)
+	if err != nil {
+		log.Error("insert invoice failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("insert invoice").Err()
+	}
+
+	if res.RowsAffected() > 0 {
+		upd, err := tx.Exec(ctx, `
+			UPDATE bill_line_items
+			SET invoice_id = $1
+			WHERE bill_id = $2 AND id = ANY($3) AND invoice_id IS NULL
+		`, in.InvoiceID, in.BillID, in.LineItemIDs)
+		if err != nil {
+			log.Error("freeze invoiced items failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("freeze invoiced items").Err()
+		}
+		if n := upd.RowsAffected(); n != int64(len(in.LineItemIDs)) {
+			// The workflow's items and the DB disagree; don't issue a
+			// partial invoice
+			return nil, nonRetryable(errs.B().Code(errs.FailedPrecondition).
+				Msgf("invoice covers %d of %d items", n, len(in.LineItemIDs)).Err())
+		}
+		if _, err := tx.Exec(ctx, `UPDATE bills SET updated_at = now() WHERE id = $1`, in.BillID); err != nil {
+			log.Error("touch bill failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("touch bill").Err()
+		}
+		if err := tx.Commit(); err != nil {
+			log.Error("commit invoice failed", "err", err)
+			return nil, errs.B().Code(errs.Internal).Msg("commit invoice").Err()
+		}
+		log.Info("invoice issued", "invoice_id", in.InvoiceID, "items", len(in.LineItemIDs))
+	}
+
+	inv, err := getInvoice(ctx, in.InvoiceID)
+	if err != nil {
+		if errs.Code(err) == errs.NotFound {
+			// Nothing inserted and no earlier attempt did: the bill isn't open
+			status, _, err := getBillStatusAndCurrency(ctx, in.BillID)
+			if err != nil {
+				return nil, lookupErr(err)
+			}
+			return nil, nonRetryable(errBillNotOpen(status))
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+type DeleteBillInput struct {
+	BillID string
+}
+
+// DeleteBillActivity soft-deletes a bill, voiding it if still OPEN.
+// Idempotent: an already-deleted bill is accepted.
+func DeleteBillActivity(ctx context.Context, in DeleteBillInput) error {
+	log := activityLog(ctx, in.BillID)
+
+	deleted, err := softDeleteBillRow(ctx, in.BillID)
+	if err != nil {
+		log.Error("delete bill failed", "err", err)
+		return err
+	}
+	if deleted {
+		log.Info("bill deleted")
+	}
+	return nil
+}
+
+// touchBill bumps the bill's updated_at so incremental sync picks it up.
+func touchBill(ctx context.Context, billID string) error {
+	if _, err := db.Exec(ctx, `UPDATE bills SET updated_at = now() WHERE id = $1`, billID); err != nil {
+		return errs.B().Code(errs.Internal).Msg("touch bill").Err()
+	}
+	return nil
+}
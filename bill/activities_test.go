@@ -0,0 +1,57 @@
+package bill
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"encore.dev/beta/errs"
+	"go.temporal.io/sdk/temporal"
+)
+
+// retryable reports whether Temporal would retry an activity failing with err.
+func retryable(err error) bool {
+	var appErr *temporal.ApplicationError
+	return !errors.As(err, &appErr) || !appErr.NonRetryable()
+}
+
+func TestLookupErr(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"missing bill", errBillNotFound(), false},
+		{"lookup failed", errs.B().Code(errs.Internal).Msg("get bill status").Err(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := lookupErr(tt.err)
+			if retryable(err) != tt.retry {
+				t.Errorf("retryable = %v, want %v", retryable(err), tt.retry)
+			}
+			if errs.Code(err) != errs.Code(tt.err) {
+				t.Errorf("code = %v, want %v", errs.Code(err), errs.Code(tt.err))
+			}
+		})
+	}
+}
+
+// Runs against the test database encore test provisions. A cancelled
+// context stands in for a dropped connection during the bill lookup.
+func TestBillLookupFailureRetried(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := AddLineItemActivity(ctx, AddLineItemInput{
+		BillID: "bill-1", LineItemID: "li-1", Description: "seat", AmountMinor: 100, Currency: CurrencyUSD,
+	})
+	if errs.Code(err) != errs.Internal || !retryable(err) {
+		t.Errorf("add with a failed lookup = %v, want a retryable Internal error", err)
+	}
+
+	_, _, err = getBillStatusAndCurrency(ctx, "bill-1")
+	if errs.Code(err) != errs.Internal {
+		t.Errorf("status lookup = %v, want Internal, not NotFound", err)
+	}
+}
@@ -0,0 +1,637 @@
+package bill
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+)
+
+var secrets struct {
+	// AdminAPIKey gates the admin-only endpoints (sent as X-Admin-Key).
+	AdminAPIKey string
+
+	// WebhookSigningKey signs bill-closed webhooks (X-Bill-Signature).
+	WebhookSigningKey string
+
+	// APIKeys authenticates callers: comma-separated owner_id:key entries
+	// (see auth.go).
+	APIKeys string
+}
+
+func requireAdmin(key string) error {
+	if secrets.AdminAPIKey == "" {
+		return errs.B().Code(errs.PermissionDenied).Msg("admin API disabled").Err()
+	}
+	if key == "" {
+		return errs.B().Code(errs.Unauthenticated).Msg("missing admin key").Err()
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(secrets.AdminAPIKey)) != 1 {
+		return errs.B().Code(errs.PermissionDenied).Msg("invalid admin key").Err()
+	}
+	return nil
+}
+
+// ==============================
+// Import (legacy onboarding)
+// ==============================
+
+type ImportBillRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	ID         string           `json:"id"`
+	Status     BillStatus       `json:"status"`
+	Currency   Currency         `json:"currency"`
+	TotalMinor int64            `json:"total_minor"` // CLOSED only; OPEN bills accrue in the workflow
+	CreatedAt  time.Time        `json:"created_at"`
+	ClosedAt   *time.Time       `json:"closed_at,omitempty"`
+	Items      []ImportLineItem `json:"items"`
+
+	// Tenant the bill belongs to; empty for an unowned bill
+	OwnerID string `json:"owner_id"`
+
+	// Start a lifecycle workflow for an OPEN import so it can keep accruing
+	StartWorkflow bool `json:"start_workflow"`
+}
+
+type ImportLineItem struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	AmountMinor int64     `json:"amount_minor"`
+	CreatedAt   time.Time `json:"created_at"` // defaults to the bill's created_at
+}
+
+type ImportBillResponse struct {
+	BillID          string `json:"bill_id"`
+	WorkflowStarted bool   `json:"workflow_started"`
+
+	// 201 Created + Location: /bills/{id}
+	Status   int    `encore:"httpstatus" json:"-"`
+	Location string `header:"Location" json:"-"`
+}
+
+// ImportBill writes a complete bill straight to the DB, bypassing the workflow.
+// Admin-only bulk onboarding tool for migrations from the legacy system.
+//
+//encore:api public method=POST path=/bills/import
+func (s *Service) ImportBill(ctx context.Context, req *ImportBillRequest) (*ImportBillResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if req.Status == StatusOpen && req.StartWorkflow {
+		if err := s.requireTemporal(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := importBillTx(ctx, req); err != nil {
+		return nil, err
+	}
+
+	out := &ImportBillResponse{
+		BillID:   req.ID,
+		Status:   http.StatusCreated,
+		Location: billLocation(req.ID),
+	}
+	if req.Status != StatusOpen || !req.StartWorkflow {
+		return out, nil
+	}
+
+	initial := &BillResult{
+		BillID:   req.ID,
+		Currency: req.Currency,
+		Items:    make([]LineItem, 0, len(req.Items)),
+	}
+	for _, it := range req.Items {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = req.CreatedAt
+		}
+		initial.TotalMinor += it.AmountMinor
+		initial.Items = append(initial.Items, LineItem{
+			ID:          it.ID,
+			BillID:      req.ID,
+			Description: it.Description,
+			AmountMinor: it.AmountMinor,
+			CreatedAt:   createdAt,
+		})
+	}
+
+	_, err := s.temporalClient.ExecuteWorkflow(
+		ctx,
+		client.StartWorkflowOptions{
+			ID:                                       workflowIDForBill(req.ID),
+			TaskQueue:                                taskQueue(),
+			WorkflowIDReusePolicy:                    workflowIDReusePolicy(),
+			WorkflowExecutionErrorWhenAlreadyStarted: true,
+		},
+		BillLifecycleWorkflow,
+		BillWorkflowParams{
+			BillID:                    req.ID,
+			Currency:                  req.Currency,
+			Initial:                   initial,
+			MaxLineItems:              cfg.MaxLineItems,
+			ContinueAsNewAfterSignals: cfg.ContinueAsNewAfterSignals,
+			BaseCurrency:              Currency(cfg.BaseCurrency),
+			OwnerID:                   req.OwnerID,
+		},
+	)
+	if err != nil {
+		// The OPEN row is committed but nothing will ever close it; void it
+		// so it doesn't sit open without a workflow. Detached from ctx, which
+		// may be what failed the start.
+		log := billLog(req.ID)
+		log.Error("imported bill workflow start failed; voiding the bill", "err", err)
+		if _, vErr := voidBillRow(context.WithoutCancel(ctx), req.ID, "import: workflow start failed"); vErr != nil {
+			log.Error("void imported bill failed", "err", vErr)
+		}
+		var started *serviceerror.WorkflowExecutionAlreadyStarted
+		if errors.As(err, &started) {
+			return nil, errs.B().Code(errs.AlreadyExists).Msg("a workflow already exists for this bill; the import was voided").Err()
+		}
+		return nil, errs.B().Code(errs.Internal).Msg("workflow start failed; the import was voided").Err()
+	}
+
+	out.WorkflowStarted = true
+	return out, nil
+}
+
+// ==============================
+// Backfill totals
+// ==============================
+
+const (
+	defaultBackfillPageSize = 100
+	maxBackfillPageSize     = 1000
+	backfillConcurrency     = 4 // parallel recomputeClosedBillTotal calls
+)
+
+type BackfillTotalsRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	Cursor string `json:"cursor"` // next_cursor from the previous call; empty to start
+	Limit  int    `json:"limit"`
+}
+
+type BackfillTotalsResponse struct {
+	Scanned    int    `json:"scanned"`
+	Corrected  int    `json:"corrected"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Done       bool   `json:"done"`
+}
+
+// BackfillTotals recomputes total_minor from line items for one page of
+// CLOSED bills, updating only rows that differ. Call repeatedly with
+// next_cursor until done; safe to re-run or resume after a failure.
+//
+//encore:api public method=POST path=/bills/admin/backfill-totals
+func (s *Service) BackfillTotals(ctx context.Context, req *BackfillTotalsRequest) (*BackfillTotalsResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = defaultBackfillPageSize
+	case limit < 0 || limit > maxBackfillPageSize:
+		return nil, errs.B().Code(errs.InvalidArgument).Msgf("limit must be between 1 and %d", maxBackfillPageSize).Err()
+	}
+
+	ids, err := listClosedBillIDsAfter(ctx, req.Cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		sem       = make(chan struct{}, backfillConcurrency)
+		corrected atomic.Int64
+		errOnce   sync.Once
+		firstErr  error
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fixed, err := recomputeClosedBillTotal(ctx, id)
+			if err != nil {
+				errOnce.Do(func() { firstErr = err })
+				return
+			}
+			if fixed {
+				corrected.Add(1)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	// Resuming from the same cursor is safe: corrections are idempotent
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	out := &BackfillTotalsResponse{
+		Scanned:   len(ids),
+		Corrected: int(corrected.Load()),
+		Done:      len(ids) < limit,
+	}
+	if len(ids) > 0 {
+		out.NextCursor = ids[len(ids)-1]
+	}
+	return out, nil
+}
+
+// ==============================
+// Reconcile report (DB vs Temporal)
+// ==============================
+
+type ReconcileClass string
+
+// Ordered by priority: the report lists the most urgent first.
+const (
+	ReconcileDBOpenWorkflowMissing    ReconcileClass = "db_open_workflow_missing"   // bill can never be closed
+	ReconcileDBOpenWorkflowEnded      ReconcileClass = "db_open_workflow_ended"     // workflow failed/terminated before closing
+	ReconcileDBClosedWorkflowRunning  ReconcileClass = "db_closed_workflow_running" // still accepting signals
+	ReconcileWorkflowRunningDBMissing ReconcileClass = "workflow_running_db_missing"
+	ReconcileConsistent               ReconcileClass = "consistent"
+)
+
+var reconcilePriority = map[ReconcileClass]int{
+	ReconcileDBOpenWorkflowMissing:    0,
+	ReconcileDBOpenWorkflowEnded:      1,
+	ReconcileDBClosedWorkflowRunning:  2,
+	ReconcileWorkflowRunningDBMissing: 3,
+	ReconcileConsistent:               4,
+}
+
+type ReconcileReportRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	Cursor        string `query:"cursor"`         // DB side: next_cursor from the previous page
+	WorkflowToken string `query:"workflow_token"` // Temporal side: next_workflow_token
+	Limit         int    `query:"limit"`
+}
+
+type ReconcileEntry struct {
+	BillID         string         `json:"bill_id"`
+	DBStatus       BillStatus     `json:"db_status,omitempty"`
+	WorkflowStatus string         `json:"workflow_status"`
+	Class          ReconcileClass `json:"class"`
+}
+
+type ReconcileReportResponse struct {
+	Entries           []ReconcileEntry `json:"entries"`
+	NextCursor        string           `json:"next_cursor,omitempty"`
+	NextWorkflowToken string           `json:"next_workflow_token,omitempty"`
+}
+
+// ReconcileReport pages through DB bills (describing each bill's workflow)
+// and through running bill workflows (checking each has a row), and
+// classifies every bill seen. Read-only; entries are sorted most urgent first.
+//
+//encore:api public method=GET path=/bills/admin/reconcile-report
+func (s *Service) ReconcileReport(ctx context.Context, req *ReconcileReportRequest) (*ReconcileReportResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	var pageToken []byte
+	if req.WorkflowToken != "" {
+		if pageToken, err = base64.RawURLEncoding.DecodeString(req.WorkflowToken); err != nil {
+			return nil, errs.B().Code(errs.InvalidArgument).Msg("invalid workflow_token").Err()
+		}
+	}
+
+	out := &ReconcileReportResponse{Entries: []ReconcileEntry{}}
+
+	// 1) DB -> Temporal
+	bills, err := listBillStatusesAfter(ctx, req.Cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bills {
+		wfStatus, err := s.workflowStatus(ctx, b.ID)
+		if err != nil {
+			return nil, err
+		}
+		out.Entries = append(out.Entries, ReconcileEntry{
+			BillID:         b.ID,
+			DBStatus:       b.Status,
+			WorkflowStatus: workflowStatusName(wfStatus),
+			Class:          classifyReconcile(b.Status, wfStatus),
+		})
+	}
+	if len(bills) == limit {
+		out.NextCursor = bills[len(bills)-1].ID
+	}
+
+	// 2) Temporal -> DB: running bill workflows without a row
+	resp, err := s.temporalClient.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+		PageSize:      int32(limit),
+		NextPageToken: pageToken,
+		Query:         "WorkflowType = 'BillLifecycleWorkflow' AND ExecutionStatus = 'Running'",
+	})
+	if err != nil {
+		return nil, errs.B().Code(errs.Unavailable).Msg("list workflows").Err()
+	}
+	var running []string
+	for _, ex := range resp.GetExecutions() {
+		if id, ok := billIDForWorkflow(ex.GetExecution().GetWorkflowId()); ok {
+			running = append(running, id)
+		}
+	}
+	if len(running) > 0 {
+		found, err := existingBillIDs(ctx, running)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range running {
+			if !found[id] {
+				out.Entries = append(out.Entries, ReconcileEntry{
+					BillID:         id,
+					WorkflowStatus: workflowStatusName(enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING),
+					Class:          ReconcileWorkflowRunningDBMissing,
+				})
+			}
+		}
+	}
+	if tok := resp.GetNextPageToken(); len(tok) > 0 {
+		out.NextWorkflowToken = base64.RawURLEncoding.EncodeToString(tok)
+	}
+
+	sort.SliceStable(out.Entries, func(i, j int) bool {
+		return reconcilePriority[out.Entries[i].Class] < reconcilePriority[out.Entries[j].Class]
+	})
+	return out, nil
+}
+
+// workflowStatus returns the bill workflow's status, or UNSPECIFIED when
+// Temporal has no execution for it (never started, or past retention).
+func (s *Service) workflowStatus(ctx context.Context, billID string) (enumspb.WorkflowExecutionStatus, error) {
+	desc, err := s.temporalClient.DescribeWorkflowExecution(ctx, workflowIDForBill(billID), "")
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			return enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED, nil
+		}
+		return 0, errs.B().Code(errs.Unavailable).Msg("describe workflow").Err()
+	}
+	return desc.GetWorkflowExecutionInfo().GetStatus(), nil
+}
+
+func workflowStatusName(st enumspb.WorkflowExecutionStatus) string {
+	if st == enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED {
+		return "missing"
+	}
+	return st.String()
+}
+
+func classifyReconcile(db BillStatus, wf enumspb.WorkflowExecutionStatus) ReconcileClass {
+	running := wf == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+	missing := wf == enumspb.WORKFLOW_EXECUTION_STATUS_UNSPECIFIED
+
+	switch {
+	case db == StatusOpen && missing:
+		return ReconcileDBOpenWorkflowMissing
+	case db == StatusOpen && !running:
+		return ReconcileDBOpenWorkflowEnded
+	case db != StatusOpen && running:
+		return ReconcileDBClosedWorkflowRunning
+	default:
+		return ReconcileConsistent
+	}
+}
+
+// ==============================
+// Backfill a line item
+// ==============================
+
+type BackfillLineItemRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	Description string    `json:"description"`
+	AmountMinor int64     `json:"amount_minor"`
+	Currency    Currency  `json:"currency"`
+	CreatedAt   time.Time `json:"created_at"` // RFC3339; the item's original timestamp
+
+	// Optional: client-chosen UUID, as for line items; makes retries safe
+	LineItemID string `json:"line_item_id,omitempty"`
+}
+
+// BackfillLineItem adds an item to an OPEN bill with its original
+// created_at, for migrating historical bills item by item. It goes through
+// the workflow like any add (same checks, same running total); only the
+// timestamp differs, and it may not be in the future or before the bill's
+// own created_at. Admin-only, so it acts for the bill's owner.
+//
+//encore:api public method=POST path=/bills/:id/line-items/backfill
+func (s *Service) BackfillLineItem(ctx context.Context, id string, req *BackfillLineItemRequest) (*AddLineItemResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != StatusOpen {
+		return nil, errBillNotOpen(b.Status)
+	}
+	if b.Currency != req.Currency {
+		return nil, errCurrencyMismatch()
+	}
+	if req.CreatedAt.Before(b.CreatedAt) {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("created_at is before the bill was created").Err()
+	}
+	count, err := countUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkItemLimit(count, 1); err != nil {
+		return nil, err
+	}
+	total, err := uninvoicedTotalMinor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBillTotalCap(req.Currency, total, req.AmountMinor); err != nil {
+		return nil, err
+	}
+
+	lineItemID, landed, err := resolveLineItemID(ctx, id, req.LineItemID)
+	if err != nil {
+		return nil, err
+	}
+	if !landed {
+		description, _ := normalizeDescription(req.Description) // accepted by validate
+		createdAt := req.CreatedAt.UTC()
+		sig := AddLineItemSignal{
+			LineItemID:  lineItemID,
+			Description: description,
+			AmountMinor: req.AmountMinor,
+			Currency:    req.Currency,
+			OwnerID:     b.OwnerID,
+			CreatedAt:   &createdAt,
+		}
+		if err := s.signalBill(ctx, id, true, signalAddLineItem, sig); err != nil {
+			billLog(id).Warn("backfill line item signal failed", "line_item_id", lineItemID, "err", err)
+			return nil, err
+		}
+		billLog(id).Info("line item backfill signalled",
+			"line_item_id", lineItemID, "amount_minor", req.AmountMinor, "created_at", createdAt)
+	}
+
+	return &AddLineItemResponse{
+		LineItemID: lineItemID,
+		Status:     http.StatusCreated,
+		Location:   lineItemLocation(id, lineItemID),
+	}, nil
+}
+
+// ==============================
+// Force-terminate a stuck workflow
+// ==============================
+
+type TerminateBillRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	Reason string `json:"reason"` // required; recorded on the bill and in Temporal
+}
+
+type TerminateBillResponse struct {
+	BillID string     `json:"bill_id"`
+	Status BillStatus `json:"status"`
+}
+
+// TerminateBill is a last resort for a hung bill workflow: it terminates the
+// execution and, if the bill is still OPEN, voids it so DB and workflow
+// agree. A CLOSED bill keeps its status (it was already charged). Either
+// way the bill's events record a terminated entry.
+//
+//encore:api public method=POST path=/bills/:id/admin/terminate
+func (s *Service) TerminateBill(ctx context.Context, id string, req *TerminateBillRequest) (*TerminateBillResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if req.Reason == "" {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("reason is required").Err()
+	}
+
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		return nil, err
+	}
+
+	err := s.temporalClient.TerminateWorkflow(ctx, workflowIDForBill(id), "", req.Reason)
+	var notFound *serviceerror.NotFound
+	if err != nil && !errors.As(err, &notFound) {
+		return nil, errs.B().Code(errs.Internal).Msg("terminate workflow").Err()
+	}
+
+	voided, err := terminateBillRow(ctx, id, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	billLog(id).Warn("bill workflow terminated by admin",
+		"reason", req.Reason,
+		"voided", voided,
+		"status", status,
+	)
+
+	return &TerminateBillResponse{BillID: id, Status: status}, nil
+}
+
+// ==============================
+// Tenant currency allowlist
+// ==============================
+
+type SetTenantCurrenciesRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+
+	OwnerID string `json:"owner_id"` // "" is the pre-scoping tenant
+
+	// Currencies the tenant may create bills in; empty removes the
+	// allowlist, allowing every supported currency
+	Currencies []Currency `json:"currencies"`
+}
+
+type TenantCurrenciesRequest struct {
+	AdminKey string `header:"X-Admin-Key"`
+	OwnerID  string `query:"owner_id"`
+}
+
+type TenantCurrenciesResponse struct {
+	OwnerID    string     `json:"owner_id"`
+	Currencies []Currency `json:"currencies"` // empty: no allowlist
+}
+
+// SetTenantCurrencies replaces a tenant's currency allowlist. CreateBill
+// checks it on top of the supported set; existing bills are unaffected.
+//
+//encore:api public method=PUT path=/bills/admin/tenant-currencies
+func (s *Service) SetTenantCurrencies(ctx context.Context, req *SetTenantCurrenciesRequest) (*TenantCurrenciesResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if err := setTenantCurrencies(ctx, req.OwnerID, req.Currencies); err != nil {
+		return nil, err
+	}
+	rlog.Info("tenant currencies set", "owner_id", req.OwnerID, "currencies", req.Currencies)
+	return s.TenantCurrencies(ctx, &TenantCurrenciesRequest{AdminKey: req.AdminKey, OwnerID: req.OwnerID})
+}
+
+// TenantCurrencies returns a tenant's currency allowlist.
+//
+//encore:api public method=GET path=/bills/admin/tenant-currencies
+func (s *Service) TenantCurrencies(ctx context.Context, req *TenantCurrenciesRequest) (*TenantCurrenciesResponse, error) {
+	if err := requireAdmin(req.AdminKey); err != nil {
+		return nil, err
+	}
+	allowed, err := tenantCurrencies(ctx, req.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantCurrenciesResponse{OwnerID: req.OwnerID, Currencies: allowed}, nil
+}
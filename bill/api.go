@@ -2,192 +2,2120 @@ package bill
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"encore.dev"
 	"encore.dev/beta/errs"
 	"github.com/google/uuid"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
 )
 
 type CreateBillRequest struct {
 	Currency Currency `json:"currency"`
+
+	// Optional: ceiling on the bill total; adds beyond it are rejected
+	MaxTotalMinor int64 `json:"max_total_minor,omitempty"`
+
+	// Optional: tax rate in basis points (825 = 8.25%), applied at close
+	TaxRateBps int `json:"tax_rate_bps,omitempty"`
+
+	// Optional: auto-close after this many seconds without a new line item
+	AutoCloseAfterSeconds int64 `json:"auto_close_after_seconds,omitempty"`
+
+	// Optional: rounding for tax and percent discounts at close; default
+	// HALF_UP
+	RoundingMode RoundingMode `json:"rounding_mode,omitempty"`
+
+	// Optional: ?wait_for_row=true blocks until the bill row exists
+	WaitForRow bool `query:"wait_for_row"`
+
+	// Optional: retries with the same key return the same bill instead of
+	// creating another one, for IdempotencyKeyTTLSeconds
+	IdempotencyKey string `header:"Idempotency-Key"`
 }
 
 type CreateBillResponse struct {
 	BillID string `json:"bill_id"`
+
+	// Temporal run ID of the bill's workflow, for finding the execution in
+	// the Temporal UI; also stored on the bill as run_id
+	RunID string `json:"run_id"`
+
+	// 201 Created + Location: /bills/{id}
+	Status   int    `encore:"httpstatus" json:"-"`
+	Location string `header:"Location" json:"-"`
 }
 
-//encore:api public method=POST path=/bills
+// CreateBill starts the bill workflow and returns the new bill ID.
+//
+// By default it returns as soon as ExecuteWorkflow succeeds. That is the
+// fastest mode (one Temporal round-trip), but the bill row is inserted
+// asynchronously by CreateBillRowActivity, so an immediate GetBillWithItems
+// may still 404 for a short moment.
+//
+// With ?wait_for_row=true the handler additionally polls the DB until the row
+// exists (bounded by billRowWaitTimeout). This adds the latency of the first
+// workflow task + activity, in exchange for read-your-writes on the new bill.
+//
+// With an Idempotency-Key header the key is mapped to the bill it creates,
+// and Temporal's workflow ID uniqueness collapses retries: a repeat within
+// IdempotencyKeyTTLSeconds returns 200 with the original bill_id (its body
+// is not compared to the first call's); after that it creates a new bill.
+// Without a key, an existing workflow for the generated ID is AlreadyExists.
+// WorkflowIDReusePolicy decides whether a key whose bill's workflow failed
+// starts it afresh or keeps answering with the failed bill.
+//
+//encore:api auth method=POST path=/bills
 func (s *Service) CreateBill(ctx context.Context, req *CreateBillRequest) (*CreateBillResponse, error) {
-	if !req.Currency.Valid() {
-		return nil, errs.B().Code(errs.InvalidArgument).Msg("unsupported currency").Err()
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := limitCaller(); err != nil {
+		return nil, err
+	}
+	allowed, err := tenantCurrencies(ctx, callerOwnerID())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTenantCurrency(allowed, req.Currency); err != nil {
+		return nil, err
 	}
 
 	// Handler generates deterministic-safe ID
 	billID := uuid.New().String()
+	claimed := false
+	if req.IdempotencyKey != "" {
+		billID, claimed, err = claimIdempotencyKey(ctx, callerOwnerID(), req.IdempotencyKey, time.Now(), idempotencyKeyTTL())
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	_, err := s.temporalClient.ExecuteWorkflow(
+	status := http.StatusCreated
+	run, err := s.temporalClient.ExecuteWorkflow(
 		ctx,
 		client.StartWorkflowOptions{
 			ID:        workflowIDForBill(billID),
-			TaskQueue: taskQueueName,
+			TaskQueue: taskQueue(),
+
+			// Surface an existing run as an error instead of silently
+			// returning it, so a repeat is told apart from a new bill
+			WorkflowIDReusePolicy:                    workflowIDReusePolicy(),
+			WorkflowExecutionErrorWhenAlreadyStarted: true,
 		},
 		BillLifecycleWorkflow,
-		BillWorkflowParams{BillID: billID, Currency: req.Currency},
+		BillWorkflowParams{
+			BillID:                    billID,
+			Currency:                  req.Currency,
+			MaxTotalMinor:             req.MaxTotalMinor,
+			TaxRateBps:                req.TaxRateBps,
+			MaxLineItems:              cfg.MaxLineItems,
+			ContinueAsNewAfterSignals: cfg.ContinueAsNewAfterSignals,
+			AutoCloseAfter:            time.Duration(req.AutoCloseAfterSeconds) * time.Second,
+			RoundingMode:              req.RoundingMode,
+			BaseCurrency:              Currency(cfg.BaseCurrency),
+			OwnerID:                   callerOwnerID(),
+		},
 	)
+	var runID string
 	if err != nil {
-		return nil, errs.B().Code(errs.Internal).Msg("start bill workflow").Err()
+		var started *serviceerror.WorkflowExecutionAlreadyStarted
+		if !errors.As(err, &started) {
+			billLog(billID).Error("start bill workflow failed", "err", err)
+			if claimed {
+				releaseIdempotencyKey(ctx, callerOwnerID(), req.IdempotencyKey, billID)
+			}
+			return nil, errs.B().Code(errs.Internal).Msg("start bill workflow").Err()
+		}
+		if req.IdempotencyKey == "" {
+			// A random bill ID collided; never hand out someone else's bill
+			billLog(billID).Error("bill workflow already exists", "run_id", started.RunId)
+			return nil, errs.B().Code(errs.AlreadyExists).Msg("bill already exists; retry").Err()
+		}
+		status = http.StatusOK
+		runID = started.RunId // the run already started for this key
+	} else {
+		runID = run.GetRunID()
+	}
+	billLog(billID).Info("bill workflow started",
+		"currency", req.Currency, "run_id", runID, "idempotent_repeat", status == http.StatusOK)
+
+	if req.WaitForRow {
+		if err := waitForBillRow(ctx, billID); err != nil {
+			return nil, err
+		}
 	}
 
-	return &CreateBillResponse{BillID: billID}, nil
+	return &CreateBillResponse{
+		BillID:   billID,
+		RunID:    runID,
+		Status:   status,
+		Location: billLocation(billID),
+	}, nil
 }
 
 type AddLineItemRequest struct {
 	Description string   `json:"description"`
 	AmountMinor int64    `json:"amount_minor"`
 	Currency    Currency `json:"currency"`
+
+	// Optional: the amount in major units (10.5 USD, 1000 JPY) instead of
+	// amount_minor; converted per the currency's decimal places
+	Amount *float64 `json:"amount,omitempty"`
+
+	// Optional: when set, amount_minor is computed from it and must be omitted
+	Proration *Proration `json:"proration,omitempty"`
+
+	// Optional: a client-chosen UUID for the item. Retrying with the same
+	// one never adds the item twice; the response is the same either way.
+	LineItemID string `json:"line_item_id,omitempty"`
+
+	// Optional: a short label GET /bills/:id?group_by=category totals by
+	Category string `json:"category,omitempty"`
 }
 
 type AddLineItemResponse struct {
 	LineItemID string `json:"line_item_id"`
+
+	// 201 Created + Location: /bills/{id}/line-items/{line_item_id}
+	Status   int    `encore:"httpstatus" json:"-"`
+	Location string `header:"Location" json:"-"`
 }
 
-//encore:api public method=POST path=/bills/:id/line-items
+//encore:api auth method=POST path=/bills/:id/line-items
 func (s *Service) AddLineItem(ctx context.Context, id string, req *AddLineItemRequest) (*AddLineItemResponse, error) {
-	if !req.Currency.Valid() {
-		return nil, errs.B().Code(errs.InvalidArgument).Msg("unsupported currency").Err()
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
 	}
-
-	// ✅ Pre-check status before signaling
+	if err := limitCaller(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	// ✅ Pre-check status before signaling. Right after CreateBill the row
+	// may not exist yet; the workflow then does the checks (signalBill)
 	status, billCurrency, err := getBillStatusAndCurrency(ctx, id)
-	if err != nil {
+	rowMissing := errs.Code(err) == errs.NotFound
+	if err != nil && !rowMissing {
 		return nil, err
 	}
-	if status != StatusOpen {
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is closed").Err()
+	if !rowMissing {
+		if status != StatusOpen {
+			return nil, errBillNotOpen(status)
+		}
+		if billCurrency != req.Currency {
+			return nil, errCurrencyMismatch()
+		}
+		count, err := countUninvoicedLineItems(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkItemLimit(count, 1); err != nil {
+			return nil, err
+		}
 	}
-	if billCurrency != req.Currency {
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("currency mismatch").Err()
+
+	amount := req.AmountMinor
+	if req.Proration != nil {
+		amount = req.Proration.AmountMinor()
+	}
+	if !rowMissing {
+		total, err := uninvoicedTotalMinor(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBillTotalCap(req.Currency, total, amount); err != nil {
+			return nil, err
+		}
 	}
 
-	lineItemID := uuid.New().String()
+	// Validate already accepted them; this applies the same cleanup
+	description, _ := normalizeDescription(req.Description)
+	category, _ := normalizeCategory(req.Category)
+
+	lineItemID, landed, err := resolveLineItemID(ctx, id, req.LineItemID)
+	if err != nil {
+		return nil, err
+	}
+	if landed {
+		// A retry of an add that already landed
+		return &AddLineItemResponse{
+			LineItemID: lineItemID,
+			Status:     http.StatusCreated,
+			Location:   lineItemLocation(id, lineItemID),
+		}, nil
+	}
 
 	sig := AddLineItemSignal{
 		LineItemID:  lineItemID,
-		Description: req.Description,
-		AmountMinor: req.AmountMinor,
+		Description: description,
+		Category:    category,
+		AmountMinor: amount,
 		Currency:    req.Currency,
+		Proration:   req.Proration,
+		OwnerID:     callerOwnerID(),
 	}
 
-	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalAddLineItem, sig); err != nil {
-		// Optional fallback mapping if workflow already finished unexpectedly
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is closed").Err()
+	if err := s.signalBill(ctx, id, !rowMissing, signalAddLineItem, sig); err != nil {
+		billLog(id).Warn("add line item signal failed", "line_item_id", lineItemID, "err", err)
+		return nil, err
 	}
+	billLog(id).Info("line item add signalled", "line_item_id", lineItemID, "amount_minor", amount)
 
-	return &AddLineItemResponse{LineItemID: lineItemID}, nil
+	return &AddLineItemResponse{
+		LineItemID: lineItemID,
+		Status:     http.StatusCreated,
+		Location:   lineItemLocation(id, lineItemID),
+	}, nil
 }
 
-type CloseBillResponse struct {
-	AmountMinor int64         `json:"amount_minor"`
-	Items       []LineItemDTO `json:"items"`
+// signalBill signals a bill's workflow. When no run is open but the bill
+// row is (rowOpen: an import that never started one, say), it starts one
+// seeded from the DB and delivers the signal atomically with
+// SignalWithStartWorkflow. A bill whose run already finished is never
+// restarted: the reuse policy rejects starting over it. Without a row the
+// workflow must already be running; it checks currency and limits itself.
+func (s *Service) signalBill(ctx context.Context, billID string, rowOpen bool, signalName string, arg interface{}) error {
+	err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(billID), "", signalName, arg)
+	var notFound *serviceerror.NotFound
+	switch {
+	case err == nil:
+		return nil
+	case !errors.As(err, &notFound):
+		return errs.B().Code(errs.Unavailable).Msg("signal bill workflow").Err()
+	case !rowOpen:
+		return errBillNotFound()
+	}
+
+	params, err := billWorkflowParamsFromDB(ctx, billID)
+	if err != nil {
+		return err
+	}
+	_, err = s.temporalClient.SignalWithStartWorkflow(ctx, workflowIDForBill(billID), signalName, arg,
+		client.StartWorkflowOptions{
+			ID:                    workflowIDForBill(billID),
+			TaskQueue:             taskQueue(),
+			WorkflowIDReusePolicy: workflowIDReusePolicy(),
+		},
+		BillLifecycleWorkflow,
+		*params,
+	)
+	if err != nil {
+		var started *serviceerror.WorkflowExecutionAlreadyStarted
+		if errors.As(err, &started) {
+			// Its run finished after our status check
+			return errBillClosed()
+		}
+		return errs.B().Code(errs.Unavailable).Msg("signal bill workflow").Err()
+	}
+	billLog(billID).Info("bill workflow started by signal", "signal", signalName)
+	return nil
 }
 
-//encore:api public method=POST path=/bills/:id/close
-func (s *Service) CloseBill(ctx context.Context, id string) (*CloseBillResponse, error) {
+// billWorkflowParamsFromDB rebuilds start params for an OPEN bill from its
+// row, seeding the running state with the items, discounts and invoices
+// already stored. Limits not kept on the row (MaxTotalMinor,
+// AutoCloseAfter) are off.
+func billWorkflowParamsFromDB(ctx context.Context, billID string) (*BillWorkflowParams, error) {
+	b, err := getBillSummary(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := listUninvoicedLineItems(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	discounts, err := listDiscounts(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := listInvoices(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	initial := &BillResult{
+		BillID:    billID,
+		Currency:  b.Currency,
+		Items:     make([]LineItem, 0, len(items)),
+		Discounts: discounts,
+	}
+	for _, li := range items {
+		initial.TotalMinor += li.AmountMinor
+		initial.Items = append(initial.Items, *li)
+	}
+	for _, inv := range invoices {
+		initial.InvoicedMinor += inv.TotalMinor
+	}
+
+	return &BillWorkflowParams{
+		BillID:                    billID,
+		Currency:                  b.Currency,
+		Initial:                   initial,
+		TaxRateBps:                b.TaxRateBps,
+		RoundingMode:              b.RoundingMode,
+		MaxLineItems:              cfg.MaxLineItems,
+		ContinueAsNewAfterSignals: cfg.ContinueAsNewAfterSignals,
+		BaseCurrency:              Currency(cfg.BaseCurrency),
+		OwnerID:                   b.OwnerID,
+	}, nil
+}
+
+// resolveLineItemID returns the ID for a new item: requested if the client
+// chose one, else a fresh UUID. landed reports that an item with the
+// requested ID is already on the bill, i.e. the call is a retry.
+func resolveLineItemID(ctx context.Context, billID, requested string) (lineItemID string, landed bool, err error) {
+	if requested == "" {
+		return uuid.New().String(), false, nil
+	}
+	owner, err := lineItemBillID(ctx, requested)
+	if err != nil {
+		return "", false, err
+	}
+	switch owner {
+	case "":
+		return requested, false, nil
+	case billID:
+		return requested, true, nil
+	default:
+		return "", false, errs.B().Code(errs.AlreadyExists).Msg("line item id already used").Err()
+	}
+}
+
+type AddCreditRequest struct {
+	Description string   `json:"description"`
+	AmountMinor int64    `json:"amount_minor"` // negative, e.g. -500 refunds 5.00
+	Currency    Currency `json:"currency"`
+	Amount      *float64 `json:"amount,omitempty"` // or in major units, e.g. -5
+
+	// Optional: client-chosen UUID, as for line items
+	LineItemID string `json:"line_item_id,omitempty"`
+}
+
+// AddCredit adds a refund or adjustment: a line item with a negative
+// amount. The bill's running total may not go below zero, so a credit
+// larger than the items not yet invoiced is refused with FailedPrecondition.
+// The workflow re-checks this against its own total and records a refusal
+// (CREDIT_OVERDRAW) in GET /bills/:id/workflow-status.
+//
+//encore:api auth method=POST path=/bills/:id/credits
+func (s *Service) AddCredit(ctx context.Context, id string, req *AddCreditRequest) (*AddLineItemResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
 	// ✅ Pre-check status before signaling
-	status, _, err := getBillStatusAndCurrency(ctx, id)
+	status, billCurrency, err := getBillStatusAndCurrency(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if status != StatusOpen {
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is closed").Err()
+		return nil, errBillNotOpen(status)
 	}
-
-	// Signal workflow to close
-	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalCloseBill, CloseBillSignal{}); err != nil {
-		// If the workflow is already completed/missing, align with business semantics
-		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is closed").Err()
+	if billCurrency != req.Currency {
+		return nil, errCurrencyMismatch()
+	}
+	count, err := countUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkItemLimit(count, 1); err != nil {
+		return nil, err
+	}
+	total, err := uninvoicedTotalMinor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if total+req.AmountMinor < 0 {
+		return nil, reasonErr(errs.FailedPrecondition, ReasonCreditOverdraw, "credit exceeds the bill's total")
 	}
 
-	// Wait for workflow result
-	run := s.temporalClient.GetWorkflow(ctx, workflowIDForBill(id), "")
-	var result BillResult
-	if err := run.Get(ctx, &result); err != nil {
-		return nil, errs.B().Code(errs.Internal).Msg("get workflow result").Err()
+	lineItemID, landed, err := resolveLineItemID(ctx, id, req.LineItemID)
+	if err != nil {
+		return nil, err
+	}
+	if !landed {
+		description, _ := normalizeDescription(req.Description) // accepted by Validate
+		sig := AddLineItemSignal{
+			LineItemID:  lineItemID,
+			Description: description,
+			AmountMinor: req.AmountMinor,
+			Currency:    req.Currency,
+			Credit:      true,
+			OwnerID:     callerOwnerID(),
+		}
+		// The status check above saw the row OPEN
+		if err := s.signalBill(ctx, id, true, signalAddLineItem, sig); err != nil {
+			billLog(id).Warn("add credit signal failed", "line_item_id", lineItemID, "err", err)
+			return nil, err
+		}
+		billLog(id).Info("credit add signalled", "line_item_id", lineItemID, "amount_minor", req.AmountMinor)
 	}
 
-	// Indicate all line items being charged
-	_, items, err := getBillWithItemsJoin(ctx, id)
+	return &AddLineItemResponse{
+		LineItemID: lineItemID,
+		Status:     http.StatusCreated,
+		Location:   lineItemLocation(id, lineItemID),
+	}, nil
+}
+
+type BatchAddLineItemsRequest struct {
+	Currency Currency             `json:"currency"`
+	Items    []BatchLineItemInput `json:"items"`
+}
+
+type BatchLineItemInput struct {
+	Description string   `json:"description"`
+	AmountMinor int64    `json:"amount_minor"`
+	Amount      *float64 `json:"amount,omitempty"` // or in major units
+	Category    string   `json:"category,omitempty"`
+}
+
+type BatchAddLineItemsResponse struct {
+	LineItemIDs []string `json:"line_item_ids"` // in request order
+
+	// 201 Created
+	Status int `encore:"httpstatus" json:"-"`
+}
+
+// BatchAddLineItems validates every item up front and sends them to the
+// workflow in one signal; they are inserted together or not at all.
+//
+//encore:api auth method=POST path=/bills/:id/line-items/batch
+func (s *Service) BatchAddLineItems(ctx context.Context, id string, req *BatchAddLineItemsRequest) (*BatchAddLineItemsResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	// ✅ Pre-check status before signaling
+	status, billCurrency, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
+	if billCurrency != req.Currency {
+		return nil, errCurrencyMismatch()
+	}
+	count, err := countUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkItemLimit(count, len(req.Items)); err != nil {
+		return nil, err
+	}
+	total, err := uninvoicedTotalMinor(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	var batchTotal int64 // Validate ruled out overflow
+	for _, it := range req.Items {
+		batchTotal += it.AmountMinor
+	}
+	if err := checkBillTotalCap(req.Currency, total, batchTotal); err != nil {
+		return nil, err
+	}
 
-	return &CloseBillResponse{
-		AmountMinor: result.TotalMinor,
-		Items:       lineItemsToDTOs(items),
+	sig := BatchAddLineItemsSignal{
+		Currency: req.Currency,
+		Items:    make([]BatchLineItem, len(req.Items)),
+	}
+	ids := make([]string, len(req.Items))
+	for i, it := range req.Items {
+		description, _ := normalizeDescription(it.Description) // accepted by Validate
+		category, _ := normalizeCategory(it.Category)
+		ids[i] = uuid.New().String()
+		sig.Items[i] = BatchLineItem{
+			LineItemID:  ids[i],
+			Description: description,
+			Category:    category,
+			AmountMinor: it.AmountMinor,
+		}
+	}
+	// Reject here rather than let Temporal fail the signal (or the worker
+	// the activity) obscurely; splitting would break all-or-nothing
+	if err := checkSignalPayload(sig); err != nil {
+		return nil, err
+	}
+
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalBatchAddItems, sig); err != nil {
+		billLog(id).Warn("batch add signal failed", "count", len(ids), "err", err)
+		return nil, errBillClosed()
+	}
+	billLog(id).Info("line item batch signalled", "count", len(ids))
+
+	return &BatchAddLineItemsResponse{
+		LineItemIDs: ids,
+		Status:      http.StatusCreated,
 	}, nil
 }
 
-// Encore GET query rule: no *string
-type ListBillsRequest struct {
-	Status string `query:"status"` // optional: ?status=OPEN or ?status=CLOSED
+// UpdateLineItemRequest is a JSON merge patch (RFC 7396) of the item:
+// omitted fields are left unchanged. Neither field can be removed, so
+// null is treated as omitted; a patch that sets neither is rejected.
+type UpdateLineItemRequest struct {
+	Description *string `json:"description,omitempty"`
+	AmountMinor *int64  `json:"amount_minor,omitempty"`
 }
 
-type ListBillsWithItemsResponse struct {
-	Bills []BillWithItemsDTO `json:"bills"`
+// UpdateLineItem signals the workflow to edit an item; the running total
+// moves by the amount delta. Fields equal to the stored values are dropped
+// from the patch, so resending a stale full object changes nothing, and a
+// patch left empty succeeds without signalling.
+//
+//encore:api auth method=PATCH path=/bills/:id/line-items/:lineItemID
+func (s *Service) UpdateLineItem(ctx context.Context, id string, lineItemID string, req *UpdateLineItemRequest) error {
+	if err := s.requireTemporal(); err != nil {
+		return err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return err
+	}
+	// ✅ Pre-check status before signaling
+	status, currency, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status != StatusOpen {
+		return errBillNotOpen(status)
+	}
+
+	current, err := editableLineItem(ctx, id, lineItemID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return errs.B().Code(errs.NotFound).Msg("line item not found").Err()
+	}
+
+	if req.Description != nil {
+		description, _ := normalizeDescription(*req.Description) // accepted by Validate
+		req.Description = &description
+		if description == current.Description {
+			req.Description = nil
+		}
+	}
+	if req.AmountMinor != nil && *req.AmountMinor == current.AmountMinor {
+		req.AmountMinor = nil
+	}
+	if req.Description == nil && req.AmountMinor == nil {
+		billLog(id).Info("line item update is a no-op", "line_item_id", lineItemID)
+		return nil
+	}
+
+	if req.AmountMinor != nil {
+		total, err := uninvoicedTotalMinor(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkLineItemUpdate(currency, total, current.AmountMinor, *req.AmountMinor); err != nil {
+			return err
+		}
+	}
+
+	sig := UpdateLineItemSignal{
+		LineItemID:  lineItemID,
+		Description: req.Description,
+		AmountMinor: req.AmountMinor,
+	}
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalUpdateLineItem, sig); err != nil {
+		billLog(id).Warn("update line item signal failed", "line_item_id", lineItemID, "err", err)
+		return errBillClosed()
+	}
+	billLog(id).Info("line item update signalled", "line_item_id", lineItemID)
+
+	return nil
 }
 
-type BillWithItemsDTO struct {
-	Bill  BillDTO       `json:"bill"`
-	Items []LineItemDTO `json:"items"`
+type RemoveLineItemRequest struct {
+	// Optional: treat an item that is already gone (or never existed) as
+	// removed, so a client can retry a removal safely
+	Idempotent bool `query:"idempotent"`
 }
 
-// ==============================
-// Public API
-// ==============================
+// RemoveLineItem signals the workflow to delete an item and subtract its
+// amount from the running total.
+//
+//encore:api auth method=DELETE path=/bills/:id/line-items/:lineItemID
+func (s *Service) RemoveLineItem(ctx context.Context, id string, lineItemID string, req *RemoveLineItemRequest) error {
+	if err := s.requireTemporal(); err != nil {
+		return err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return err
+	}
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status != StatusOpen {
+		return errBillNotOpen(status)
+	}
 
-//encore:api public method=GET path=/bills
-func (s *Service) ListBillsWithItems(ctx context.Context, req *ListBillsRequest) (*ListBillsWithItemsResponse, error) {
-	var st *BillStatus
-	if req != nil && req.Status != "" {
-		tmp := BillStatus(req.Status)
-		switch tmp {
-		case StatusOpen, StatusClosed:
-			st = &tmp
-		default:
-			return nil, errs.B().Code(errs.InvalidArgument).Msg("invalid status").Err()
+	exists, err := lineItemExists(ctx, id, lineItemID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if req.Idempotent {
+			billLog(id).Info("line item already removed", "line_item_id", lineItemID)
+			return nil
 		}
+		return errs.B().Code(errs.NotFound).Msg("line item not found").Err()
+	}
+
+	sig := RemoveLineItemSignal{LineItemID: lineItemID}
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalRemoveLineItem, sig); err != nil {
+		billLog(id).Warn("remove line item signal failed", "line_item_id", lineItemID, "err", err)
+		return errBillClosed()
 	}
+	billLog(id).Info("line item removal signalled", "line_item_id", lineItemID)
+
+	return nil
+}
+
+type ApplyDiscountRequest struct {
+	Type  DiscountType `json:"type"`  // PERCENT or FIXED
+	Value int64        `json:"value"` // whole percent (1..100) or minor units
+}
+
+type ApplyDiscountResponse struct {
+	DiscountID string `json:"discount_id"`
+
+	// 201 Created
+	Status int `encore:"httpstatus" json:"-"`
+}
 
-	bills, itemsByBill, err := listBillsWithItemsJoin(ctx, st)
+// ApplyDiscount signals the workflow to record a discount. Discounts are
+// taken off the item sum at close.
+//
+//encore:api auth method=POST path=/bills/:id/discount
+func (s *Service) ApplyDiscount(ctx context.Context, id string, req *ApplyDiscountRequest) (*ApplyDiscountResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
 
-	out := make([]BillWithItemsDTO, 0, len(bills))
-	for _, b := range bills {
-		out = append(out, BillWithItemsDTO{
-			Bill:  billToDTO(b),
-			Items: lineItemsToDTOs(itemsByBill[b.ID]),
-		})
+	discountID := uuid.New().String()
+
+	sig := ApplyDiscountSignal{
+		DiscountID: discountID,
+		Type:       req.Type,
+		Value:      req.Value,
+	}
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalApplyDiscount, sig); err != nil {
+		billLog(id).Warn("apply discount signal failed", "discount_id", discountID, "err", err)
+		return nil, errBillClosed()
 	}
+	billLog(id).Info("discount signalled", "discount_id", discountID)
 
-	return &ListBillsWithItemsResponse{Bills: out}, nil
+	return &ApplyDiscountResponse{
+		DiscountID: discountID,
+		Status:     http.StatusCreated,
+	}, nil
 }
 
-type GetBillWithItemsResponse struct {
-	Bill  BillDTO       `json:"bill"`
-	Items []LineItemDTO `json:"items"`
+type SetCurrencyRequest struct {
+	Currency Currency `json:"currency"`
 }
 
-//encore:api public method=GET path=/bills/:id
-func (s *Service) GetBillWithItems(ctx context.Context, id string) (*GetBillWithItemsResponse, error) {
-	b, items, err := getBillWithItemsJoin(ctx, id)
+type SetCurrencyResponse struct {
+	BillID   string   `json:"bill_id"`
+	Currency Currency `json:"currency"`
+}
+
+// SetCurrency fixes the currency of a bill created with the wrong one. Only
+// allowed while the bill is OPEN and has no line items (or fixed discounts).
+// Returns once the new currency is stored, so adds sent afterwards pass the
+// currency check.
+//
+//encore:api auth method=POST path=/bills/:id/currency
+func (s *Service) SetCurrency(ctx context.Context, id string, req *SetCurrencyRequest) (*SetCurrencyResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-
-	return &GetBillWithItemsResponse{
-		Bill:  billToDTO(b),
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
+	n, err := countLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, reasonErr(errs.FailedPrecondition, ReasonCurrencyLocked, "bill has line items; currency is locked")
+	}
+	discounts, err := listDiscounts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range discounts {
+		if d.Type == DiscountFixed {
+			return nil, reasonErr(errs.FailedPrecondition, ReasonCurrencyLocked, "bill has fixed discounts; currency is locked")
+		}
+	}
+
+	sig := SetCurrencySignal{Currency: req.Currency}
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalSetCurrency, sig); err != nil {
+		billLog(id).Warn("set currency signal failed", "currency", req.Currency, "err", err)
+		return nil, errBillClosed()
+	}
+	if err := waitForBillCurrency(ctx, id, req.Currency); err != nil {
+		return nil, err
+	}
+
+	billLog(id).Info("bill currency changed", "currency", req.Currency)
+	return &SetCurrencyResponse{BillID: id, Currency: req.Currency}, nil
+}
+
+type SetMemoRequest struct {
+	Memo string `json:"memo"` // empty clears it
+}
+
+type SetMemoResponse struct {
+	BillID string `json:"bill_id"`
+	Memo   string `json:"memo"`
+}
+
+// SetMemo replaces the free-text note on an OPEN bill (PO number, internal
+// reference); an empty memo clears it. The memo is frozen once the bill
+// closes. Returns once the memo is stored.
+//
+//encore:api auth method=PUT path=/bills/:id/memo
+func (s *Service) SetMemo(ctx context.Context, id string, req *SetMemoRequest) (*SetMemoResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	memo, _ := normalizeMemo(req.Memo) // accepted by Validate
+
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
+
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalSetMemo, SetMemoSignal{Memo: memo}); err != nil {
+		billLog(id).Warn("set memo signal failed", "err", err)
+		return nil, errBillClosed()
+	}
+	if err := waitForBillMemo(ctx, id, memo); err != nil {
+		return nil, err
+	}
+
+	billLog(id).Info("bill memo changed", "memo_length", len(memo))
+	return &SetMemoResponse{BillID: id, Memo: memo}, nil
+}
+
+type IssueInvoiceResponse struct {
+	Invoice InvoiceDTO `json:"invoice"`
+}
+
+// IssueInvoice charges an OPEN bill's items so far without closing it: they
+// are frozen on an immutable invoice and the bill's running total restarts
+// from zero. Later adds land on the next invoice or the final close.
+//
+//encore:api auth method=POST path=/bills/:id/invoice
+func (s *Service) IssueInvoice(ctx context.Context, id string) (*IssueInvoiceResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
+	n, err := countUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errs.B().Code(errs.FailedPrecondition).Msg("no line items to invoice").Err()
+	}
+
+	invoiceID := uuid.New().String()
+	log := billLog(id).With("invoice_id", invoiceID)
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalIssueInvoice, IssueInvoiceSignal{InvoiceID: invoiceID}); err != nil {
+		log.Warn("invoice signal failed", "err", err)
+		return nil, errBillClosed()
+	}
+	inv, err := waitForInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("invoice issued", "total_minor", inv.TotalMinor)
+	return &IssueInvoiceResponse{Invoice: invoiceToDTO(inv)}, nil
+}
+
+type ListInvoicesResponse struct {
+	Invoices      []InvoiceDTO `json:"invoices"`
+	InvoicedMinor int64        `json:"invoiced_minor"` // sum of the invoices
+}
+
+//encore:api auth method=GET path=/bills/:id/invoices
+func (s *Service) ListInvoices(ctx context.Context, id string) (*ListInvoicesResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		return nil, err
+	}
+	invoices, err := listInvoices(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListInvoicesResponse{Invoices: make([]InvoiceDTO, 0, len(invoices))}
+	for _, inv := range invoices {
+		resp.Invoices = append(resp.Invoices, invoiceToDTO(inv))
+		resp.InvoicedMinor += inv.TotalMinor
+	}
+	return resp, nil
+}
+
+type CloseBillResponse struct {
+	AmountMinor int64         `json:"amount_minor"` // same as total_minor
+	Items       []LineItemDTO `json:"items"`
+
+	SubtotalMinor int64 `json:"subtotal_minor"` // sum of items
+	DiscountMinor int64 `json:"discount_minor"`
+	TaxMinor      int64 `json:"tax_minor"`
+	TotalMinor    int64 `json:"total_minor"` // charged: subtotal - discount + tax
+
+	// Total in the configured base currency; omitted when conversion is off
+	Base *BaseTotalDTO `json:"base,omitempty"`
+
+	// Set when the bill was already closed (earlier, or by a concurrent
+	// call): the figures are its final ones and this call charged nothing
+	AlreadyClosed bool `json:"already_closed,omitempty"`
+}
+
+type BaseTotalDTO struct {
+	BaseCurrency   Currency `json:"base_currency"`
+	BaseTotalMinor int64    `json:"base_total_minor"`
+	Rate           string   `json:"rate"` // base units per bill unit, e.g. "1.080000"
+}
+
+func baseTotalToDTO(c Currency, totalMinor, ratePPM int64) *BaseTotalDTO {
+	if c == "" {
+		return nil
+	}
+	return &BaseTotalDTO{BaseCurrency: c, BaseTotalMinor: totalMinor, Rate: formatFXRate(ratePPM)}
+}
+
+// CloseBill charges an OPEN bill and returns its final figures. Closing is
+// idempotent: on a bill that is already CLOSED (a retry, or a concurrent
+// close that won) it succeeds with the stored figures and already_closed
+// set. A VOID bill was never charged and stays FailedPrecondition.
+//
+//encore:api auth method=POST path=/bills/:id/close
+func (s *Service) CloseBill(ctx context.Context, id string) (*CloseBillResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if !s.beginCloseWait() {
+		return nil, errs.B().Code(errs.Unavailable).Msg("service shutting down, retry").Err()
+	}
+	defer s.closeWaits.Done()
+
+	// ✅ Pre-check status before signaling. A CLOSED bill is answered from
+	// the DB alone: its run may be long gone from Temporal (retention)
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch status {
+	case StatusOpen:
+	case StatusClosed:
+		return closedBillFromDB(ctx, id, true)
+	default:
+		return nil, errBillNotOpen(status)
+	}
+
+	// Signal workflow to close. Concurrent calls may both get here; the
+	// workflow keeps the first signal and reports its RequestID. An OPEN
+	// bill without a running workflow gets one started (signalBill).
+	requestID := uuid.New().String()
+	log := billLog(id).With("close_request_id", requestID)
+	signalled := time.Now()
+	if err := s.signalBill(ctx, id, true, signalCloseBill, CloseBillSignal{RequestID: requestID}); err != nil {
+		log.Warn("close signal failed", "err", err)
+		if errs.Code(err) == errs.Unavailable {
+			return nil, err
+		}
+		// The run finished after the status check: another call closed
+		// (or voided) it first
+		return closeLost(ctx, id)
+	}
+
+	// Wait for workflow result
+	run := s.temporalClient.GetWorkflow(ctx, workflowIDForBill(id), "")
+	var result BillResult
+	if err := run.Get(ctx, &result); err != nil {
+		// The close may still have landed; report it from the DB if so
+		log.Error("get workflow result failed", "err", err)
+		return closedBillFromDB(ctx, id, false)
+	}
+	if result.Voided || result.CloseRequestID != requestID {
+		log.Info("close lost to a concurrent close or void")
+		return closeLost(ctx, id)
+	}
+	observeCloseLatency(time.Since(signalled))
+	log.Info("bill closed", "total_minor", result.TotalMinor, "latency_ms", time.Since(signalled).Milliseconds())
+
+	// Indicate the line items being charged (invoices charged the rest)
+	items, err := listUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloseBillResponse{
+		AmountMinor:   result.TotalMinor,
+		Items:         lineItemsToDTOs(items),
+		SubtotalMinor: result.SubtotalMinor,
+		DiscountMinor: result.DiscountMinor,
+		TaxMinor:      result.TaxMinor,
+		TotalMinor:    result.TotalMinor,
+		Base:          baseTotalToDTO(result.BaseCurrency, result.BaseTotalMinor, result.FXRatePPM),
+	}, nil
+}
+
+// PreviewClose computes what CloseBill would charge right now — items not
+// yet invoiced, less discounts, plus tax, and the base-currency total —
+// from the DB with the same math the workflow uses. It is read-only: no
+// signal is sent and the bill stays open. A CLOSED bill returns its final
+// figures.
+//
+//encore:api auth method=GET path=/bills/:id/preview-close
+func (s *Service) PreviewClose(ctx context.Context, id string) (*CloseBillResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch b.Status {
+	case StatusClosed:
+		return closedBillFromDB(ctx, id, true)
+	case StatusOpen:
+	default:
+		return nil, errBillNotOpen(b.Status)
+	}
+
+	items, err := listUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	discounts, err := listDiscounts(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var subtotal int64
+	for _, li := range items {
+		subtotal += li.AmountMinor
+	}
+	discount, tax, total, err := billTotals(subtotal, discounts, b.TaxRateBps, b.RoundingMode)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &CloseBillResponse{
+		AmountMinor:   total,
+		Items:         lineItemsToDTOs(items),
+		SubtotalMinor: subtotal,
+		DiscountMinor: discount,
+		TaxMinor:      tax,
+		TotalMinor:    total,
+	}
+	if base := Currency(cfg.BaseCurrency); base != "" {
+		rate, err := fxRate(b.Currency, base)
+		if err != nil {
+			return nil, err
+		}
+		baseTotal, err := convertMinor(total, b.Currency, base, rate)
+		if err != nil {
+			return nil, err
+		}
+		out.Base = baseTotalToDTO(base, baseTotal, rate)
+	}
+	return out, nil
+}
+
+// closeLost answers a CloseBill that lost a race, so charged nothing: a
+// concurrent close makes it an idempotent success, a void an error.
+func closeLost(ctx context.Context, id string) (*CloseBillResponse, error) {
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusClosed {
+		return nil, errBillNotOpen(status)
+	}
+	return closedBillFromDB(ctx, id, true)
+}
+
+// closedBillFromDB answers CloseBill from the stored totals: for a bill
+// that was already closed, or when the workflow result can't be read but
+// the bill did close.
+func closedBillFromDB(ctx context.Context, id string, alreadyClosed bool) (*CloseBillResponse, error) {
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != StatusClosed {
+		return nil, errs.B().Code(errs.Internal).Msg("get workflow result").Err()
+	}
+	items, err := listUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloseBillResponse{
+		AmountMinor:   b.TotalMinor,
+		Items:         lineItemsToDTOs(items),
+		SubtotalMinor: b.SubtotalMinor,
+		DiscountMinor: b.DiscountMinor,
+		TaxMinor:      b.TaxMinor,
+		TotalMinor:    b.TotalMinor,
+		Base:          baseTotalToDTO(b.BaseCurrency, b.BaseTotalMinor, b.FXRatePPM),
+		AlreadyClosed: alreadyClosed,
+	}, nil
+}
+
+type VoidBillRequest struct {
+	Reason string `json:"reason,omitempty"` // optional; stored on the bill
+}
+
+type VoidBillResponse struct {
+	BillID string     `json:"bill_id"`
+	Status BillStatus `json:"status"`
+}
+
+// VoidBill cancels an OPEN bill: the workflow ends without a charge and the
+// row becomes VOID. Closed bills were already charged and cannot be voided.
+//
+//encore:api auth method=POST path=/bills/:id/void
+func (s *Service) VoidBill(ctx context.Context, id string, req *VoidBillRequest) (*VoidBillResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if !s.beginCloseWait() {
+		return nil, errs.B().Code(errs.Unavailable).Msg("service shutting down, retry").Err()
+	}
+	defer s.closeWaits.Done()
+
+	// ✅ Pre-check status before signaling
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusOpen {
+		return nil, errBillNotOpen(status)
+	}
+
+	if err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalVoidBill, VoidBillSignal{Reason: req.Reason}); err != nil {
+		billLog(id).Warn("void signal failed", "err", err)
+		return nil, errBillClosed()
+	}
+
+	// Wait for the workflow to finish, like close; a close signal that won
+	// the race ends it CLOSED instead
+	run := s.temporalClient.GetWorkflow(ctx, workflowIDForBill(id), "")
+	var result BillResult
+	if err := run.Get(ctx, &result); err != nil {
+		billLog(id).Error("get workflow result failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("get workflow result").Err()
+	}
+	if !result.Voided {
+		return nil, errBillClosed()
+	}
+	billLog(id).Info("bill voided")
+
+	return &VoidBillResponse{BillID: id, Status: StatusVoid}, nil
+}
+
+// DeleteBill soft-deletes a bill (test data, deletion requests): it drops
+// out of every read path but its rows stay for audit. An open bill is voided
+// as well. Its workflow is signalled to do this and end, rather than
+// terminated, so an activity in flight isn't cut off mid-write.
+//
+//encore:api auth method=DELETE path=/bills/:id
+func (s *Service) DeleteBill(ctx context.Context, id string) error {
+	if err := s.requireTemporal(); err != nil {
+		return err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return err
+	}
+	if !s.beginCloseWait() {
+		return errs.B().Code(errs.Unavailable).Msg("service shutting down, retry").Err()
+	}
+	defer s.closeWaits.Done()
+
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if status == StatusOpen {
+		err := s.temporalClient.SignalWorkflow(ctx, workflowIDForBill(id), "", signalDeleteBill, DeleteBillSignal{})
+		if err == nil {
+			run := s.temporalClient.GetWorkflow(ctx, workflowIDForBill(id), "")
+			var result BillResult
+			if err := run.Get(ctx, &result); err == nil && result.Deleted {
+				billLog(id).Info("bill deleted")
+				return nil
+			}
+		}
+		// Workflow gone, or a close/void won the race: delete the row here
+	}
+
+	if _, err := softDeleteBillRow(ctx, id); err != nil {
+		billLog(id).Error("delete bill failed", "err", err)
+		return err
+	}
+	billLog(id).Info("bill deleted")
+	return nil
+}
+
+// Encore GET query rule: no *string
+type ListBillsRequest struct {
+	Status   string `query:"status"`   // optional: ?status=OPEN|CLOSED|VOID; empty lists all but VOID
+	Currency string `query:"currency"` // optional: ?currency=USD; empty means all
+
+	// Optional RFC3339 bounds on created_at: inclusive after, exclusive before
+	CreatedAfter  string `query:"created_after"`
+	CreatedBefore string `query:"created_before"`
+
+	// Optional: only bills with a line item whose description contains
+	// this, case-insensitively (e.g. "refund" or a PO number)
+	Search string `query:"search"`
+
+	Shape  string `query:"shape"` // optional: nested (default) or flat
+	Limit  int    `query:"limit"` // bills per page; default cfg.DefaultPageLimit
+	Offset int    `query:"offset"`
+	Cursor string `query:"cursor"` // next_cursor from a previous page; excludes offset
+
+	// Optional: created_at (default) | total | closed_at, and asc | desc
+	// (default). Open bills have no closed_at and sort last. Cursors only
+	// work with the default sort; page other orders with offset.
+	SortBy  string `query:"sort_by"`
+	SortDir string `query:"sort_dir"`
+
+	// Optional: ?include_deleted=true also lists soft-deleted bills; admin
+	// only (X-Admin-Key)
+	IncludeDeleted bool   `query:"include_deleted"`
+	AdminKey       string `header:"X-Admin-Key"`
+
+	// Optional: ?locale=de-DE groups each total's display string the way
+	// that locale does; default (and unknown locales) en-US
+	Locale string `query:"locale"`
+}
+
+const (
+	shapeNested = "nested"
+	shapeFlat   = "flat"
+)
+
+type ListBillsWithItemsResponse struct {
+	Bills []BillWithItemsDTO `json:"bills"`
+
+	// Only with ?shape=flat: every bill's items in one array (referencing
+	// bill_id), and each bill's own items is null.
+	Items []LineItemDTO `json:"items,omitempty"`
+
+	Total      int    `json:"total"` // matching bills across all pages
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"` // set while has_more
+}
+
+type BillWithItemsDTO struct {
+	Bill      BillDTO       `json:"bill"`
+	ItemCount int           `json:"item_count"` // total, even when items is a preview
+	Items     []LineItemDTO `json:"items"`
+}
+
+// ==============================
+// Public API
+// ==============================
+
+// ListBillsWithItems lists bills newest first unless sort_by / sort_dir
+// say otherwise. created_after / created_before
+// select the half-open period [created_after, created_before), so adjacent
+// billing periods never share a bill.
+//
+//encore:api auth method=GET path=/bills
+func (s *Service) ListBillsWithItems(ctx context.Context, req *ListBillsRequest) (*ListBillsWithItemsResponse, error) {
+	f := billFilter{OwnerID: callerOwnerID()}
+	if req.IncludeDeleted {
+		if err := requireAdmin(req.AdminKey); err != nil {
+			return nil, err
+		}
+		f.IncludeDeleted = true
+	}
+	if req.Status != "" {
+		st := BillStatus(req.Status)
+		f.Status = &st
+	}
+	if req.Currency != "" {
+		cur := Currency(req.Currency)
+		f.Currency = &cur
+	}
+	f.Search = strings.TrimSpace(req.Search)
+
+	var err error
+	if f.CreatedAfter, err = parseTimeParam("created_after", req.CreatedAfter); err != nil {
+		return nil, err
+	}
+	if f.CreatedBefore, err = parseTimeParam("created_before", req.CreatedBefore); err != nil {
+		return nil, err
+	}
+	if f.CreatedAfter != nil && f.CreatedBefore != nil && !f.CreatedBefore.After(*f.CreatedAfter) {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("created_before must be after created_after").Err()
+	}
+
+	flat := req.Shape == shapeFlat
+	sort := billSort{By: req.SortBy, Dir: req.SortDir}
+
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keyset cursor is stable under concurrent creates; offset is kept for
+	// callers that jump to a page.
+	var after *pageCursor
+	if req.Cursor != "" {
+		if after, err = decodeCursor(req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// List views only get a preview of each bill's items; use
+	// GET /bills/:id for the full list. One extra bill tells us has_more.
+	bills, itemsByBill, err := listBillsWithItemsJoin(ctx, f, sort, after, limit+1, req.Offset, cfg.ListItemPreviewLimit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := countBills(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &ListBillsWithItemsResponse{
+		Total:   total,
+		HasMore: len(bills) > limit,
+	}
+	if resp.HasMore {
+		bills = bills[:limit]
+		if sort.isDefault() {
+			last := bills[limit-1]
+			resp.NextCursor = encodeCursor(pageCursor{Time: last.CreatedAt, ID: last.ID})
+		}
+	}
+	resp.Bills = make([]BillWithItemsDTO, 0, len(bills))
+	if flat {
+		resp.Items = []LineItemDTO{}
+	}
+	for _, b := range bills {
+		dto := BillWithItemsDTO{
+			Bill:      billToDTO(b, req.Locale),
+			ItemCount: b.ItemCount,
+		}
+		if flat {
+			resp.Items = append(resp.Items, lineItemsToDTOs(itemsByBill[b.ID])...)
+		} else {
+			dto.Items = lineItemsToDTOs(itemsByBill[b.ID])
+		}
+		resp.Bills = append(resp.Bills, dto)
+	}
+
+	return resp, nil
+}
+
+type BatchGetBillsRequest struct {
+	IDs []string `json:"ids"`
+
+	// Optional: locale for the display strings; see ListBillsRequest
+	Locale string `query:"locale"`
+}
+
+type BatchGetBillsResponse struct {
+	Bills    []BillWithItemsDTO `json:"bills"`     // in request order
+	NotFound []string           `json:"not_found"` // requested IDs with no bill
+}
+
+// BatchGetBills reads several bills with all their items in one query, for
+// dashboards that would otherwise call GET /bills/:id per bill. IDs with no
+// bill (or another owner's) are listed in not_found rather than failing the
+// request; repeated IDs are answered once.
+//
+//encore:api auth method=POST path=/bills/batch-get
+func (s *Service) BatchGetBills(ctx context.Context, req *BatchGetBillsRequest) (*BatchGetBillsResponse, error) {
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	bills, itemsByBill, err := getBillsWithItemsJoin(ctx, callerOwnerID(), ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*Bill, len(bills))
+	for _, b := range bills {
+		byID[b.ID] = b
+	}
+
+	resp := &BatchGetBillsResponse{
+		Bills:    make([]BillWithItemsDTO, 0, len(bills)),
+		NotFound: []string{},
+	}
+	for _, id := range ids {
+		b, ok := byID[id]
+		if !ok {
+			resp.NotFound = append(resp.NotFound, id)
+			continue
+		}
+		resp.Bills = append(resp.Bills, BillWithItemsDTO{
+			Bill:      billToDTO(b, req.Locale),
+			ItemCount: b.ItemCount,
+			Items:     lineItemsToDTOs(itemsByBill[b.ID]),
+		})
+	}
+	return resp, nil
+}
+
+const (
+	consistencyEventual = "eventual"
+	consistencyStrong   = "strong"
+)
+
+type GetBillWithItemsRequest struct {
+	// eventual (default) or strong; see GetBillWithItems
+	Consistency string `query:"consistency"`
+
+	// Optional: locale for the total's display string; see ListBillsRequest
+	Locale string `query:"locale"`
+
+	// Optional: "category" adds groups and total to the response
+	GroupBy string `query:"group_by"`
+}
+
+const groupByCategory = "category"
+
+type GetBillWithItemsResponse struct {
+	Bill      BillDTO       `json:"bill"`
+	ItemCount int           `json:"item_count"` // len(items)
+	Items     []LineItemDTO `json:"items"`
+
+	// group_by=category only: the items per category, in order of first
+	// appearance, and the sum of the group subtotals. That is the item sum
+	// before discount and tax; bill.total is what is charged.
+	Groups []LineItemGroupDTO `json:"groups,omitempty"`
+	Total  *MoneyDTO          `json:"total,omitempty"`
+}
+
+// GetBillWithItems reads a bill and its items.
+//
+// By default (consistency=eventual) it is a single DB read: fast, but an
+// item whose signal the workflow is still processing may be missing.
+//
+// With consistency=strong an OPEN bill is read through its workflow's
+// bill-state query, so the items and running total are the workflow's own
+// (what a close right now would charge), with invoiced items still from
+// the DB. A CLOSED or VOID bill is read from the DB, which is final once
+// the workflow has finished. If the workflow ends between the status check
+// and the query, the DB is read again and answers instead.
+//
+//encore:api auth method=GET path=/bills/:id
+func (s *Service) GetBillWithItems(ctx context.Context, id string, req *GetBillWithItemsRequest) (*GetBillWithItemsResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	b, items, err := getBillWithItemsJoin(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var resp *GetBillWithItemsResponse
+	if req.Consistency == consistencyStrong && b.Status == StatusOpen {
+		if resp, err = s.getBillFromWorkflow(ctx, id, req.Locale); err != nil {
+			return nil, err
+		}
+	} else {
+		resp = &GetBillWithItemsResponse{
+			Bill:      billToDTO(b, req.Locale),
+			ItemCount: b.ItemCount,
+			Items:     lineItemsToDTOs(items),
+		}
+	}
+
+	if req.GroupBy == groupByCategory {
+		groups, total := groupLineItemsByCategory(resp.Items, resp.Bill.Currency, req.Locale)
+		resp.Groups, resp.Total = groups, &total
+	}
+	return resp, nil
+}
+
+// getBillFromWorkflow overlays an OPEN bill's workflow state on its DB row:
+// items the workflow holds replace or extend the DB's, and the total is the
+// workflow's running total.
+func (s *Service) getBillFromWorkflow(ctx context.Context, id, locale string) (*GetBillWithItemsResponse, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	val, err := s.temporalClient.QueryWorkflow(ctx, workflowIDForBill(id), "", queryBillState)
+	var state BillResult
+	if err == nil {
+		err = val.Get(&state)
+	}
+
+	// Read the row after the query: if the bill stopped being OPEN in
+	// between, the DB is final and wins over whatever the query saw
+	b, items, dbErr := getBillWithItemsJoin(ctx, id)
+	if dbErr != nil {
+		return nil, dbErr
+	}
+	if b.Status != StatusOpen {
+		return &GetBillWithItemsResponse{Bill: billToDTO(b, locale), ItemCount: b.ItemCount, Items: lineItemsToDTOs(items)}, nil
+	}
+	if err != nil {
+		billLog(id).Error("query bill state failed", "err", err)
+		return nil, errs.B().Code(errs.Unavailable).Msg("bill workflow unavailable; retry or read with consistency=eventual").Err()
+	}
+
+	held := make(map[string]int, len(state.Items))
+	for i, li := range state.Items {
+		held[li.ID] = i
+	}
+	merged := make([]*LineItem, 0, len(items)+len(state.Items))
+	for _, li := range items {
+		if i, ok := held[li.ID]; ok {
+			li = &state.Items[i]
+			delete(held, li.ID)
+		}
+		merged = append(merged, li)
+	}
+	for i := range state.Items {
+		if _, ok := held[state.Items[i].ID]; ok {
+			merged = append(merged, &state.Items[i])
+		}
+	}
+
+	b.TotalMinor = state.TotalMinor
+	return &GetBillWithItemsResponse{
+		Bill:      billToDTO(b, locale),
+		ItemCount: len(merged),
+		Items:     lineItemsToDTOs(merged),
+	}, nil
+}
+
+type BillSummaryResponse struct {
+	Bill      BillDTO  `json:"bill"`
+	ItemCount int      `json:"item_count"`
+	Total     MoneyDTO `json:"total"`
+}
+
+// GetBillSummary is the header-only read for dashboards: one aggregate
+// query, no line items.
+//
+//encore:api auth method=GET path=/bills/:id/summary
+func (s *Service) GetBillSummary(ctx context.Context, id string) (*BillSummaryResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := billToDTO(b, "")
+	return &BillSummaryResponse{
+		Bill:      dto,
+		ItemCount: b.ItemCount,
+		Total:     dto.Total,
+	}, nil
+}
+
+// ExportBillCSV streams a bill's items as CSV (amounts also in major units),
+// followed by a totals footer. A bill without items yields only the header.
+// With ?kind= only items of that kind are listed, and the footer is just
+// their SUBTOTAL: the bill's discount, tax and total cover every item.
+//
+//encore:api auth raw method=GET path=/bills/:id/export.csv
+func (s *Service) ExportBillCSV(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id := encore.CurrentRequest().PathParams.Get("id")
+
+	if err := checkBillOwner(ctx, id); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	kind := req.URL.Query().Get("kind")
+	var v violations
+	v.lineItemKind("kind", kind)
+	if err := v.err(); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="bill-`+id+`.csv"`)
+
+	cw := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	row := func(label string, amountMinor int64, createdAt string, kind LineItemKind) []string {
+		return []string{label, strconv.FormatInt(amountMinor, 10), csvAmount(amountMinor, b.Currency), string(b.Currency), createdAt, string(kind)}
+	}
+
+	_ = cw.Write([]string{"description", "amount_minor", "amount", "currency", "created_at", "kind"})
+
+	// Headers are sent with the first flush, so errors from here on can
+	// only be logged; the truncated file lacks its footer.
+	var subtotal int64
+	n := 0
+	err = streamLineItems(ctx, id, LineItemKind(kind), func(li *LineItem) error {
+		subtotal += li.AmountMinor
+		n++
+		if err := cw.Write(row(csvText(li.Description), li.AmountMinor, li.CreatedAt.UTC().Format(time.RFC3339Nano), li.Kind)); err != nil {
+			return err
+		}
+		if n%csvFlushEvery == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return cw.Error()
+	})
+	if err != nil {
+		billLog(id).Error("bill csv export aborted", "rows", n, "err", err)
+		cw.Flush()
+		return
+	}
+
+	if n > 0 {
+		_ = cw.Write(row("SUBTOTAL", subtotal, "", ""))
+		if b.Status == StatusClosed && kind == "" {
+			if b.DiscountMinor != 0 {
+				_ = cw.Write(row("DISCOUNT", -b.DiscountMinor, "", ""))
+			}
+			if b.TaxMinor != 0 {
+				_ = cw.Write(row("TAX", b.TaxMinor, "", ""))
+			}
+			_ = cw.Write(row("TOTAL", b.TotalMinor, "", ""))
+		}
+	}
+	cw.Flush()
+}
+
+type ListLineItemsRequest struct {
+	Limit  int    `query:"limit"` // default cfg.DefaultPageLimit
+	Offset int    `query:"offset"`
+	Kind   string `query:"kind"` // optional: only items of this kind
+}
+
+type ListLineItemsResponse struct {
+	Items []LineItemDTO `json:"items"`
+	Total int           `json:"total"` // all of the bill's items, of any kind
+}
+
+// ListLineItems pages through one bill's items without the bill header, so
+// large bills can be lazy-loaded.
+//
+//encore:api auth method=GET path=/bills/:id/line-items
+func (s *Service) ListLineItems(ctx context.Context, id string, req *ListLineItemsRequest) (*ListLineItemsResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		return nil, err
+	}
+
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := listLineItemsPage(ctx, id, LineItemKind(req.Kind), limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	total, err := countLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListLineItemsResponse{
 		Items: lineItemsToDTOs(items),
+		Total: total,
+	}, nil
+}
+
+type ListBillEventsRequest struct {
+	Type   string `query:"type"`   // optional: only events of this type
+	Cursor string `query:"cursor"` // next_cursor from a previous page
+	Limit  int    `query:"limit"`
+}
+
+type BillEventDTO struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt string          `json:"created_at"`
+}
+
+type ListBillEventsResponse struct {
+	Events     []BillEventDTO `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	HasMore    bool           `json:"has_more"`
+}
+
+// ListBillEvents pages through a bill's audit trail in the order the
+// changes committed. Events show up once billEventsSafetyLag old, so a page
+// never ends past a gap a slower transaction may still fill.
+//
+//encore:api auth method=GET path=/bills/:id/events
+func (s *Service) ListBillEvents(ctx context.Context, id string, req *ListBillEventsRequest) (*ListBillEventsResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		return nil, err
+	}
+
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	var afterID int64
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if afterID, err = strconv.ParseInt(c.ID, 10, 64); err != nil {
+			return nil, errs.B().Code(errs.InvalidArgument).Msg("invalid cursor").Err()
+		}
+	}
+
+	events, err := listBillEvents(ctx, id, req.Type, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	events, more := settledEventsPage(events, limit, time.Now())
+
+	out := &ListBillEventsResponse{
+		Events:  make([]BillEventDTO, 0, len(events)),
+		HasMore: more,
+	}
+	for _, e := range events {
+		out.Events = append(out.Events, BillEventDTO{
+			ID:        e.ID,
+			Type:      e.Type,
+			Payload:   e.Payload,
+			CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	if more {
+		last := events[len(events)-1]
+		out.NextCursor = encodeCursor(pageCursor{Time: last.CreatedAt, ID: strconv.FormatInt(last.ID, 10)})
+	}
+	return out, nil
+}
+
+type ListChangedBillsRequest struct {
+	Since  string `query:"since"`  // RFC3339, exclusive; required unless cursor is set
+	Cursor string `query:"cursor"` // next_cursor from a previous page
+	Limit  int    `query:"limit"`
+}
+
+type ListChangedBillsResponse struct {
+	Bills []BillWithItemsDTO `json:"bills"`
+	// Position after the last returned bill. Persist it and pass it back as
+	// ?cursor= on the next sync, even when has_more is false.
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// ListChangedBills serves incremental ETL: bills whose updated_at (bumped by
+// every mutation, including create and close) is after the marker, ordered
+// by change time, each with its full item list so the warehouse can upsert.
+// A change shows up once it is changedBillsSafetyLag old, so one committed
+// late with an earlier updated_at is not skipped.
+//
+//encore:api auth method=GET path=/bills/changed
+func (s *Service) ListChangedBills(ctx context.Context, req *ListChangedBillsRequest) (*ListChangedBillsResponse, error) {
+	var (
+		since time.Time
+		after *pageCursor
+		err   error
+	)
+	switch {
+	case req.Cursor != "":
+		if after, err = decodeCursor(req.Cursor); err != nil {
+			return nil, err
+		}
+	case req.Since != "":
+		if since, err = time.Parse(time.RFC3339Nano, req.Since); err != nil {
+			return nil, errs.B().Code(errs.InvalidArgument).Msg("since must be RFC3339").Err()
+		}
+	default:
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("since or cursor is required").Err()
+	}
+
+	limit, err := pageLimit(req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	bills, itemsByBill, err := listChangedBillsJoin(ctx, callerOwnerID(), since, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &ListChangedBillsResponse{
+		Bills:      make([]BillWithItemsDTO, 0, len(bills)),
+		NextCursor: req.Cursor,
+		HasMore:    len(bills) == limit,
+	}
+	for _, b := range bills {
+		out.Bills = append(out.Bills, BillWithItemsDTO{
+			Bill:      billToDTO(b, ""),
+			ItemCount: b.ItemCount,
+			Items:     lineItemsToDTOs(itemsByBill[b.ID]),
+		})
+	}
+	if n := len(bills); n > 0 {
+		out.NextCursor = encodeCursor(pageCursor{Time: bills[n-1].UpdatedAt, ID: bills[n-1].ID})
+	}
+
+	return out, nil
+}
+
+type BillReportRequest struct {
+	// Optional RFC3339 bounds on created_at, as for GET /bills
+	CreatedAfter  string `query:"created_after"`
+	CreatedBefore string `query:"created_before"`
+}
+
+type BillReportResponse struct {
+	Rows []BillReportRowDTO `json:"rows"` // ordered by currency, then status
+}
+
+type BillReportRowDTO struct {
+	Currency  Currency   `json:"currency"`
+	Status    BillStatus `json:"status"`
+	BillCount int        `json:"bill_count"`
+
+	// CLOSED: sum of charged totals (after discounts and tax). OPEN: sum of
+	// the line items so far, since an open bill's total is only set at close.
+	TotalMinor int64 `json:"total_minor"`
+}
+
+// GetBillReport totals bills per currency and status, e.g. how much is
+// still open vs already closed. VOID bills are left out, as in GET /bills.
+//
+//encore:api auth method=GET path=/bills/report
+func (s *Service) GetBillReport(ctx context.Context, req *BillReportRequest) (*BillReportResponse, error) {
+	f := billFilter{OwnerID: callerOwnerID()}
+	var err error
+	if f.CreatedAfter, err = parseTimeParam("created_after", req.CreatedAfter); err != nil {
+		return nil, err
+	}
+	if f.CreatedBefore, err = parseTimeParam("created_before", req.CreatedBefore); err != nil {
+		return nil, err
+	}
+	if f.CreatedAfter != nil && f.CreatedBefore != nil && !f.CreatedBefore.After(*f.CreatedAfter) {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("created_before must be after created_after").Err()
+	}
+
+	rows, err := getBillReport(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &BillReportResponse{Rows: make([]BillReportRowDTO, 0, len(rows))}
+	for _, r := range rows {
+		out.Rows = append(out.Rows, BillReportRowDTO{
+			Currency:   r.Currency,
+			Status:     r.Status,
+			BillCount:  r.BillCount,
+			TotalMinor: r.TotalMinor,
+		})
+	}
+	return out, nil
+}
+
+// GetWorkflowStatus asks the bill's workflow itself, which knows about a
+// close in flight (CLOSING) before the DB row changes. It also lists adds the
+// workflow rejected after the API accepted them (by line_item_id), since the
+// workflow's checks are authoritative and a signal carries no reply.
+//
+//encore:api auth method=GET path=/bills/:id/workflow-status
+func (s *Service) GetWorkflowStatus(ctx context.Context, id string) (*BillWorkflowStatus, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	val, err := s.temporalClient.QueryWorkflow(ctx, workflowIDForBill(id), "", queryBillStatus)
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			return nil, errs.B().Code(errs.NotFound).Msg("bill workflow not found").Err()
+		}
+		billLog(id).Error("query bill workflow failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("query bill workflow").Err()
+	}
+
+	var out BillWorkflowStatus
+	if err := val.Get(&out); err != nil {
+		billLog(id).Error("decode workflow status failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("decode workflow status").Err()
+	}
+	return &out, nil
+}
+
+// GetBillTotals is a lightweight GetWorkflowStatus for polling: the
+// workflow's running total and item count, without the items themselves.
+//
+//encore:api auth method=GET path=/bills/:id/totals
+func (s *Service) GetBillTotals(ctx context.Context, id string) (*BillTotals, error) {
+	if err := s.requireTemporal(); err != nil {
+		return nil, err
+	}
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	val, err := s.temporalClient.QueryWorkflow(ctx, workflowIDForBill(id), "", queryBillTotals)
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if errors.As(err, &notFound) {
+			return nil, errs.B().Code(errs.NotFound).Msg("bill workflow not found").Err()
+		}
+		billLog(id).Error("query bill totals failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("query bill totals").Err()
+	}
+
+	var out BillTotals
+	if err := val.Get(&out); err != nil {
+		billLog(id).Error("decode bill totals failed", "err", err)
+		return nil, errs.B().Code(errs.Internal).Msg("decode bill totals").Err()
+	}
+	return &out, nil
+}
+
+const (
+	resultSourceWorkflow = "workflow"
+	resultSourceDB       = "db"
+)
+
+type BillResultResponse struct {
+	// workflow: the value the workflow returned, from Temporal history.
+	// db: history was purged (or the workflow terminated, or Temporal was
+	// unreachable), so this is rebuilt from the bill row and may reflect
+	// later DB edits.
+	Source string `json:"source"`
+
+	BillID        string        `json:"bill_id"`
+	Currency      Currency      `json:"currency"`
+	Items         []LineItemDTO `json:"items"` // the items the close charged
+	SubtotalMinor int64         `json:"subtotal_minor"`
+	DiscountMinor int64         `json:"discount_minor"`
+	TaxMinor      int64         `json:"tax_minor"`
+	TotalMinor    int64         `json:"total_minor"`
+	InvoicedMinor int64         `json:"invoiced_minor"`
+	Voided        bool          `json:"voided"`
+	Base          *BaseTotalDTO `json:"base,omitempty"`
+
+	RejectedLineItems int `json:"rejected_line_items"` // workflow source only
+}
+
+// GetBillResult returns what a finished bill's workflow computed, read from
+// its Temporal history, so later DB edits don't show. Open bills have no
+// result yet.
+//
+//encore:api auth method=GET path=/bills/:id/result
+func (s *Service) GetBillResult(ctx context.Context, id string) (*BillResultResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	status, _, err := getBillStatusAndCurrency(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status == StatusOpen {
+		return nil, errs.B().Code(errs.FailedPrecondition).Msg("bill is still open").Err()
+	}
+
+	// The bill has left OPEN, so the DB row is final: any failure to read
+	// the run (purged by retention, terminated, or Temporal unreachable)
+	// falls back to it rather than failing the read
+	if s.degraded.Load() {
+		return billResultFromDB(ctx, id)
+	}
+	var result BillResult
+	err = s.temporalClient.GetWorkflow(ctx, workflowIDForBill(id), "").Get(ctx, &result)
+	if err != nil {
+		var notFound *serviceerror.NotFound
+		if !errors.As(err, &notFound) && !temporal.IsTerminatedError(err) {
+			billLog(id).Warn("get workflow result failed; answering from the DB", "err", err)
+		}
+		return billResultFromDB(ctx, id)
+	}
+
+	items := make([]*LineItem, len(result.Items))
+	for i := range result.Items {
+		items[i] = &result.Items[i]
+	}
+	// A run that continued as new only carried earlier items' IDs
+	if len(result.CarriedItems) > 0 {
+		if items, err = listUninvoicedLineItems(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return &BillResultResponse{
+		Source:            resultSourceWorkflow,
+		BillID:            result.BillID,
+		Currency:          result.Currency,
+		Items:             lineItemsToDTOs(items),
+		SubtotalMinor:     result.SubtotalMinor,
+		DiscountMinor:     result.DiscountMinor,
+		TaxMinor:          result.TaxMinor,
+		TotalMinor:        result.TotalMinor,
+		InvoicedMinor:     result.InvoicedMinor,
+		Voided:            result.Voided,
+		Base:              baseTotalToDTO(result.BaseCurrency, result.BaseTotalMinor, result.FXRatePPM),
+		RejectedLineItems: result.RejectedLineItems,
+	}, nil
+}
+
+// billResultFromDB rebuilds GetBillResult's answer from the stored bill.
+func billResultFromDB(ctx context.Context, id string) (*BillResultResponse, error) {
+	b, err := getBillSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := listUninvoicedLineItems(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	invoices, err := listInvoices(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &BillResultResponse{
+		Source:        resultSourceDB,
+		BillID:        b.ID,
+		Currency:      b.Currency,
+		Items:         lineItemsToDTOs(items),
+		SubtotalMinor: b.SubtotalMinor,
+		DiscountMinor: b.DiscountMinor,
+		TaxMinor:      b.TaxMinor,
+		TotalMinor:    b.TotalMinor,
+		Voided:        b.Status == StatusVoid,
+		Base:          baseTotalToDTO(b.BaseCurrency, b.BaseTotalMinor, b.FXRatePPM),
+	}
+	for _, inv := range invoices {
+		out.InvoicedMinor += inv.TotalMinor
+	}
+	return out, nil
+}
+
+type ItemStatsRequest struct {
+	Kind string `query:"kind"` // optional: e.g. user to leave out system lines
+}
+
+type ItemStatsResponse struct {
+	Count          int   `json:"count"`
+	MinAmountMinor int64 `json:"min_amount_minor"`
+	MaxAmountMinor int64 `json:"max_amount_minor"`
+	AvgAmountMinor int64 `json:"avg_amount_minor"` // rounded to the nearest minor unit
+	TotalMinor     int64 `json:"total_minor"`      // sum of items, also while the bill is open
+}
+
+//encore:api auth method=GET path=/bills/:id/item-stats
+func (s *Service) GetItemStats(ctx context.Context, id string, req *ItemStatsRequest) (*ItemStatsResponse, error) {
+	if err := checkBillOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		return nil, err
+	}
+
+	st, err := getLineItemStats(ctx, id, LineItemKind(req.Kind))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ItemStatsResponse{
+		Count:          st.Count,
+		MinAmountMinor: st.Min,
+		MaxAmountMinor: st.Max,
+		AvgAmountMinor: st.Avg,
+		TotalMinor:     st.Total,
 	}, nil
 }
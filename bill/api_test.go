@@ -0,0 +1,174 @@
+package bill
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/et"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/mocks"
+)
+
+// Runs against the test database encore test provisions. A CLOSED bill is
+// answered from the DB, so no Temporal client is needed.
+func TestCloseBillIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s := &Service{}
+	id := "bill-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `
+		INSERT INTO bills (id, status, currency, total_minor, subtotal_minor, discount_minor, tax_minor, closed_at)
+		VALUES ($1, 'CLOSED', 'USD', 1078, 1100, 100, 78, now())
+	`, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `
+		INSERT INTO bill_line_items (id, bill_id, description, amount_minor) VALUES ($1, $3, 'a', 600), ($2, $3, 'b', 500)
+	`, id+"-1", id+"-2", id); err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		resp, err := s.CloseBill(ctx, id)
+		if err != nil {
+			t.Fatalf("close #%d of a closed bill = %v, want its final totals", attempt, err)
+		}
+		if !resp.AlreadyClosed {
+			t.Errorf("close #%d: already_closed not set", attempt)
+		}
+		if resp.TotalMinor != 1078 || resp.SubtotalMinor != 1100 || resp.DiscountMinor != 100 || resp.TaxMinor != 78 || len(resp.Items) != 2 {
+			t.Errorf("close #%d = %+v, want the stored figures and both items", attempt, resp)
+		}
+	}
+
+	// Adding to it is still a precondition failure
+	_, err := s.AddLineItem(ctx, id, &AddLineItemRequest{Description: "late", AmountMinor: 100, Currency: CurrencyUSD})
+	if errs.Code(err) != errs.FailedPrecondition {
+		t.Errorf("add to a closed bill = %v, want FailedPrecondition", err)
+	}
+}
+
+// Runs against the test database encore test provisions.
+func TestCloseVoidBillFails(t *testing.T) {
+	ctx := context.Background()
+	id := "bill-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `INSERT INTO bills (id, status, currency) VALUES ($1, 'VOID', 'USD')`, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Service{}).CloseBill(ctx, id); errs.Code(err) != errs.FailedPrecondition {
+		t.Errorf("close of a void bill = %v, want FailedPrecondition", err)
+	}
+}
+
+// Runs against the test database encore test provisions.
+func TestChangedBillsWaitForSafetyLag(t *testing.T) {
+	ctx := context.Background()
+	owner := "owner-" + uuid.NewString()
+	settled, fresh := "bill-"+uuid.NewString(), "bill-"+uuid.NewString()
+	if _, err := db.Exec(ctx, `
+		INSERT INTO bills (id, status, currency, owner_id, updated_at)
+		VALUES ($1, 'OPEN', 'USD', $3, now() - interval '1 minute'), ($2, 'OPEN', 'USD', $3, now())
+	`, settled, fresh, owner); err != nil {
+		t.Fatal(err)
+	}
+
+	bills, _, err := listChangedBillsJoin(ctx, owner, time.Time{}, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bills) != 1 || bills[0].ID != settled {
+		t.Fatalf("changed bills = %v, want only %s: %s changed inside the lag", bills, settled, fresh)
+	}
+
+	// A cursor at the settled bill doesn't pass the fresh one either
+	after := &pageCursor{Time: bills[0].UpdatedAt, ID: settled}
+	if bills, _, err = listChangedBillsJoin(ctx, owner, time.Time{}, after, 10); err != nil || len(bills) != 0 {
+		t.Errorf("changed bills after the cursor = (%v, %v), want none yet", bills, err)
+	}
+}
+
+// Runs against the test database encore test provisions, with a mocked
+// Temporal client standing in for the workflow.
+func TestAddCreditSignalsCallerOwner(t *testing.T) {
+	ctx := context.Background()
+	id := "bill-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `INSERT INTO bills (id, status, currency, owner_id) VALUES ($1, 'OPEN', 'USD', 'acme')`, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `INSERT INTO bill_line_items (id, bill_id, description, amount_minor) VALUES ($1, $2, 'seat', 1000)`, id+"-1", id); err != nil {
+		t.Fatal(err)
+	}
+	et.OverrideAuthInfo("acme-caller", &AuthData{OwnerID: "acme"})
+
+	c := mocks.NewClient(t)
+	c.On("SignalWorkflow", mock.Anything, workflowIDForBill(id), "", signalAddLineItem,
+		mock.MatchedBy(func(sig AddLineItemSignal) bool { return sig.Credit && sig.OwnerID == "acme" }),
+	).Return(nil).Once()
+
+	s := &Service{temporalClient: c}
+	if _, err := s.AddCredit(ctx, id, &AddCreditRequest{Description: "refund", AmountMinor: -300, Currency: CurrencyUSD}); err != nil {
+		t.Fatalf("AddCredit = %v", err)
+	}
+}
+
+// Runs against the test database encore test provisions.
+func TestAddCreditTemporalUnavailable(t *testing.T) {
+	ctx := context.Background()
+	id := "bill-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `INSERT INTO bills (id, status, currency) VALUES ($1, 'OPEN', 'USD')`, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `INSERT INTO bill_line_items (id, bill_id, description, amount_minor) VALUES ($1, $2, 'seat', 1000)`, id+"-1", id); err != nil {
+		t.Fatal(err)
+	}
+
+	c := mocks.NewClient(t)
+	c.On("SignalWorkflow", mock.Anything, workflowIDForBill(id), "", signalAddLineItem, mock.Anything).
+		Return(serviceerror.NewUnavailable("frontend down")).Once()
+
+	_, err := (&Service{temporalClient: c}).AddCredit(ctx, id, &AddCreditRequest{Description: "refund", AmountMinor: -300, Currency: CurrencyUSD})
+	if errs.Code(err) != errs.Unavailable {
+		t.Errorf("credit while Temporal is down = %v, want Unavailable, not bill closed", err)
+	}
+}
+
+// Runs against the test database encore test provisions.
+func TestTerminateRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+	for _, status := range []BillStatus{StatusOpen, StatusClosed} {
+		id := "bill-" + uuid.NewString()
+		if _, err := db.Exec(ctx, `INSERT INTO bills (id, status, currency) VALUES ($1, $2, 'USD')`, id, string(status)); err != nil {
+			t.Fatal(err)
+		}
+
+		voided, err := terminateBillRow(ctx, id, "stuck")
+		if err != nil {
+			t.Fatalf("terminate %s bill: %v", status, err)
+		}
+		if voided != (status == StatusOpen) {
+			t.Errorf("terminate %s bill: voided = %v", status, voided)
+		}
+
+		events, err := listBillEvents(ctx, id, "terminated", 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("terminate %s bill: %d terminated events, want 1", status, len(events))
+		}
+		var payload struct {
+			Reason         string `json:"reason"`
+			PreviousStatus string `json:"previous_status"`
+		}
+		if err := json.Unmarshal(events[0].Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Reason != "stuck" || payload.PreviousStatus != string(status) {
+			t.Errorf("terminate %s bill: payload = %+v", status, payload)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package bill
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// Callers authenticate with an API key, sent as "Authorization: Bearer
+// <key>" or "X-API-Key: <key>". Keys come from the APIKeys secret, a
+// comma-separated list of owner_id:key entries; each key acts for one
+// owner (tenant). An entry with an empty owner (":key") acts for the
+// bills created before owner scoping.
+
+type AuthParams struct {
+	Authorization string `header:"Authorization"`
+	APIKey        string `header:"X-API-Key"`
+}
+
+// AuthData is the authenticated principal. The UID names the key (by a
+// fingerprint, never the key itself) so logs can tell callers apart.
+type AuthData struct {
+	OwnerID string
+}
+
+type apiKey struct {
+	ownerID string
+	hash    [sha256.Size]byte
+}
+
+var (
+	apiKeysOnce sync.Once
+	apiKeys     []apiKey
+)
+
+// loadAPIKeys parses the APIKeys secret once.
+func loadAPIKeys() []apiKey {
+	apiKeysOnce.Do(func() {
+		apiKeys = parseAPIKeys(secrets.APIKeys)
+	})
+	return apiKeys
+}
+
+// parseAPIKeys reads owner_id:key entries; malformed ones are logged and
+// skipped.
+func parseAPIKeys(raw string) []apiKey {
+	var keys []apiKey
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		owner, key, ok := strings.Cut(entry, ":")
+		if !ok || key == "" {
+			rlog.Error("ignoring malformed APIKeys entry; want owner_id:key")
+			continue
+		}
+		keys = append(keys, apiKey{ownerID: owner, hash: sha256.Sum256([]byte(key))})
+	}
+	return keys
+}
+
+// AuthHandler resolves an API key to its owner. A missing or unknown key
+// is Unauthenticated.
+//
+//encore:authhandler
+func (s *Service) AuthHandler(ctx context.Context, p *AuthParams) (auth.UID, *AuthData, error) {
+	return authenticate(loadAPIKeys(), p)
+}
+
+func authenticate(keys []apiKey, p *AuthParams) (auth.UID, *AuthData, error) {
+	key := p.APIKey
+	if key == "" {
+		scheme, token, _ := strings.Cut(p.Authorization, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			key = strings.TrimSpace(token)
+		}
+	}
+	if key == "" {
+		return "", nil, errs.B().Code(errs.Unauthenticated).Msg("missing API key").Err()
+	}
+
+	// Compare against every key so timing doesn't reveal which one matched
+	hash := sha256.Sum256([]byte(key))
+	var match *apiKey
+	for i := range keys {
+		if subtle.ConstantTimeCompare(hash[:], keys[i].hash[:]) == 1 {
+			match = &keys[i]
+		}
+	}
+	if match == nil {
+		return "", nil, errs.B().Code(errs.Unauthenticated).Msg("invalid API key").Err()
+	}
+
+	uid := auth.UID("key-" + hex.EncodeToString(hash[:6]))
+	return uid, &AuthData{OwnerID: match.ownerID}, nil
+}
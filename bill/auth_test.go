@@ -0,0 +1,57 @@
+package bill
+
+import (
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys := parseAPIKeys(" acme:k1 ,:legacy,, malformed, globex: ,initech:k2")
+	var owners []string
+	for _, k := range keys {
+		owners = append(owners, k.ownerID)
+	}
+	if len(owners) != 3 || owners[0] != "acme" || owners[1] != "" || owners[2] != "initech" {
+		t.Errorf("owners = %q, want [acme \"\" initech]; malformed entries skipped", owners)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := parseAPIKeys("acme:k1,:legacy")
+
+	tests := []struct {
+		name   string
+		params AuthParams
+		owner  string // when accepted
+		code   errs.ErrCode
+	}{
+		{"bearer", AuthParams{Authorization: "Bearer k1"}, "acme", errs.OK},
+		{"bearer any case", AuthParams{Authorization: "bearer  k1"}, "acme", errs.OK},
+		{"X-API-Key", AuthParams{APIKey: "k1"}, "acme", errs.OK},
+		{"X-API-Key wins", AuthParams{APIKey: "legacy", Authorization: "Bearer k1"}, "", errs.OK},
+		{"pre-tenancy key", AuthParams{APIKey: "legacy"}, "", errs.OK},
+		{"missing", AuthParams{}, "", errs.Unauthenticated},
+		{"other scheme", AuthParams{Authorization: "Basic k1"}, "", errs.Unauthenticated},
+		{"empty bearer", AuthParams{Authorization: "Bearer "}, "", errs.Unauthenticated},
+		{"unknown key", AuthParams{APIKey: "k2"}, "", errs.Unauthenticated},
+		{"owner is not a key", AuthParams{APIKey: "acme"}, "", errs.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, data, err := authenticate(keys, &tt.params)
+			if got := errCode(err); got != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.code, err)
+			}
+			if err != nil {
+				return
+			}
+			if data.OwnerID != tt.owner {
+				t.Errorf("owner = %q, want %q", data.OwnerID, tt.owner)
+			}
+			if uid == "" || uid == "k1" || uid == "legacy" {
+				t.Errorf("uid = %q, want a fingerprint, not the key", uid)
+			}
+		})
+	}
+}
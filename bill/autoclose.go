@@ -0,0 +1,163 @@
+package bill
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.dev/rlog"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Stale bill auto-close: a Temporal cron workflow that nightly signals
+// close to every bill left OPEN longer than AutoCloseAfterDays. One fixed
+// workflow ID, so every instance starting it at init shares the one run.
+const (
+	autoCloseWorkflowID   = "auto-close-stale-bills"
+	autoCloseCronSchedule = "0 2 * * *" // 02:00 UTC
+
+	// Between batches, so a large backlog becomes a steady trickle of
+	// closes instead of thousands of workflows hitting the worker at once
+	autoCloseBatchPause = 5 * time.Second
+)
+
+// Keyset cursor over (created_at, id), carried across continue-as-new.
+// Zero on each cron run, which starts from the oldest bill.
+type AutoCloseParams struct {
+	AfterCreatedAt time.Time
+	AfterID        string
+}
+
+type ListStaleBillsInput struct {
+	AfterCreatedAt time.Time
+	AfterID        string
+}
+
+type StaleBillsPage struct {
+	BillIDs       []string
+	LastCreatedAt time.Time // of the last bill in BillIDs
+	More          bool      // a full batch; there may be more
+}
+
+// AutoCloseStaleBillsWorkflow signals close to stale open bills a batch at
+// a time. Idempotent: the bill workflow keeps the first close it receives
+// and ignores the rest, and bills already closed or voided are not listed
+// (or, racing that, have no workflow left to signal).
+func AutoCloseStaleBillsWorkflow(ctx workflow.Context, params AutoCloseParams) error {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout:    30 * time.Second,
+		ScheduleToCloseTimeout: 5 * time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    30 * time.Second,
+		},
+	})
+	logger := workflow.GetLogger(ctx)
+
+	// Echoed as the bill's CloseRequestID, marking the close as automatic
+	requestID := "auto-close-" + workflow.GetInfo(ctx).WorkflowExecution.RunID
+
+	for {
+		var page StaleBillsPage
+		if err := workflow.ExecuteActivity(ctx,
+			ListStaleBillsActivity,
+			ListStaleBillsInput{AfterCreatedAt: params.AfterCreatedAt, AfterID: params.AfterID},
+		).Get(ctx, &page); err != nil {
+			return err
+		}
+
+		futures := make([]workflow.Future, len(page.BillIDs))
+		for i, id := range page.BillIDs {
+			futures[i] = workflow.SignalExternalWorkflow(ctx,
+				workflowIDForBill(id), "", signalCloseBill, CloseBillSignal{RequestID: requestID})
+		}
+		for i, f := range futures {
+			if err := f.Get(ctx, nil); err != nil {
+				// Closed, voided or deleted since it was listed
+				logger.Warn("auto-close signal failed", "BillID", page.BillIDs[i], "Error", err)
+			}
+		}
+		if len(page.BillIDs) > 0 {
+			logger.Info("auto-close batch signalled", "Bills", len(page.BillIDs))
+		}
+
+		if !page.More {
+			return nil
+		}
+		params.AfterCreatedAt = page.LastCreatedAt
+		params.AfterID = page.BillIDs[len(page.BillIDs)-1]
+
+		if workflow.GetInfo(ctx).GetCurrentHistoryLength() >= continueAsNewHistoryLength {
+			return workflow.NewContinueAsNewError(ctx, AutoCloseStaleBillsWorkflow, params)
+		}
+		if err := workflow.Sleep(ctx, autoCloseBatchPause); err != nil {
+			return err
+		}
+	}
+}
+
+// ListStaleBillsActivity returns the next batch of open bills created more
+// than AutoCloseAfterDays ago, oldest first. Config is read here rather
+// than in the workflow so a deploy can change it without breaking replay;
+// a deploy that disables the job ends a running pass at its next batch.
+func ListStaleBillsActivity(ctx context.Context, in ListStaleBillsInput) (*StaleBillsPage, error) {
+	if cfg.AutoCloseAfterDays <= 0 {
+		return &StaleBillsPage{}, nil
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, created_at FROM bills
+		WHERE status = 'OPEN' AND deleted_at IS NULL
+		  AND created_at < now() - make_interval(days => $1)
+		  AND (created_at, id) > ($2, $3)
+		ORDER BY created_at, id
+		LIMIT $4
+	`, cfg.AutoCloseAfterDays, in.AfterCreatedAt, in.AfterID, cfg.AutoCloseBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &StaleBillsPage{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id, &page.LastCreatedAt); err != nil {
+			return nil, err
+		}
+		page.BillIDs = append(page.BillIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	page.More = len(page.BillIDs) == cfg.AutoCloseBatchSize
+	return page, nil
+}
+
+// startAutoClose starts the cron workflow when the job is enabled, or
+// terminates a run left over from a deploy that had it enabled. Errors are
+// logged, never fatal: the job is housekeeping, not part of serving bills.
+func startAutoClose(ctx context.Context, c client.Client) {
+	if cfg.AutoCloseAfterDays <= 0 {
+		err := c.TerminateWorkflow(ctx, autoCloseWorkflowID, "", "auto-close disabled")
+		var notFound *serviceerror.NotFound
+		if err != nil && !errors.As(err, &notFound) {
+			rlog.Error("stop auto-close workflow failed", "err", err)
+		}
+		return
+	}
+
+	// Without WorkflowExecutionErrorWhenAlreadyStarted, a run started by
+	// another instance (or an earlier deploy) is simply reused
+	_, err := c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:           autoCloseWorkflowID,
+		TaskQueue:    taskQueue(),
+		CronSchedule: autoCloseCronSchedule,
+	}, AutoCloseStaleBillsWorkflow, AutoCloseParams{})
+	if err != nil {
+		rlog.Error("start auto-close workflow failed", "err", err)
+	}
+}
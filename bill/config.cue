@@ -0,0 +1,105 @@
+// Temporal frontend. Override per environment (e.g. a managed cluster);
+// empty values fall back to localhost:7233 and the "default" namespace.
+TemporalHostPort:  ""
+TemporalNamespace: ""
+
+// Retry the Temporal dial at init for this long (seconds). With
+// TemporalDegradedStart, a service that still can't reach it starts
+// read-only and reconnects in the background; otherwise init fails.
+TemporalDialRetrySeconds: 30
+TemporalDegradedStart:    false
+
+// Task queue for bill workflows and their activities; empty falls back
+// to "fees-billing". Use one per environment or worker pool. Only change
+// it while no bills are open on the old queue (or keep a worker on it).
+TaskQueue: ""
+
+// Restarting a bill's workflow ID: REJECT_DUPLICATE (never) or
+// ALLOW_DUPLICATE_FAILED_ONLY (only after a failed/terminated run).
+WorkflowIDReusePolicy: "REJECT_DUPLICATE"
+
+// Idempotency-Key replays on CreateBill return the original bill for this
+// long (24h); after that the key creates a new bill.
+IdempotencyKeyTTLSeconds: 86400
+
+// Circuit breaker around read-path DB queries.
+DBBreakerFailureThreshold: 5
+DBBreakerCooldownSeconds:  10
+
+// Worker concurrency. Keep activities <= DB pool size (each holds a
+// connection) with headroom left for API handlers.
+WorkerMaxConcurrentActivities:    10
+WorkerActivityPollers:            2
+WorkerMaxConcurrentWorkflowTasks: 1000
+
+// Grace period for running activities when the worker stops.
+WorkerStopTimeoutSeconds: 30
+
+// Per-caller limit on bill creation and line item adds (token bucket,
+// per instance). RateLimitPerSecond 0 disables it.
+RateLimitPerSecond: 10
+RateLimitBurst:     20
+
+// Fat-finger caps in minor units, per currency: one line item, and a
+// bill's running total. About $1M and $10M; currencies left out are
+// uncapped.
+MaxLineItemAmountMinor: {
+	USD: 100000000
+	EUR: 100000000
+	GBP: 100000000
+	GEL: 300000000
+	JPY: 150000000
+}
+MaxBillTotalMinor: {
+	USD: 1000000000
+	EUR: 1000000000
+	GBP: 1000000000
+	GEL: 3000000000
+	JPY: 1500000000
+}
+
+// Close stores the DB's item sum when the workflow's total drifted from
+// it; drift beyond this many minor units is logged as an error.
+CloseTotalDriftToleranceMinor: 0
+
+// Line item descriptions are trimmed and capped at this many characters.
+MaxDescriptionLength: 500
+
+// Bill memos are trimmed and capped at this many characters.
+MaxMemoLength: 2000
+
+// Line items a bill may hold; bounds the workflow's history.
+MaxLineItems: 1000
+
+// Items per batch add request.
+MaxBatchLineItems: 500
+
+// Bill IDs per batch get request.
+MaxBatchGetBills: 100
+
+// Bill workflows continue as new after this many signals, keeping
+// their history (and replays) short.
+ContinueAsNewAfterSignals: 500
+
+// Max items per bill in GET /bills; GET /bills/:id stays unbounded.
+ListItemPreviewLimit: 20
+
+// List pagination: default ?limit and its upper bound (default <= max).
+DefaultPageLimit: 50
+MaxPageLimit:     200
+
+// Timeout for GET /bills/:id on very large bills.
+DetailQueryTimeoutMs: 2000
+
+// POSTed the final bill when it closes (HMAC-signed with the
+// WebhookSigningKey secret). Empty disables it.
+BillClosedWebhookURL: ""
+
+// Closed totals are also reported in this currency (static FX table).
+// Empty disables conversion.
+BaseCurrency: "USD"
+
+// Nightly job closing bills left OPEN longer than this many days, in
+// batches of AutoCloseBatchSize. 0 disables it.
+AutoCloseAfterDays: 0
+AutoCloseBatchSize: 100
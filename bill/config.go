@@ -0,0 +1,272 @@
+package bill
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"encore.dev/config"
+	enumspb "go.temporal.io/api/enums/v1"
+)
+
+type Config struct {
+	// Temporal frontend; empty falls back to localhost:7233 / "default"
+	TemporalHostPort  string
+	TemporalNamespace string
+
+	// Dial attempts at init back off for up to this many seconds before
+	// giving up; 0 tries once. With TemporalDegradedStart the service then
+	// starts anyway: reads work, endpoints that need a workflow answer
+	// Unavailable, and a background reconnect restores them once Temporal
+	// answers. Without it, init fails as before.
+	TemporalDialRetrySeconds int
+	TemporalDegradedStart    bool
+
+	// Task queue this deployment's worker polls and starts bill workflows
+	// on; empty falls back to "fees-billing". A workflow stays on the queue
+	// it was started on (signals route by workflow ID, not queue), so
+	// changing it strands running bills unless a worker still polls the old
+	// queue until they finish.
+	TaskQueue string
+
+	// Whether a bill's workflow ID may be started again once a run exists:
+	// REJECT_DUPLICATE (empty; never) or ALLOW_DUPLICATE_FAILED_ONLY (after
+	// a failed, terminated or timed-out run, so an Idempotency-Key retry
+	// or a signal can revive a bill whose workflow died). Completed runs
+	// are never restarted either way.
+	WorkflowIDReusePolicy string
+
+	// How long an Idempotency-Key on CreateBill keeps returning the bill it
+	// created; after that the same key creates a new bill
+	IdempotencyKeyTTLSeconds int
+
+	// Circuit breaker around read-path DB queries: trips after this many
+	// consecutive failures and fast-fails with Unavailable for the cooldown.
+	DBBreakerFailureThreshold int
+	DBBreakerCooldownSeconds  int
+
+	// Worker concurrency. Every activity holds a DB connection while it
+	// runs, so WorkerMaxConcurrentActivities should stay at or below the
+	// DB pool size (minus headroom for the API handlers' own queries);
+	// otherwise activities queue on the pool and time out in cascade.
+	WorkerMaxConcurrentActivities int
+	WorkerActivityPollers         int
+
+	// Workflow tasks (replays and signal handling) run concurrently; the
+	// SDK requires at least 2 for sticky execution
+	WorkerMaxConcurrentWorkflowTasks int
+
+	// On shutdown, how long running activities may finish before their
+	// contexts are cancelled (Shutdown's own deadline still applies)
+	WorkerStopTimeoutSeconds int
+
+	// Per-caller token bucket on CreateBill and AddLineItem: sustained
+	// requests per second and burst size. 0 per second disables it.
+	RateLimitPerSecond float64
+	RateLimitBurst     int
+
+	// Fat-finger guards per currency code, in minor units (scales differ,
+	// e.g. JPY has no minor unit): a single line item may not exceed
+	// MaxLineItemAmountMinor, and adds may not take a bill's running total
+	// above MaxBillTotalMinor. Currencies left out are uncapped.
+	MaxLineItemAmountMinor map[string]int64
+	MaxBillTotalMinor      map[string]int64
+
+	// At close the DB's item sum wins over the workflow's running total;
+	// a drift up to this many minor units is logged as a warning, anything
+	// larger as an error
+	CloseTotalDriftToleranceMinor int64
+
+	// Max line item description length, in characters after trimming
+	MaxDescriptionLength int
+
+	// Max bill memo length, in characters after trimming
+	MaxMemoLength int
+
+	// Max line items per bill, enforced by the API and the workflow (fixed
+	// per bill at creation)
+	MaxLineItems int
+
+	// Max items per BatchAddLineItems call. The batch travels as one signal
+	// (and one activity input), so it is also bounded by
+	// maxSignalPayloadBytes.
+	MaxBatchLineItems int
+
+	// Max bill IDs per POST /bills/batch-get call
+	MaxBatchGetBills int
+
+	// Signals a bill workflow handles before continuing as new (fixed per
+	// bill at creation)
+	ContinueAsNewAfterSignals int
+
+	// Max items returned per bill by GET /bills (item_count stays exact)
+	ListItemPreviewLimit int
+
+	// Page size for list endpoints when ?limit is unset, and its upper bound
+	DefaultPageLimit int
+	MaxPageLimit     int
+
+	// Budget for GET /bills/:id's single join; beyond it the client gets
+	// DeadlineExceeded and should page through the bill's items instead
+	DetailQueryTimeoutMs int
+
+	// Receives a POST with the final BillResult when a bill closes; empty
+	// disables the webhook
+	BillClosedWebhookURL string
+
+	// Closed totals are also converted into this currency and stored on
+	// the bill (fixed per bill at creation); empty disables conversion
+	BaseCurrency string
+
+	// Bills left OPEN longer than this many days are closed by the nightly
+	// auto-close job, AutoCloseBatchSize bills at a time; 0 disables it
+	AutoCloseAfterDays int
+	AutoCloseBatchSize int
+}
+
+var cfg = config.Load[*Config]()
+
+// validateConfig rejects nonsensical values at service init.
+func validateConfig(c *Config) error {
+	if c.TemporalHostPort != "" {
+		host, port, err := net.SplitHostPort(c.TemporalHostPort)
+		if err != nil || host == "" {
+			return fmt.Errorf("TemporalHostPort must be host:port, got %q", c.TemporalHostPort)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("TemporalHostPort has invalid port, got %q", c.TemporalHostPort)
+		}
+	}
+	if _, ok := workflowIDReusePolicies[c.WorkflowIDReusePolicy]; !ok {
+		return fmt.Errorf("WorkflowIDReusePolicy must be REJECT_DUPLICATE or ALLOW_DUPLICATE_FAILED_ONLY, got %q", c.WorkflowIDReusePolicy)
+	}
+	if c.TemporalDialRetrySeconds < 0 {
+		return fmt.Errorf("TemporalDialRetrySeconds must not be negative, got %d", c.TemporalDialRetrySeconds)
+	}
+	if c.IdempotencyKeyTTLSeconds <= 0 {
+		return fmt.Errorf("IdempotencyKeyTTLSeconds must be positive, got %d", c.IdempotencyKeyTTLSeconds)
+	}
+	if c.DBBreakerFailureThreshold <= 0 {
+		return fmt.Errorf("DBBreakerFailureThreshold must be positive, got %d", c.DBBreakerFailureThreshold)
+	}
+	if c.DBBreakerCooldownSeconds <= 0 {
+		return fmt.Errorf("DBBreakerCooldownSeconds must be positive, got %d", c.DBBreakerCooldownSeconds)
+	}
+	if c.WorkerMaxConcurrentActivities <= 0 {
+		return fmt.Errorf("WorkerMaxConcurrentActivities must be positive, got %d", c.WorkerMaxConcurrentActivities)
+	}
+	if c.WorkerActivityPollers <= 0 || c.WorkerActivityPollers > c.WorkerMaxConcurrentActivities {
+		return fmt.Errorf("WorkerActivityPollers must be in [1, WorkerMaxConcurrentActivities], got %d", c.WorkerActivityPollers)
+	}
+	if c.WorkerMaxConcurrentWorkflowTasks < 2 {
+		return fmt.Errorf("WorkerMaxConcurrentWorkflowTasks must be at least 2, got %d", c.WorkerMaxConcurrentWorkflowTasks)
+	}
+	if c.WorkerStopTimeoutSeconds < 0 {
+		return fmt.Errorf("WorkerStopTimeoutSeconds must not be negative, got %d", c.WorkerStopTimeoutSeconds)
+	}
+	if c.RateLimitPerSecond < 0 {
+		return fmt.Errorf("RateLimitPerSecond must not be negative, got %v", c.RateLimitPerSecond)
+	}
+	if c.RateLimitPerSecond > 0 && c.RateLimitBurst < 1 {
+		return fmt.Errorf("RateLimitBurst must be at least 1, got %d", c.RateLimitBurst)
+	}
+	for _, caps := range []struct {
+		name string
+		m    map[string]int64
+	}{{"MaxLineItemAmountMinor", c.MaxLineItemAmountMinor}, {"MaxBillTotalMinor", c.MaxBillTotalMinor}} {
+		for code, limit := range caps.m {
+			if !Currency(code).Valid() {
+				return fmt.Errorf("%s has unsupported currency %q", caps.name, code)
+			}
+			if limit <= 0 {
+				return fmt.Errorf("%s[%s] must be positive, got %d", caps.name, code, limit)
+			}
+		}
+	}
+	if c.CloseTotalDriftToleranceMinor < 0 {
+		return fmt.Errorf("CloseTotalDriftToleranceMinor must not be negative, got %d", c.CloseTotalDriftToleranceMinor)
+	}
+	if c.MaxDescriptionLength <= 0 {
+		return fmt.Errorf("MaxDescriptionLength must be positive, got %d", c.MaxDescriptionLength)
+	}
+	if c.MaxMemoLength <= 0 {
+		return fmt.Errorf("MaxMemoLength must be positive, got %d", c.MaxMemoLength)
+	}
+	if c.MaxLineItems <= 0 {
+		return fmt.Errorf("MaxLineItems must be positive, got %d", c.MaxLineItems)
+	}
+	if c.MaxBatchLineItems <= 0 {
+		return fmt.Errorf("MaxBatchLineItems must be positive, got %d", c.MaxBatchLineItems)
+	}
+	if c.MaxBatchGetBills <= 0 {
+		return fmt.Errorf("MaxBatchGetBills must be positive, got %d", c.MaxBatchGetBills)
+	}
+	if c.ContinueAsNewAfterSignals <= 0 {
+		return fmt.Errorf("ContinueAsNewAfterSignals must be positive, got %d", c.ContinueAsNewAfterSignals)
+	}
+	if c.ListItemPreviewLimit <= 0 {
+		return fmt.Errorf("ListItemPreviewLimit must be positive, got %d", c.ListItemPreviewLimit)
+	}
+	if c.DefaultPageLimit <= 0 || c.DefaultPageLimit > c.MaxPageLimit {
+		return fmt.Errorf("DefaultPageLimit must be in [1, MaxPageLimit=%d], got %d", c.MaxPageLimit, c.DefaultPageLimit)
+	}
+	if c.DetailQueryTimeoutMs <= 0 {
+		return fmt.Errorf("DetailQueryTimeoutMs must be positive, got %d", c.DetailQueryTimeoutMs)
+	}
+	if c.BaseCurrency != "" && !Currency(c.BaseCurrency).Valid() {
+		return fmt.Errorf("BaseCurrency must be a supported currency, got %q", c.BaseCurrency)
+	}
+	if c.AutoCloseAfterDays < 0 {
+		return fmt.Errorf("AutoCloseAfterDays must not be negative, got %d", c.AutoCloseAfterDays)
+	}
+	if c.AutoCloseBatchSize <= 0 {
+		return fmt.Errorf("AutoCloseBatchSize must be positive, got %d", c.AutoCloseBatchSize)
+	}
+	if c.BillClosedWebhookURL != "" {
+		u, err := url.Parse(c.BillClosedWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("BillClosedWebhookURL must be an http(s) URL, got %q", c.BillClosedWebhookURL)
+		}
+	}
+	return nil
+}
+
+const (
+	defaultTemporalHostPort  = "localhost:7233"
+	defaultTemporalNamespace = "default"
+	defaultTaskQueue         = "fees-billing"
+)
+
+func temporalHostPort() string {
+	if cfg.TemporalHostPort == "" {
+		return defaultTemporalHostPort
+	}
+	return cfg.TemporalHostPort
+}
+
+func temporalNamespace() string {
+	if cfg.TemporalNamespace == "" {
+		return defaultTemporalNamespace
+	}
+	return cfg.TemporalNamespace
+}
+
+func taskQueue() string {
+	if cfg.TaskQueue == "" {
+		return defaultTaskQueue
+	}
+	return cfg.TaskQueue
+}
+
+// Accepted WorkflowIDReusePolicy values. ALLOW_DUPLICATE is left out: it
+// would restart a closed bill's workflow over its final row.
+var workflowIDReusePolicies = map[string]enumspb.WorkflowIdReusePolicy{
+	"":                            enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+	"REJECT_DUPLICATE":            enumspb.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+	"ALLOW_DUPLICATE_FAILED_ONLY": enumspb.WORKFLOW_ID_REUSE_POLICY_ALLOW_DUPLICATE_FAILED_ONLY,
+}
+
+func workflowIDReusePolicy() enumspb.WorkflowIdReusePolicy {
+	return workflowIDReusePolicies[cfg.WorkflowIDReusePolicy]
+}
@@ -0,0 +1,193 @@
+package bill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev"
+	"encore.dev/beta/errs"
+)
+
+// Live bill events over Server-Sent Events. The stream tails the
+// bill_events audit trail (written by triggers in the same transaction as
+// each change), so it carries exactly what GET /bills/:id/events lists.
+const (
+	billEventsPollInterval = time.Second
+	billEventsHeartbeat    = 15 * time.Second
+
+	// bill_events IDs come from a sequence, so a transaction can commit a
+	// lower ID after a higher one is visible. Events younger than this are
+	// re-read on the next poll (and skipped if already sent) instead of
+	// moving the cursor past them.
+	billEventsSafetyLag = 5 * time.Second
+
+	billEventsPageSize = 100
+)
+
+// Events after which a bill changes no more; the stream ends with them.
+var finalBillEventTypes = map[string]bool{"closed": true, "voided": true, "deleted": true}
+
+// StreamBillEvents streams a bill's events as they commit, as SSE: one
+// "event: <type>" per change with the BillEventDTO as data and its ID as
+// the event ID, so a reconnecting EventSource resumes after Last-Event-ID.
+// A comment is sent every billEventsHeartbeat to keep proxies from timing
+// the stream out. It ends after the bill's closed, voided or deleted event,
+// or when the client goes away.
+//
+//encore:api auth raw method=GET path=/bills/:id/events/stream
+func (s *Service) StreamBillEvents(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id := encore.CurrentRequest().PathParams.Get("id")
+
+	if err := checkBillOwner(ctx, id); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	if _, _, err := getBillStatusAndCurrency(ctx, id); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	var afterID int64
+	if last := req.Header.Get("Last-Event-ID"); last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Msg("invalid Last-Event-ID").Err())
+			return
+		}
+		afterID = n
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errs.HTTPError(w, errs.B().Code(errs.Internal).Msg("streaming unsupported").Err())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	fetch := func(ctx context.Context, afterID int64) ([]*BillEvent, error) {
+		return listBillEvents(ctx, id, "", afterID, billEventsPageSize)
+	}
+	tail := billEventTail{
+		fetch:     fetch,
+		afterID:   afterID,
+		poll:      billEventsPollInterval,
+		heartbeat: billEventsHeartbeat,
+		lag:       billEventsSafetyLag,
+	}
+	// Headers are out, so errors can only be logged; the client reconnects
+	if err := tail.run(ctx, w, flusher.Flush); err != nil && ctx.Err() == nil {
+		billLog(id).Warn("bill event stream ended", "err", err)
+	}
+}
+
+// billEventTail polls a bill's events and writes them as SSE.
+type billEventTail struct {
+	fetch     func(ctx context.Context, afterID int64) ([]*BillEvent, error)
+	afterID   int64 // every event up to it was sent
+	poll      time.Duration
+	heartbeat time.Duration
+	lag       time.Duration
+	now       func() time.Time // nil is time.Now
+}
+
+// run writes events until a final one is sent, ctx is done or a write or
+// fetch fails.
+func (t *billEventTail) run(ctx context.Context, w io.Writer, flush func()) error {
+	now := t.now
+	if now == nil {
+		now = time.Now
+	}
+	sent := make(map[int64]bool) // above afterID, still inside the lag
+	lastWrite := now()
+
+	ticker := time.NewTicker(t.poll)
+	defer ticker.Stop()
+	for {
+		events, err := t.fetch(ctx, t.afterID)
+		if err != nil {
+			return err
+		}
+
+		settled := true
+		for _, e := range events {
+			if !sent[e.ID] {
+				if err := writeBillEvent(w, e); err != nil {
+					return err
+				}
+				flush()
+				lastWrite = now()
+				if finalBillEventTypes[e.Type] {
+					return nil
+				}
+				sent[e.ID] = true
+			}
+			// Advance the cursor only over a settled prefix: anything
+			// younger than the lag may still have a gap below it
+			if settled && now().Sub(e.CreatedAt) >= t.lag {
+				t.afterID = e.ID
+				delete(sent, e.ID)
+			} else {
+				settled = false
+			}
+		}
+
+		if len(events) == billEventsPageSize && settled {
+			continue // a backlog; read the next page straight away
+		}
+		if now().Sub(lastWrite) >= t.heartbeat {
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			flush()
+			lastWrite = now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// settledEventsPage trims events read in id order (up to limit+1 of them)
+// to a page of at most limit that stops before the first event younger than
+// billEventsSafetyLag. more is true when a further settled event follows.
+func settledEventsPage(events []*BillEvent, limit int, now time.Time) (page []*BillEvent, more bool) {
+	for i, e := range events {
+		if now.Sub(e.CreatedAt) < billEventsSafetyLag {
+			return events[:i], false
+		}
+		if i == limit {
+			return events[:limit], true
+		}
+	}
+	return events, false
+}
+
+// writeBillEvent writes one event in SSE framing.
+func writeBillEvent(w io.Writer, e *BillEvent) error {
+	data, err := json.Marshal(BillEventDTO{
+		ID:        e.ID,
+		Type:      e.Type,
+		Payload:   e.Payload,
+		CreatedAt: e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+	// Event types are fixed identifiers, but keep the framing intact anyway
+	typ := strings.NewReplacer("\n", "", "\r", "").Replace(e.Type)
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, typ, data)
+	return err
+}
@@ -0,0 +1,135 @@
+package bill
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEventLog serves bill_events pages the way listBillEvents does, with
+// rows becoming visible in the order commits are listed.
+type fakeEventLog struct {
+	commits [][]*BillEvent // visible after each fetch
+	visible []*BillEvent
+	fetches int
+}
+
+func (l *fakeEventLog) fetch(_ context.Context, afterID int64) ([]*BillEvent, error) {
+	if l.fetches < len(l.commits) {
+		l.visible = append(l.visible, l.commits[l.fetches]...)
+	}
+	l.fetches++
+	var out []*BillEvent
+	for _, e := range l.visible {
+		if e.ID > afterID {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID }) // like the query
+	return out, nil
+}
+
+func streamedIDs(out string) []string {
+	var ids []string
+	for _, line := range strings.Split(out, "\n") {
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestBillEventTailEndsOnClose(t *testing.T) {
+	now := time.Now()
+	log := &fakeEventLog{commits: [][]*BillEvent{
+		{{ID: 1, Type: "item_added", CreatedAt: now.Add(-time.Minute)}},
+		{{ID: 2, Type: "closed", CreatedAt: now.Add(-time.Minute)}},
+		{{ID: 3, Type: "memo_changed", CreatedAt: now.Add(-time.Minute)}},
+	}}
+	tail := billEventTail{fetch: log.fetch, poll: time.Millisecond, heartbeat: time.Hour, lag: time.Second}
+
+	var out bytes.Buffer
+	if err := tail.run(context.Background(), &out, func() {}); err != nil {
+		t.Fatalf("run = %v, want nil after the closed event", err)
+	}
+	if got := streamedIDs(out.String()); strings.Join(got, ",") != "1,2" {
+		t.Errorf("streamed ids %v, want [1 2]", got)
+	}
+	if !strings.Contains(out.String(), "event: closed\ndata: {\"id\":2,\"type\":\"closed\"") {
+		t.Errorf("closed event not framed as SSE:\n%s", out.String())
+	}
+}
+
+func TestBillEventTailOutOfOrderCommit(t *testing.T) {
+	now := time.Now()
+	// ID 2 commits first; ID 1 (an older transaction) becomes visible a
+	// poll later, while 2 is still inside the lag
+	log := &fakeEventLog{commits: [][]*BillEvent{
+		{{ID: 2, Type: "item_added", CreatedAt: now}},
+		{{ID: 1, Type: "item_added", CreatedAt: now}},
+		{{ID: 3, Type: "voided", CreatedAt: now}},
+	}}
+	tail := billEventTail{fetch: log.fetch, poll: time.Millisecond, heartbeat: time.Hour, lag: time.Minute,
+		now: func() time.Time { return now }}
+
+	var out bytes.Buffer
+	if err := tail.run(context.Background(), &out, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if got := streamedIDs(out.String()); strings.Join(got, ",") != "2,1,3" {
+		t.Errorf("streamed ids %v, want [2 1 3]: each once, none missed", got)
+	}
+}
+
+func TestBillEventTailHeartbeatAndDisconnect(t *testing.T) {
+	log := &fakeEventLog{}
+	tail := billEventTail{fetch: log.fetch, poll: time.Millisecond, heartbeat: 5 * time.Millisecond, lag: time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	err := tail.run(ctx, &out, func() {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run = %v, want the context's error once the client is gone", err)
+	}
+	if !strings.Contains(out.String(), ": heartbeat\n\n") {
+		t.Errorf("no heartbeat on an idle stream:\n%q", out.String())
+	}
+}
+
+func TestSettledEventsPage(t *testing.T) {
+	now := time.Now()
+	old, fresh := now.Add(-time.Minute), now.Add(-time.Second)
+	events := func(times ...time.Time) []*BillEvent {
+		out := make([]*BillEvent, len(times))
+		for i, at := range times {
+			out[i] = &BillEvent{ID: int64(i + 1), CreatedAt: at}
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		events   []*BillEvent
+		wantLen  int
+		wantMore bool
+	}{
+		{"last page exactly full", events(old, old), 2, false},
+		{"more after a full page", events(old, old, old), 2, true},
+		{"short page", events(old), 1, false},
+		{"stops at a young event", events(old, fresh, old), 1, false},
+		{"young event after a full page", events(old, old, fresh), 2, false},
+		{"nothing settled yet", events(fresh), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, more := settledEventsPage(tt.events, 2, now)
+			if len(page) != tt.wantLen || more != tt.wantMore {
+				t.Errorf("page of %d, more=%v; want %d, more=%v", len(page), more, tt.wantLen, tt.wantMore)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package bill
+
+import (
+	"fmt"
+	"math/big"
+
+	"encore.dev/beta/errs"
+)
+
+// FX rates are fixed-point integers: units of the target currency per unit
+// of the source (major units), times fxRateScale. Integer rates keep the
+// conversion exact and reproducible from the rate stored on the bill.
+const fxRateScale = 1_000_000
+
+// usdPerUnit is the static rate table: USD per major unit of each currency,
+// scaled by fxRateScale. Cross rates go through USD.
+var usdPerUnit = map[Currency]int64{
+	CurrencyUSD: 1_000_000,
+	CurrencyEUR: 1_080_000,
+	CurrencyGBP: 1_270_000,
+	CurrencyGEL: 370_000,
+	CurrencyJPY: 6_700,
+}
+
+// fxRate returns the scaled rate converting from -> to. Same-currency is
+// exactly 1.
+func fxRate(from, to Currency) (int64, error) {
+	if from == to {
+		return fxRateScale, nil
+	}
+	f, ok := usdPerUnit[from]
+	if !ok {
+		return 0, errs.B().Code(errs.InvalidArgument).Msgf("no FX rate for %s", from).Err()
+	}
+	t, ok := usdPerUnit[to]
+	if !ok {
+		return 0, errs.B().Code(errs.InvalidArgument).Msgf("no FX rate for %s", to).Err()
+	}
+	num := new(big.Int).Mul(big.NewInt(f), big.NewInt(fxRateScale))
+	return divRound(num, big.NewInt(t), RoundHalfUp).Int64(), nil
+}
+
+// convertMinor converts amountMinor at a scaled rate, adjusting for the two
+// currencies' minor units and rounding half-up.
+func convertMinor(amountMinor int64, from, to Currency, rate int64) (int64, error) {
+	num := new(big.Int).Mul(big.NewInt(amountMinor), big.NewInt(rate))
+	num.Mul(num, pow10(to.MinorUnits()))
+	den := new(big.Int).Mul(big.NewInt(fxRateScale), pow10(from.MinorUnits()))
+
+	out := divRound(num, den, RoundHalfUp)
+	if !out.IsInt64() {
+		return 0, errs.B().Code(errs.InvalidArgument).Msg("converted amount would overflow").Err()
+	}
+	return out.Int64(), nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// formatFXRate renders a scaled rate as a decimal, e.g. 1080000 -> "1.080000".
+func formatFXRate(rate int64) string {
+	return fmt.Sprintf("%d.%06d", rate/fxRateScale, rate%fxRateScale)
+}
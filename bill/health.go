@@ -0,0 +1,73 @@
+package bill
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"encore.dev/rlog"
+	"go.temporal.io/sdk/client"
+)
+
+// Each dependency check gets this long; probes should answer well within
+// the orchestrator's own timeout.
+const healthCheckTimeout = 2 * time.Second
+
+const (
+	healthOK   = "ok"
+	healthDown = "down"
+)
+
+type HealthResponse struct {
+	DB       string `json:"db"`       // ok | down
+	Temporal string `json:"temporal"` // ok | down
+
+	// Started without Temporal (TemporalDegradedStart) and not yet
+	// reconnected: reads work, workflow endpoints answer Unavailable
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// Health is the readiness probe: it pings Postgres and the Temporal
+// frontend and answers 200 only when both are reachable, else 503 with the
+// same body. A degraded instance only needs the DB, since serving reads
+// without Temporal is the point of the mode. It reads no bill data. Raw so
+// the body survives a non-200.
+//
+//encore:api public raw method=GET path=/bills/health
+func (s *Service) Health(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	out := HealthResponse{DB: healthOK, Temporal: healthOK, Degraded: s.degraded.Load()}
+	if err := pingDB(ctx); err != nil {
+		rlog.Warn("health check failed", "dependency", "db", "err", err)
+		out.DB = healthDown
+	}
+	if err := s.pingTemporal(ctx); err != nil {
+		rlog.Warn("health check failed", "dependency", "temporal", "err", err)
+		out.Temporal = healthDown
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if out.DB != healthOK || (out.Temporal != healthOK && !out.Degraded) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func pingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var one int
+	return db.QueryRow(ctx, `SELECT 1`).Scan(&one)
+}
+
+func (s *Service) pingTemporal(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	_, err := s.temporalClient.CheckHealth(ctx, &client.CheckHealthRequest{})
+	return err
+}
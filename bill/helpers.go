@@ -3,17 +3,499 @@ package bill
 import (
 	"context"
 	"database/sql"
-	"sort"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"encore.dev/beta/auth"
 	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
+	"github.com/google/uuid"
 )
 
 func workflowIDForBill(billID string) string {
 	return "bill-" + billID
 }
 
+// callerOwnerID is the tenant an API call acts for: the owner of the
+// caller's API key, or "" without one. Bills created before owner scoping
+// belong to "" too. Only meaningful inside an API handler; the worker gets
+// the owner from the workflow params instead.
+func callerOwnerID() string {
+	if d, ok := auth.Data().(*AuthData); ok {
+		return d.OwnerID
+	}
+	return ""
+}
+
+// checkBillOwner scopes a per-bill API call to the caller's tenant. Another
+// tenant's bill is reported NotFound, not PermissionDenied, so its
+// existence doesn't leak. A missing row passes: the handler's own lookup
+// reports it (or, right after CreateBill, the workflow checks the owner).
+func checkBillOwner(ctx context.Context, billID string) error {
+	var owner string
+	err := db.QueryRow(ctx, `SELECT owner_id FROM bills WHERE id = $1`, billID).Scan(&owner)
+	switch {
+	case errors.Is(err, sqldb.ErrNoRows):
+		return nil
+	case err != nil:
+		return errs.B().Code(errs.Internal).Msg("get bill owner").Err()
+	case owner != callerOwnerID():
+		return errBillNotFound()
+	}
+	return nil
+}
+
+// billLog tags logs with the bill and its workflow so an API call can be
+// followed into the workflow's activities by bill_id.
+// Inside an API call it also names the authenticated caller.
+func billLog(billID string) rlog.Ctx {
+	log := rlog.With("bill_id", billID, "workflow_id", workflowIDForBill(billID))
+	if uid, ok := auth.UserID(); ok {
+		log = log.With("caller", string(uid), "owner_id", callerOwnerID())
+	}
+	return log
+}
+
+// billIDNamespace scopes idempotency-key-derived bill IDs (UUIDv5).
+var billIDNamespace = uuid.MustParse("5b1f7c8e-3d0a-4f6e-9a51-2c7d8e4b9f10")
+
+// billIDForIdempotencyKey is the bill ID an Idempotency-Key mapped to before
+// claimIdempotencyKey recorded mappings; retries of those keys still land on
+// it while the bill is within the TTL.
+func billIDForIdempotencyKey(key string) string {
+	return uuid.NewSHA1(billIDNamespace, []byte(key)).String()
+}
+
+func billLocation(billID string) string {
+	return "/bills/" + billID
+}
+
+func lineItemLocation(billID, lineItemID string) string {
+	return billLocation(billID) + "/line-items/" + lineItemID
+}
+
+// billIDForWorkflow reverses workflowIDForBill; ok is false for other IDs.
+func billIDForWorkflow(workflowID string) (string, bool) {
+	return strings.CutPrefix(workflowID, "bill-")
+}
+
+const (
+	billRowWaitTimeout  = 5 * time.Second
+	billRowPollInterval = 50 * time.Millisecond
+)
+
+// waitForBillRow polls until CreateBillRowActivity has inserted the bill row.
+func waitForBillRow(ctx context.Context, billID string) error {
+	ctx, cancel := context.WithTimeout(ctx, billRowWaitTimeout)
+	defer cancel()
+
+	for {
+		if _, _, err := getBillStatusAndCurrency(ctx, billID); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errs.B().Code(errs.DeadlineExceeded).Msg("timed out waiting for bill row").Err()
+		case <-time.After(billRowPollInterval):
+		}
+	}
+}
+
+// waitForBillCurrency polls until SetCurrencyActivity has stored currency.
+func waitForBillCurrency(ctx context.Context, billID string, currency Currency) error {
+	ctx, cancel := context.WithTimeout(ctx, billRowWaitTimeout)
+	defer cancel()
+
+	for {
+		if _, c, err := getBillStatusAndCurrency(ctx, billID); err == nil && c == currency {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errs.B().Code(errs.DeadlineExceeded).Msg("timed out waiting for currency change").Err()
+		case <-time.After(billRowPollInterval):
+		}
+	}
+}
+
+// waitForBillMemo polls until SetMemoActivity has stored memo, failing
+// fast if the bill leaves OPEN first (the signal is then never handled).
+func waitForBillMemo(ctx context.Context, billID, memo string) error {
+	ctx, cancel := context.WithTimeout(ctx, billRowWaitTimeout)
+	defer cancel()
+
+	for {
+		var status BillStatus
+		var current string
+		err := db.QueryRow(ctx, `SELECT status, memo FROM bills WHERE id = $1`, billID).Scan(&status, &current)
+		if err == nil {
+			if current == memo {
+				return nil
+			}
+			if status != StatusOpen {
+				return errBillNotOpen(status)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errs.B().Code(errs.DeadlineExceeded).Msg("timed out waiting for memo change").Err()
+		case <-time.After(billRowPollInterval):
+		}
+	}
+}
+
+// waitForInvoice polls until IssueInvoiceActivity has stored the invoice.
+func waitForInvoice(ctx context.Context, invoiceID string) (*Invoice, error) {
+	ctx, cancel := context.WithTimeout(ctx, billRowWaitTimeout)
+	defer cancel()
+
+	for {
+		if inv, err := getInvoice(ctx, invoiceID); err == nil {
+			return inv, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errs.B().Code(errs.DeadlineExceeded).Msg("timed out waiting for invoice").Err()
+		case <-time.After(billRowPollInterval):
+		}
+	}
+}
+
+// ==============================
+// DB circuit breaker
+// ==============================
+
+var errCircuitOpen = errors.New("db circuit open")
+
+// circuitBreaker trips after cfg.DBBreakerFailureThreshold consecutive
+// failures and rejects calls for cfg.DBBreakerCooldownSeconds. After the
+// cooldown it half-opens: a single probe is let through, and its outcome
+// decides whether the breaker closes again or re-opens.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var dbBreaker = &circuitBreaker{}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(cb.openUntil) || cb.probing {
+		return false
+	}
+	cb.probing = true
+	return true
+}
+
+func (cb *circuitBreaker) record(ctx context.Context, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	// Caller cancelled or hit its own deadline (e.g. the detail-fetch
+	// timeout on a pathological bill): says nothing about DB health
+	if err != nil && ctx.Err() != nil {
+		cb.probing = false
+		return
+	}
+
+	if err == nil {
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		cb.probing = false
+		return
+	}
+
+	cb.failures++
+	if cb.probing || cb.failures >= cfg.DBBreakerFailureThreshold {
+		cb.openUntil = time.Now().Add(time.Duration(cfg.DBBreakerCooldownSeconds) * time.Second)
+		cb.probing = false
+	}
+}
+
+// guardedQuery runs db.Query through the breaker. A query that fails to
+// start is recorded at once; otherwise the outcome is recorded when the
+// rows are closed, so failures while reading them count too.
+func guardedQuery(ctx context.Context, query string, args ...interface{}) (*guardedRows, error) {
+	if !dbBreaker.allow() {
+		return nil, errCircuitOpen
+	}
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		dbBreaker.record(ctx, err)
+		return nil, err
+	}
+	return &guardedRows{rows: rows, ctx: ctx, cb: dbBreaker}, nil
+}
+
+// resultRows is the part of *sqldb.Rows that guardedRows wraps.
+type resultRows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close()
+}
+
+// guardedRows remembers the first Scan or Err failure (a timeout mid-stream
+// surfaces there, not from db.Query) and records it with the breaker on
+// Close, or success if there was none.
+type guardedRows struct {
+	rows   resultRows
+	ctx    context.Context
+	cb     *circuitBreaker
+	err    error
+	closed bool
+}
+
+func (r *guardedRows) Next() bool { return r.rows.Next() }
+
+func (r *guardedRows) Scan(dest ...interface{}) error {
+	return r.note(r.rows.Scan(dest...))
+}
+
+func (r *guardedRows) Err() error {
+	return r.note(r.rows.Err())
+}
+
+func (r *guardedRows) Close() {
+	r.rows.Close()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	// Callers may stop early without calling Err
+	r.note(r.rows.Err())
+	r.cb.record(r.ctx, r.err)
+}
+
+func (r *guardedRows) note(err error) error {
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+// readErr maps a guardedQuery error to an API error.
+func readErr(err error, msg string) error {
+	if errors.Is(err, errCircuitOpen) {
+		return errs.B().Code(errs.Unavailable).Msg("database temporarily unavailable, retry later").Err()
+	}
+	return errs.B().Code(errs.Internal).Msg(msg).Err()
+}
+
+// ReasonDetails is attached to business-rule errors so clients can branch on
+// Reason instead of matching the message.
+type ReasonDetails struct {
+	Reason string `json:"reason"`
+}
+
+func (ReasonDetails) ErrDetails() {}
+
+const (
+	ReasonBillNotFound     = "BILL_NOT_FOUND"
+	ReasonBillClosed       = "BILL_CLOSED"
+	ReasonBillVoid         = "BILL_VOID"
+	ReasonCurrencyMismatch = "CURRENCY_MISMATCH"
+	ReasonCurrencyLocked   = "CURRENCY_LOCKED"
+	ReasonItemLimit        = "ITEM_LIMIT_REACHED"
+	ReasonTotalOverflow    = "TOTAL_OVERFLOW"
+	ReasonTotalCeiling     = "TOTAL_CEILING"
+	ReasonCreditOverdraw   = "CREDIT_OVERDRAW"
+	ReasonRateLimited      = "RATE_LIMITED"
+	ReasonAmountLimit      = "AMOUNT_LIMIT"
+	ReasonDegraded         = "TEMPORAL_UNAVAILABLE"
+)
+
+func reasonErr(code errs.ErrCode, reason, msg string) error {
+	return errs.B().Code(code).Msg(msg).Details(ReasonDetails{Reason: reason}).Err()
+}
+
+func errBillNotFound() error {
+	return reasonErr(errs.NotFound, ReasonBillNotFound, "bill not found")
+}
+
+func errBillClosed() error {
+	return reasonErr(errs.FailedPrecondition, ReasonBillClosed, "bill is closed")
+}
+
+// errBillNotOpen reports a bill that has left OPEN, naming how it ended.
+func errBillNotOpen(status BillStatus) error {
+	if status == StatusVoid {
+		return reasonErr(errs.FailedPrecondition, ReasonBillVoid, "bill is void")
+	}
+	return errBillClosed()
+}
+
+// checkItemLimit rejects adding n items to a bill that already has count.
+func checkItemLimit(count, n int) error {
+	if count+n > cfg.MaxLineItems {
+		return reasonErr(errs.ResourceExhausted, ReasonItemLimit,
+			fmt.Sprintf("bill has %d of %d line items", count, cfg.MaxLineItems))
+	}
+	return nil
+}
+
+// lineItemAmountCap is the largest single line item (or credit, by
+// magnitude) allowed in c; false when c is uncapped.
+func lineItemAmountCap(c Currency) (int64, bool) {
+	limit, ok := cfg.MaxLineItemAmountMinor[string(c)]
+	return limit, ok && limit > 0
+}
+
+// checkLineItemAmount rejects a fat-fingered line item or credit.
+func checkLineItemAmount(c Currency, amount int64) error {
+	limit, ok := lineItemAmountCap(c)
+	if ok && (amount > limit || amount < -limit) {
+		return reasonErr(errs.InvalidArgument, ReasonAmountLimit,
+			fmt.Sprintf("line item amount exceeds the %s cap of %d minor units", c, limit))
+	}
+	return nil
+}
+
+// checkBillTotalCap rejects adding delta to a bill whose running
+// (uninvoiced) total is total when that would pass the currency's
+// MaxBillTotalMinor. Credits (delta <= 0) always pass.
+func checkBillTotalCap(c Currency, total, delta int64) error {
+	limit, ok := cfg.MaxBillTotalMinor[string(c)]
+	if ok && limit > 0 && delta > 0 && total > limit-delta {
+		return reasonErr(errs.FailedPrecondition, ReasonTotalCeiling,
+			fmt.Sprintf("bill total would exceed the %s cap of %d minor units", c, limit))
+	}
+	return nil
+}
+
+// checkLineItemUpdate applies both caps to changing an item's amount from
+// oldAmount to newAmount on a bill whose running total is total. A retry
+// of an update that already landed has no delta, so it passes.
+func checkLineItemUpdate(c Currency, total, oldAmount, newAmount int64) error {
+	if err := checkLineItemAmount(c, newAmount); err != nil {
+		return err
+	}
+	return checkBillTotalCap(c, total, newAmount-oldAmount)
+}
+
+// maxLineItemAmountCap is the loosest per-item cap across currencies, for
+// checks made before the bill's currency is known; false when any
+// currency is uncapped.
+func maxLineItemAmountCap() (int64, bool) {
+	var loosest int64
+	for _, c := range AllCurrencies() {
+		limit, ok := lineItemAmountCap(c)
+		if !ok {
+			return 0, false
+		}
+		if limit > loosest {
+			loosest = limit
+		}
+	}
+	return loosest, true
+}
+
+// Temporal rejects any single payload over 2 MB by default (and warns from
+// 512 KB); a batch's items travel as one signal, then again as the insert
+// activity's input and result. Staying under the warning threshold leaves
+// room for all three in the history.
+const maxSignalPayloadBytes = 512 * 1024
+
+// checkSignalPayload rejects a signal whose encoded form is too large to
+// send as one Temporal payload.
+func checkSignalPayload(sig interface{}) error {
+	b, err := json.Marshal(sig)
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("encode signal").Err()
+	}
+	if len(b) > maxSignalPayloadBytes {
+		return errs.B().Code(errs.InvalidArgument).
+			Msgf("request is %d bytes encoded; max is %d, split it into smaller batches", len(b), maxSignalPayloadBytes).Err()
+	}
+	return nil
+}
+
+// checkTenantCurrency rejects a currency outside a tenant's allowlist,
+// listing the allowed ones. An empty allowlist allows every currency.
+func checkTenantCurrency(allowed []Currency, c Currency) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	names := make([]string, len(allowed))
+	for i, a := range allowed {
+		if a == c {
+			return nil
+		}
+		names[i] = string(a)
+	}
+	var v violations
+	v.addEnum("currency", fmt.Sprintf("%s is not enabled for this tenant", c), names)
+	return v.err()
+}
+
+func errCurrencyMismatch() error {
+	return reasonErr(errs.FailedPrecondition, ReasonCurrencyMismatch, "currency mismatch")
+}
+
+// scanErr keeps API errors raised while scanning (e.g. invalidCurrency) and
+// maps anything else to Internal with msg.
+func scanErr(err error, msg string) error {
+	var apiErr *errs.Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return errs.B().Code(errs.Internal).Msg(msg).Err()
+}
+
+// invalidCurrency reports a stored currency the Go side doesn't know, which
+// the DB CHECK should make impossible. Fail loudly rather than serve it.
+func invalidCurrency(billID string, c Currency) error {
+	return errs.B().Code(errs.Internal).Msgf("bill %s has invalid currency %q", billID, c).Err()
+}
+
+// logInvalidCurrencies reports bills whose currency isn't one we support,
+// e.g. rows written around the CHECK constraint. Runs once at startup and
+// only logs; errors are logged too, never fatal.
+func logInvalidCurrencies(ctx context.Context) {
+	var valid []string
+	for _, c := range AllCurrencies() {
+		valid = append(valid, string(c))
+	}
+	rows, err := db.Query(ctx, `
+		SELECT id, currency FROM bills
+		WHERE currency <> ALL($1)
+		ORDER BY id
+		LIMIT 100
+	`, valid)
+	if err != nil {
+		rlog.Error("currency reconciliation query failed", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, currency string
+		if err := rows.Scan(&id, &currency); err != nil {
+			rlog.Error("currency reconciliation scan failed", "err", err)
+			return
+		}
+		rlog.Error("bill has invalid currency", "bill_id", id, "currency", currency)
+	}
+}
+
 // ==============================
 // Response DTO shapes
 // ==============================
@@ -21,30 +503,245 @@ func workflowIDForBill(billID string) string {
 type MoneyDTO struct {
 	AmountMinor int64    `json:"amount_minor"`
 	Currency    Currency `json:"currency"`
+	MinorUnits  int      `json:"minor_units"` // decimal places: 2, or 0 for JPY
+	Display     string   `json:"display"`     // e.g. "1,234.56 USD", "1,000 JPY"
+}
+
+// Formatted renders a minor-unit amount in major units with the currency's
+// decimal places and en-US grouping: 123456 USD -> "1,234.56", -1000 JPY
+// -> "-1,000".
+func Formatted(amountMinor int64, currency Currency) string {
+	return formatMinor(amountMinor, currency.MinorUnits(), enUSNumbers)
+}
+
+// FormattedLocale is Formatted with the separators and grouping of locale
+// (a BCP 47 tag such as "de-DE"); unknown or empty locales get en-US.
+func FormattedLocale(amountMinor int64, currency Currency, locale string) string {
+	return formatMinor(amountMinor, currency.MinorUnits(), localeNumberFormat(locale))
+}
+
+// numberFormat is how a locale writes a number: its group and decimal
+// separators, and whether it groups Indian-style (12,34,567: threes, then
+// twos).
+type numberFormat struct {
+	group   string
+	decimal string
+	indian  bool
+}
+
+var enUSNumbers = numberFormat{group: ",", decimal: "."}
+
+// Keyed by lowercase language, or language-region where the region writes
+// numbers differently. Only locales that group from four digits on are
+// listed; the rest fall back to en-US.
+var numberFormats = map[string]numberFormat{
+	"en":    enUSNumbers,
+	"ja":    enUSNumbers,
+	"ko":    enUSNumbers,
+	"zh":    enUSNumbers,
+	"de":    {group: ".", decimal: ","},
+	"it":    {group: ".", decimal: ","},
+	"nl":    {group: ".", decimal: ","},
+	"pt-br": {group: ".", decimal: ","},
+	"fr":    {group: "\u202f", decimal: ","}, // narrow no-break space
+	"ka":    {group: "\u00a0", decimal: ","}, // no-break space
+	"de-ch": {group: "’", decimal: "."},
+	"en-in": {group: ",", decimal: ".", indian: true},
+}
+
+// localeNumberFormat looks up a locale by its full tag, then its language.
+func localeNumberFormat(locale string) numberFormat {
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	if f, ok := numberFormats[tag]; ok {
+		return f
+	}
+	if lang, _, ok := strings.Cut(tag, "-"); ok {
+		if f, ok := numberFormats[lang]; ok {
+			return f
+		}
+	}
+	return enUSNumbers
+}
+
+// formatMinor renders amountMinor with scale decimal places (0 for JPY, 3
+// for the dinars) in format f.
+func formatMinor(amountMinor int64, scale int, f numberFormat) string {
+	// uint64 so math.MinInt64 negates cleanly
+	abs := uint64(amountMinor)
+	sign := ""
+	if amountMinor < 0 {
+		abs = -abs
+		sign = "-"
+	}
+
+	digits := strconv.FormatUint(abs, 10)
+	for len(digits) <= scale {
+		digits = "0" + digits
+	}
+	whole, frac := digits[:len(digits)-scale], digits[len(digits)-scale:]
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, r := range whole {
+		if i > 0 && groupsBefore(len(whole)-i, f.indian) {
+			b.WriteString(f.group)
+		}
+		b.WriteRune(r)
+	}
+	if scale > 0 {
+		b.WriteString(f.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// groupsBefore reports whether a group separator goes before the digit
+// that starts the last left digits of the whole part.
+func groupsBefore(left int, indian bool) bool {
+	if indian && left > 3 {
+		return (left-3)%2 == 0
+	}
+	return left%3 == 0
+}
+
+// ==============================
+// CSV export
+// ==============================
+
+// Rows between flushes of a streamed CSV export
+const csvFlushEvery = 200
+
+// csvAmount is Formatted without grouping, so spreadsheets read a number.
+func csvAmount(amountMinor int64, currency Currency) string {
+	return strings.ReplaceAll(Formatted(amountMinor, currency), ",", "")
+}
+
+// csvText defuses cells a spreadsheet would evaluate as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
 }
 
 type BillDTO struct {
-	ID        string     `json:"id"`
-	Status    BillStatus `json:"status"`
-	Currency  Currency   `json:"currency"`
-	Total     MoneyDTO   `json:"total"`
-	CreatedAt string     `json:"created_at"`
-	ClosedAt  *string    `json:"closed_at,omitempty"`
+	ID       string     `json:"id"`
+	Status   BillStatus `json:"status"`
+	Currency Currency   `json:"currency"`
+	Total    MoneyDTO   `json:"total"`
+
+	// Breakdown of total, set once the bill is closed
+	TaxRateBps    int   `json:"tax_rate_bps"`
+	SubtotalMinor int64 `json:"subtotal_minor"`
+	DiscountMinor int64 `json:"discount_minor"`
+	TaxMinor      int64 `json:"tax_minor"`
+
+	Memo string `json:"memo"` // empty when unset
+
+	// First Temporal run of the bill's workflow, for support lookups
+	RunID string `json:"run_id,omitempty"`
+
+	CreatedAt string  `json:"created_at"`
+	ClosedAt  *string `json:"closed_at,omitempty"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// ==============================
+// Opaque page cursors
+// ==============================
+
+// pageCursor is a keyset position: the (timestamp, id) of the last row seen.
+// ListBills only issues one for its default created_at DESC order.
+type pageCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	invalid := errs.B().Code(errs.InvalidArgument).Msg("invalid cursor").Err()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Time.IsZero() || c.ID == "" {
+		return nil, invalid
+	}
+	return &c, nil
+}
+
+// parseTimeParam parses an optional RFC3339 query param; empty yields nil.
+func parseTimeParam(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg(name + " must be RFC3339").Err()
+	}
+	return &t, nil
+}
+
+// pageLimit applies cfg.DefaultPageLimit to an unset limit and rejects
+// anything outside [1, cfg.MaxPageLimit].
+func pageLimit(requested int) (int, error) {
+	if requested == 0 {
+		return cfg.DefaultPageLimit, nil
+	}
+	if requested < 0 || requested > cfg.MaxPageLimit {
+		return 0, errs.B().Code(errs.InvalidArgument).Msgf("limit must be between 1 and %d", cfg.MaxPageLimit).Err()
+	}
+	return requested, nil
 }
 
 type LineItemDTO struct {
-	ID          string `json:"id"`
-	BillID      string `json:"bill_id"`
-	Description string `json:"description"`
-	AmountMinor int64  `json:"amount_minor"`
-	CreatedAt   string `json:"created_at"`
+	ID          string        `json:"id"`
+	BillID      string        `json:"bill_id"`
+	Description string        `json:"description"`
+	AmountMinor int64         `json:"amount_minor"`
+	CreatedAt   string        `json:"created_at"`
+	Proration   *ProrationDTO `json:"proration,omitempty"`
+	Kind        LineItemKind  `json:"kind"`     // user, or a system line: tax, discount, rounding
+	Category    string        `json:"category"` // "" when uncategorized
+}
+
+// LineItemGroupDTO is one category of GET /bills/:id?group_by=category.
+type LineItemGroupDTO struct {
+	Category  string        `json:"category"` // "" for uncategorized items
+	Subtotal  MoneyDTO      `json:"subtotal"`
+	ItemCount int           `json:"item_count"`
+	Items     []LineItemDTO `json:"items"`
+}
+
+type InvoiceDTO struct {
+	ID        string        `json:"id"`
+	BillID    string        `json:"bill_id"`
+	Total     MoneyDTO      `json:"total"`
+	CreatedAt string        `json:"created_at"`
+	Items     []LineItemDTO `json:"items,omitempty"` // omitted in listings
+}
+
+type ProrationDTO struct {
+	PeriodStart     string       `json:"period_start"`
+	PeriodEnd       string       `json:"period_end"`
+	CoveredStart    string       `json:"covered_start"`
+	CoveredEnd      string       `json:"covered_end"`
+	FullAmountMinor int64        `json:"full_amount_minor"`
+	Rounding        RoundingMode `json:"rounding"`
 }
 
 // ==============================
 // DTO mappers
 // ==============================
 
-func billToDTO(b *Bill) BillDTO {
+// billToDTO formats the total's display string for locale ("" is en-US).
+func billToDTO(b *Bill, locale string) BillDTO {
 	var closedAtStr *string
 	if b.ClosedAt != nil {
 		s := b.ClosedAt.UTC().Format(time.RFC3339Nano)
@@ -52,16 +749,38 @@ func billToDTO(b *Bill) BillDTO {
 	}
 
 	return BillDTO{
-		ID:       b.ID,
-		Status:   b.Status,
-		Currency: b.Currency,
+		ID:            b.ID,
+		Status:        b.Status,
+		Currency:      b.Currency,
+		Total:         moneyToDTO(b.TotalMinor, b.Currency, locale),
+		TaxRateBps:    b.TaxRateBps,
+		SubtotalMinor: b.SubtotalMinor,
+		DiscountMinor: b.DiscountMinor,
+		TaxMinor:      b.TaxMinor,
+		Memo:          b.Memo,
+		RunID:         b.RunID,
+		CreatedAt:     b.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ClosedAt:      closedAtStr,
+		UpdatedAt:     b.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func invoiceToDTO(inv *Invoice) InvoiceDTO {
+	dto := InvoiceDTO{
+		ID:     inv.ID,
+		BillID: inv.BillID,
 		Total: MoneyDTO{
-			AmountMinor: b.TotalMinor,
-			Currency:    b.Currency,
+			AmountMinor: inv.TotalMinor,
+			Currency:    inv.Currency,
+			MinorUnits:  inv.Currency.MinorUnits(),
+			Display:     Formatted(inv.TotalMinor, inv.Currency) + " " + string(inv.Currency),
 		},
-		CreatedAt: b.CreatedAt.UTC().Format(time.RFC3339Nano),
-		ClosedAt:  closedAtStr,
+		CreatedAt: inv.CreatedAt.UTC().Format(time.RFC3339Nano),
 	}
+	if inv.Items != nil {
+		dto.Items = lineItemsToDTOs(inv.Items)
+	}
+	return dto
 }
 
 func lineItemsToDTOs(items []*LineItem) []LineItemDTO {
@@ -76,47 +795,98 @@ func lineItemsToDTOs(items []*LineItem) []LineItemDTO {
 			Description: li.Description,
 			AmountMinor: li.AmountMinor,
 			CreatedAt:   li.CreatedAt.UTC().Format(time.RFC3339Nano),
+			Proration:   prorationToDTO(li.Proration),
+			Kind:        lineItemKindOrUser(li.Kind),
+			Category:    li.Category,
 		})
 	}
 	return out
 }
 
-// ==============================
-// Join-based store function
-// ==============================
+// groupLineItemsByCategory groups items by category, in order of each
+// category's first item, and returns the groups with the sum of their
+// subtotals.
+func groupLineItemsByCategory(items []LineItemDTO, c Currency, locale string) ([]LineItemGroupDTO, MoneyDTO) {
+	var groups []LineItemGroupDTO
+	index := make(map[string]int)
+	var subtotals []int64
+	var total int64
+	for _, li := range items {
+		i, ok := index[li.Category]
+		if !ok {
+			i = len(groups)
+			index[li.Category] = i
+			groups = append(groups, LineItemGroupDTO{Category: li.Category})
+			subtotals = append(subtotals, 0)
+		}
+		groups[i].Items = append(groups[i].Items, li)
+		groups[i].ItemCount++
+		subtotals[i] += li.AmountMinor
+		total += li.AmountMinor
+	}
+	for i := range groups {
+		groups[i].Subtotal = moneyToDTO(subtotals[i], c, locale)
+	}
+	return groups, moneyToDTO(total, c, locale)
+}
 
-func listBillsWithItemsJoin(ctx context.Context, status *BillStatus) ([]*Bill, map[string][]*LineItem, error) {
-	var (
-		rows *sqldb.Rows
-		err  error
-	)
+func moneyToDTO(amount int64, c Currency, locale string) MoneyDTO {
+	return MoneyDTO{
+		AmountMinor: amount,
+		Currency:    c,
+		MinorUnits:  c.MinorUnits(),
+		Display:     FormattedLocale(amount, c, locale) + " " + string(c),
+	}
+}
 
-	if status == nil {
-		rows, err = db.Query(ctx, `
-			SELECT
-				b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at,
-				li.id, li.bill_id, li.description, li.amount_minor, li.created_at
-			FROM bills b
-			LEFT JOIN bill_line_items li ON li.bill_id = b.id
-			ORDER BY b.created_at DESC, li.created_at ASC
-		`)
-	} else {
-		rows, err = db.Query(ctx, `
-			SELECT
-				b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at,
-				li.id, li.bill_id, li.description, li.amount_minor, li.created_at
-			FROM bills b
-			LEFT JOIN bill_line_items li ON li.bill_id = b.id
-			WHERE b.status = $1
-			ORDER BY b.created_at DESC, li.created_at ASC
-		`, *status)
+// lineItemKindOrUser fills in the kind of items held by workflows from
+// before the kind column, which are all user-added.
+func lineItemKindOrUser(k LineItemKind) LineItemKind {
+	if k == "" {
+		return LineItemKindUser
 	}
+	return k
+}
 
-	if err != nil {
-		return nil, nil, errs.B().Code(errs.Internal).Msg("list bills join").Err()
+func prorationToDTO(p *Proration) *ProrationDTO {
+	if p == nil {
+		return nil
 	}
-	defer rows.Close()
+	rounding := p.Rounding
+	if rounding == "" {
+		rounding = RoundHalfUp
+	}
+	return &ProrationDTO{
+		PeriodStart:     p.PeriodStart.UTC().Format(time.RFC3339Nano),
+		PeriodEnd:       p.PeriodEnd.UTC().Format(time.RFC3339Nano),
+		CoveredStart:    p.CoveredStart.UTC().Format(time.RFC3339Nano),
+		CoveredEnd:      p.CoveredEnd.UTC().Format(time.RFC3339Nano),
+		FullAmountMinor: p.FullAmountMinor,
+		Rounding:        rounding,
+	}
+}
+
+// decodeProration parses the nullable proration JSONB column.
+func decodeProration(raw []byte) (*Proration, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var p Proration
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ==============================
+// Join-based store function
+// ==============================
 
+// scanBillJoinRows folds bills ⟕ line items rows into bills (in row order)
+// and their items. Rows must select the bill columns, the bill's item count,
+// then the line item columns, as the join queries below do.
+func scanBillJoinRows(rows *guardedRows) ([]*Bill, map[string][]*LineItem, error) {
+	var bills []*Bill
 	billsByID := make(map[string]*Bill)
 	itemsByBill := make(map[string][]*LineItem)
 
@@ -129,6 +899,14 @@ func listBillsWithItemsJoin(ctx context.Context, status *BillStatus) ([]*Bill, m
 			bTotal     int64
 			bCreatedAt time.Time
 			bClosedAt  sql.NullTime
+			bUpdatedAt time.Time
+			bTaxRate   int
+			bSubtotal  int64
+			bDiscount  int64
+			bTax       int64
+			bMemo      string
+			bRunID     string
+			bItemCount int
 		)
 
 		// Line item columns (nullable because LEFT JOIN)
@@ -138,149 +916,1144 @@ func listBillsWithItemsJoin(ctx context.Context, status *BillStatus) ([]*Bill, m
 			liDesc      sql.NullString
 			liAmount    sql.NullInt64
 			liCreatedAt sql.NullTime
+			liProration []byte
+			liKind      sql.NullString
+			liCategory  sql.NullString
 		)
 
 		if err := rows.Scan(
-			&bID, &bStatus, &bCurrency, &bTotal, &bCreatedAt, &bClosedAt,
-			&liID, &liBillID, &liDesc, &liAmount, &liCreatedAt,
+			&bID, &bStatus, &bCurrency, &bTotal, &bCreatedAt, &bClosedAt, &bUpdatedAt,
+			&bTaxRate, &bSubtotal, &bDiscount, &bTax, &bMemo, &bRunID, &bItemCount,
+			&liID, &liBillID, &liDesc, &liAmount, &liCreatedAt, &liProration, &liKind, &liCategory,
 		); err != nil {
-			return nil, nil, errs.B().Code(errs.Internal).Msg("scan bills join").Err()
+			return nil, nil, err
 		}
 
 		// Create bill once
-		b, ok := billsByID[bID]
-		if !ok {
-			b = &Bill{
+		if _, ok := billsByID[bID]; !ok {
+			if !Currency(bCurrency).Valid() {
+				return nil, nil, invalidCurrency(bID, Currency(bCurrency))
+			}
+			b := &Bill{
 				ID:         bID,
 				Status:     BillStatus(bStatus),
 				Currency:   Currency(bCurrency),
 				TotalMinor: bTotal,
 				CreatedAt:  bCreatedAt,
+				UpdatedAt:  bUpdatedAt,
+				ItemCount:  bItemCount,
+
+				TaxRateBps:    bTaxRate,
+				SubtotalMinor: bSubtotal,
+				DiscountMinor: bDiscount,
+				TaxMinor:      bTax,
+				Memo:          bMemo,
+				RunID:         bRunID,
 			}
 			if bClosedAt.Valid {
 				b.ClosedAt = &bClosedAt.Time
 			}
 			billsByID[bID] = b
+			bills = append(bills, b)
 		}
 
 		// Add line item if present
 		if liID.Valid {
-			li := &LineItem{
+			proration, err := decodeProration(liProration)
+			if err != nil {
+				return nil, nil, err
+			}
+			itemsByBill[bID] = append(itemsByBill[bID], &LineItem{
 				ID:          liID.String,
 				BillID:      bID,
 				Description: liDesc.String,
 				AmountMinor: liAmount.Int64,
 				CreatedAt:   liCreatedAt.Time,
-			}
-			itemsByBill[bID] = append(itemsByBill[bID], li)
+				Proration:   proration,
+				Kind:        LineItemKind(liKind.String),
+				Category:    liCategory.String,
+			})
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return bills, itemsByBill, nil
+}
+
+// billFilter narrows the bills GET /bills lists. A nil Status matches every
+// status except VOID, since voided bills are never charged; ask for
+// status=VOID to see them.
+type billFilter struct {
+	OwnerID string // the caller's tenant; always applied
+
+	Status   *BillStatus
+	Currency *Currency
+
+	// created_at in [CreatedAfter, CreatedBefore)
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	// Soft-deleted bills are left out unless set
+	IncludeDeleted bool
 
-	// Convert map to slice and preserve ordering by created_at desc
-	bills := make([]*Bill, 0, len(billsByID))
-	for _, b := range billsByID {
-		bills = append(bills, b)
+	// Bills with a line item whose description contains this (matched
+	// literally, ignoring case); empty matches all
+	Search string
+}
+
+// likeEscaper makes LIKE wildcards in user input match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where appends the filter's values to args and returns the matching
+// conditions, numbered to follow the args already there.
+func (f billFilter) where(args []interface{}) ([]string, []interface{}) {
+	args = append(args, f.OwnerID)
+	conds := []string{"owner_id = $" + strconv.Itoa(len(args))}
+	if f.Status != nil {
+		args = append(args, *f.Status)
+		conds = append(conds, "status = $"+strconv.Itoa(len(args)))
+	} else {
+		conds = append(conds, "status <> '"+string(StatusVoid)+"'")
+	}
+	if !f.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if f.Currency != nil {
+		args = append(args, *f.Currency)
+		conds = append(conds, "currency = $"+strconv.Itoa(len(args)))
+	}
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		conds = append(conds, "created_at >= $"+strconv.Itoa(len(args)))
+	}
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		conds = append(conds, "created_at < $"+strconv.Itoa(len(args)))
+	}
+	if f.Search != "" {
+		// EXISTS so a bill with several matching items is listed once
+		args = append(args, likeEscaper.Replace(f.Search))
+		conds = append(conds, `EXISTS (
+				SELECT 1 FROM bill_line_items s
+				WHERE s.bill_id = bills.id AND s.description ILIKE '%' || $`+strconv.Itoa(len(args))+` || '%'
+			)`)
+	}
+	return conds, args
+}
+
+// Sort fields accepted by ListBills, mapped to their column. Only these
+// strings are ever interpolated into ORDER BY.
+var billSortColumns = map[string]string{
+	sortCreatedAt: "created_at",
+	sortTotal:     "total_minor",
+	sortClosedAt:  "closed_at",
+}
+
+const (
+	sortCreatedAt = "created_at"
+	sortTotal     = "total"
+	sortClosedAt  = "closed_at"
+
+	sortAsc  = "asc"
+	sortDesc = "desc"
+)
+
+// billSort orders a bill listing; the zero value is created_at DESC.
+type billSort struct {
+	By  string // key of billSortColumns
+	Dir string // sortAsc or sortDesc
+}
+
+func (o billSort) isDefault() bool {
+	return (o.By == "" || o.By == sortCreatedAt) && (o.Dir == "" || o.Dir == sortDesc)
+}
+
+// orderBy renders the ORDER BY terms for columns of table alias prefix
+// ("" or "b."). NULLs (open bills' closed_at) sort last in either
+// direction, and id breaks ties so pages are stable.
+func (o billSort) orderBy(prefix string) string {
+	col, ok := billSortColumns[o.By]
+	if !ok {
+		col = "created_at"
+	}
+	dir := "DESC"
+	if o.Dir == sortAsc {
+		dir = "ASC"
+	}
+	return prefix + col + " " + dir + " NULLS LAST, " + prefix + "id " + dir
+}
+
+// listBillsWithItemsJoin returns one page of bills in sort order (newest
+// first by default, id as the tie-breaker) with at most itemLimit items per
+// bill (a LATERAL preview). The page starts after the (created_at, id)
+// cursor when set, else at offset. Paging happens on bills before the join,
+// so a bill's preview is never cut off by the page boundary.
+// Bill.ItemCount is always the full count.
+func listBillsWithItemsJoin(ctx context.Context, f billFilter, sort billSort, after *pageCursor, limit, offset, itemLimit int) ([]*Bill, map[string][]*LineItem, error) {
+	args := []interface{}{itemLimit, limit, offset}
+	conds, args := f.where(args)
+	if after != nil {
+		args = append(args, after.Time, after.ID)
+		conds = append(conds, "(created_at, id) < ($"+strconv.Itoa(len(args)-1)+", $"+strconv.Itoa(len(args))+")")
+	}
+	cond := ""
+	if len(conds) > 0 {
+		cond = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := guardedQuery(ctx, `
+		WITH page AS (
+			SELECT id, status, currency, total_minor, created_at, closed_at, updated_at,
+				tax_rate_bps, subtotal_minor, discount_minor, tax_minor, memo, run_id
+			FROM bills
+			`+cond+`
+			ORDER BY `+sort.orderBy("")+`
+			LIMIT $2 OFFSET $3
+		)
+		SELECT
+			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at, b.updated_at,
+			b.tax_rate_bps, b.subtotal_minor, b.discount_minor, b.tax_minor, b.memo, COALESCE(b.run_id, ''),
+			(SELECT COUNT(*) FROM bill_line_items c WHERE c.bill_id = b.id),
+			li.id, li.bill_id, li.description, li.amount_minor, li.created_at, li.proration, li.kind, li.category
+		FROM page b
+		LEFT JOIN LATERAL (
+			SELECT id, bill_id, description, amount_minor, created_at, proration, kind, category, seq
+			FROM bill_line_items
+			WHERE bill_id = b.id
+			ORDER BY seq ASC
+			LIMIT $1
+		) li ON true
+		ORDER BY `+sort.orderBy("b.")+`, li.seq ASC
+	`, args...)
+	if err != nil {
+		return nil, nil, readErr(err, "list bills join")
+	}
+	defer rows.Close()
+
+	bills, itemsByBill, err := scanBillJoinRows(rows)
+	if err != nil {
+		return nil, nil, scanErr(err, "scan bills join")
 	}
-	sort.Slice(bills, func(i, j int) bool {
-		return bills[i].CreatedAt.After(bills[j].CreatedAt)
-	})
 
 	return bills, itemsByBill, nil
 }
 
-// One join for a single bill
+// countBills counts the bills listBillsWithItemsJoin pages over.
+func countBills(ctx context.Context, f billFilter) (int, error) {
+	conds, args := f.where(nil)
+	cond := ""
+	if len(conds) > 0 {
+		cond = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := guardedQuery(ctx, `SELECT COUNT(*) FROM bills `+cond, args...)
+	if err != nil {
+		return 0, readErr(err, "count bills")
+	}
+	defer rows.Close()
+
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, errs.B().Code(errs.Internal).Msg("scan bill count").Err()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, errs.B().Code(errs.Internal).Msg("count bills").Err()
+	}
+	return n, nil
+}
+
+// One join for a single bill, bounded by cfg.DetailQueryTimeoutMs so a bill
+// with a pathological number of items can't hold a connection for seconds.
 func getBillWithItemsJoin(ctx context.Context, billID string) (*Bill, []*LineItem, error) {
-	rows, err := db.Query(ctx, `
+	qctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DetailQueryTimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	// Only our own timeout maps to DeadlineExceeded, not the caller's
+	timedOut := func() bool {
+		return errors.Is(qctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	}
+	tooLarge := func() error {
+		return errs.B().Code(errs.DeadlineExceeded).Msg("bill too large to fetch in one request; page through its line items instead").Err()
+	}
+
+	rows, err := guardedQuery(qctx, `
 		SELECT
-			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at,
-			li.id, li.bill_id, li.description, li.amount_minor, li.created_at
+			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at, b.updated_at,
+			b.tax_rate_bps, b.subtotal_minor, b.discount_minor, b.tax_minor, b.memo, COALESCE(b.run_id, ''),
+			(SELECT COUNT(*) FROM bill_line_items c WHERE c.bill_id = b.id),
+			li.id, li.bill_id, li.description, li.amount_minor, li.created_at, li.proration, li.kind, li.category
 		FROM bills b
 		LEFT JOIN bill_line_items li ON li.bill_id = b.id
-		WHERE b.id = $1
-		ORDER BY li.created_at ASC
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+		ORDER BY li.seq ASC
 	`, billID)
 	if err != nil {
-		return nil, nil, errs.B().Code(errs.Internal).Msg("get bill join").Err()
+		if timedOut() {
+			return nil, nil, tooLarge()
+		}
+		return nil, nil, readErr(err, "get bill join")
 	}
 	defer rows.Close()
 
-	var (
-		bill  *Bill
-		items []*LineItem
-	)
+	bills, itemsByBill, err := scanBillJoinRows(rows)
+	if err != nil {
+		if timedOut() {
+			return nil, nil, tooLarge()
+		}
+		return nil, nil, scanErr(err, "scan bill join")
+	}
+	if len(bills) == 0 {
+		return nil, nil, errBillNotFound()
+	}
 
-	for rows.Next() {
-		// Bill columns
-		var (
-			bID        string
-			bStatus    string
-			bCurrency  string
-			bTotal     int64
-			bCreatedAt time.Time
-			bClosedAt  sql.NullTime
-		)
+	return bills[0], itemsByBill[billID], nil
+}
 
-		// Line item columns (nullable)
-		var (
-			liID        sql.NullString
-			liBillID    sql.NullString
-			liDesc      sql.NullString
-			liAmount    sql.NullInt64
-			liCreatedAt sql.NullTime
-		)
+// getBillsWithItemsJoin reads the given bills of one owner and all their
+// items in one join; IDs that don't match (missing, deleted or another
+// owner's) are simply absent. Bounded like getBillWithItemsJoin.
+func getBillsWithItemsJoin(ctx context.Context, ownerID string, ids []string) ([]*Bill, map[string][]*LineItem, error) {
+	qctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DetailQueryTimeoutMs)*time.Millisecond)
+	defer cancel()
 
-		if err := rows.Scan(
-			&bID, &bStatus, &bCurrency, &bTotal, &bCreatedAt, &bClosedAt,
-			&liID, &liBillID, &liDesc, &liAmount, &liCreatedAt,
-		); err != nil {
-			return nil, nil, errs.B().Code(errs.Internal).Msg("scan bill join").Err()
-		}
+	timedOut := func() bool {
+		return errors.Is(qctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+	}
+	tooLarge := func() error {
+		return errs.B().Code(errs.DeadlineExceeded).Msg("bills too large to fetch in one request; ask for fewer ids").Err()
+	}
 
-		// Create bill once
-		if bill == nil {
-			bill = &Bill{
-				ID:         bID,
-				Status:     BillStatus(bStatus),
-				Currency:   Currency(bCurrency),
-				TotalMinor: bTotal,
-				CreatedAt:  bCreatedAt,
-			}
-			if bClosedAt.Valid {
-				bill.ClosedAt = &bClosedAt.Time
-			}
+	rows, err := guardedQuery(qctx, `
+		SELECT
+			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at, b.updated_at,
+			b.tax_rate_bps, b.subtotal_minor, b.discount_minor, b.tax_minor, b.memo, COALESCE(b.run_id, ''),
+			(SELECT COUNT(*) FROM bill_line_items c WHERE c.bill_id = b.id),
+			li.id, li.bill_id, li.description, li.amount_minor, li.created_at, li.proration, li.kind, li.category
+		FROM bills b
+		LEFT JOIN bill_line_items li ON li.bill_id = b.id
+		WHERE b.id = ANY($1) AND b.owner_id = $2 AND b.deleted_at IS NULL
+		ORDER BY b.id, li.seq ASC
+	`, ids, ownerID)
+	if err != nil {
+		if timedOut() {
+			return nil, nil, tooLarge()
 		}
+		return nil, nil, readErr(err, "batch get bills join")
+	}
+	defer rows.Close()
 
-		// Add line item if present
-		if liID.Valid {
-			items = append(items, &LineItem{
-				ID:          liID.String,
-				BillID:      bID,
-				Description: liDesc.String,
-				AmountMinor: liAmount.Int64,
-				CreatedAt:   liCreatedAt.Time,
-			})
+	bills, itemsByBill, err := scanBillJoinRows(rows)
+	if err != nil {
+		if timedOut() {
+			return nil, nil, tooLarge()
 		}
+		return nil, nil, scanErr(err, "scan batch get bills join")
 	}
+	return bills, itemsByBill, nil
+}
 
-	if bill == nil {
-		return nil, nil, errs.B().Code(errs.NotFound).Msg("bill not found").Err()
+// updated_at is now() at the start of the writing transaction, so a slow
+// transaction can commit an updated_at older than one already visible.
+// The change feed leaves bills changed within this lag for a later sync
+// instead of moving the cursor past a gap that may still fill.
+const changedBillsSafetyLag = 5 * time.Second
+
+// listChangedBillsJoin returns up to limit bills whose updated_at is after
+// the marker (strictly after since, or after the (updated_at, id) cursor)
+// and older than changedBillsSafetyLag, ordered by change time, with all
+// their items.
+func listChangedBillsJoin(ctx context.Context, ownerID string, since time.Time, after *pageCursor, limit int) ([]*Bill, map[string][]*LineItem, error) {
+	cond, args := "owner_id = $1 AND updated_at > $2", []interface{}{ownerID, since}
+	if after != nil {
+		cond, args = "owner_id = $1 AND (updated_at, id) > ($2, $3)", []interface{}{ownerID, after.Time, after.ID}
 	}
+	args = append(args, changedBillsSafetyLag.Seconds())
+	cond += " AND updated_at <= now() - make_interval(secs => $" + strconv.Itoa(len(args)) + ")"
+	args = append(args, limit)
 
-	return bill, items, nil
+	rows, err := guardedQuery(ctx, `
+		WITH page AS (
+			SELECT id, status, currency, total_minor, created_at, closed_at, updated_at,
+				tax_rate_bps, subtotal_minor, discount_minor, tax_minor, memo, run_id
+			FROM bills
+			WHERE `+cond+` AND deleted_at IS NULL
+			ORDER BY updated_at ASC, id ASC
+			LIMIT $`+strconv.Itoa(len(args))+`
+		)
+		SELECT
+			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at, b.updated_at,
+			b.tax_rate_bps, b.subtotal_minor, b.discount_minor, b.tax_minor, b.memo, COALESCE(b.run_id, ''),
+			(SELECT COUNT(*) FROM bill_line_items c WHERE c.bill_id = b.id),
+			li.id, li.bill_id, li.description, li.amount_minor, li.created_at, li.proration, li.kind, li.category
+		FROM page b
+		LEFT JOIN bill_line_items li ON li.bill_id = b.id
+		ORDER BY b.updated_at ASC, b.id ASC, li.seq ASC
+	`, args...)
+	if err != nil {
+		return nil, nil, readErr(err, "list changed bills join")
+	}
+	defer rows.Close()
+
+	bills, itemsByBill, err := scanBillJoinRows(rows)
+	if err != nil {
+		return nil, nil, scanErr(err, "scan changed bills join")
+	}
+
+	return bills, itemsByBill, nil
+}
+
+// getBillSummary reads one bill and its item count without loading items.
+func getBillSummary(ctx context.Context, billID string) (*Bill, error) {
+	rows, err := guardedQuery(ctx, `
+		SELECT
+			b.id, b.status, b.currency, b.total_minor, b.created_at, b.closed_at, b.updated_at,
+			b.tax_rate_bps, b.subtotal_minor, b.discount_minor, b.tax_minor, b.rounding_mode, b.memo, COALESCE(b.run_id, ''), b.owner_id,
+			COALESCE(b.base_currency, ''), COALESCE(b.base_total_minor, 0), COALESCE(b.fx_rate_ppm, 0),
+			COUNT(li.id)
+		FROM bills b
+		LEFT JOIN bill_line_items li ON li.bill_id = b.id
+		WHERE b.id = $1 AND b.deleted_at IS NULL
+		GROUP BY b.id
+	`, billID)
+	if err != nil {
+		return nil, readErr(err, "get bill summary")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("get bill summary").Err()
+		}
+		return nil, errBillNotFound()
+	}
+
+	var b Bill
+	var closed sql.NullTime
+	if err := rows.Scan(&b.ID, &b.Status, &b.Currency, &b.TotalMinor, &b.CreatedAt, &closed, &b.UpdatedAt,
+		&b.TaxRateBps, &b.SubtotalMinor, &b.DiscountMinor, &b.TaxMinor, &b.RoundingMode, &b.Memo, &b.RunID, &b.OwnerID,
+		&b.BaseCurrency, &b.BaseTotalMinor, &b.FXRatePPM, &b.ItemCount); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("scan bill summary").Err()
+	}
+	if !b.Currency.Valid() {
+		return nil, invalidCurrency(b.ID, b.Currency)
+	}
+	if closed.Valid {
+		b.ClosedAt = &closed.Time
+	}
+	return &b, nil
 }
 
 func getBillStatusAndCurrency(ctx context.Context, billID string) (BillStatus, Currency, error) {
 	row := db.QueryRow(ctx, `
 		SELECT status, currency
 		FROM bills
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`, billID)
 
 	var status string
 	var currency string
 	if err := row.Scan(&status, &currency); err != nil {
-		return "", "", errs.B().Code(errs.NotFound).Msg("bill not found").Err()
+		if errors.Is(err, sqldb.ErrNoRows) {
+			return "", "", errBillNotFound()
+		}
+		billLog(billID).Error("get bill status failed", "err", err)
+		return "", "", errs.B().Code(errs.Internal).Msg("get bill status").Err()
+	}
+	if !Currency(currency).Valid() {
+		return "", "", invalidCurrency(billID, Currency(currency))
 	}
 
 	return BillStatus(status), Currency(currency), nil
 }
+
+// importBillTx inserts an imported bill and its items in one transaction.
+// Existing bill or line item IDs are rejected with AlreadyExists.
+func importBillTx(ctx context.Context, req *ImportBillRequest) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("begin import").Err()
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, `
+		INSERT INTO bills (id, status, currency, total_minor, subtotal_minor, created_at, closed_at, owner_id)
+		VALUES ($1, $2, $3, $4, $4, $5, $6, $7)
+		ON CONFLICT (id) DO NOTHING
+	`, req.ID, string(req.Status), string(req.Currency), req.TotalMinor, req.CreatedAt, req.ClosedAt, req.OwnerID)
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("import bill").Err()
+	}
+	if res.RowsAffected() == 0 {
+		return errs.B().Code(errs.AlreadyExists).Msg("bill already exists").Err()
+	}
+
+	// Payload order is insertion order, which fixes each item's seq
+	for _, it := range req.Items {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = req.CreatedAt
+		}
+
+		res, err := tx.Exec(ctx, `
+			INSERT INTO bill_line_items (id, bill_id, description, amount_minor, created_at, currency)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO NOTHING
+		`, it.ID, req.ID, it.Description, it.AmountMinor, createdAt, string(req.Currency))
+		if err != nil {
+			return errs.B().Code(errs.Internal).Msg("import line item").Err()
+		}
+		if res.RowsAffected() == 0 {
+			return errs.B().Code(errs.AlreadyExists).Msg("line item already exists").Err()
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errs.B().Code(errs.Internal).Msg("commit import").Err()
+	}
+	return nil
+}
+
+// listClosedBillIDsAfter pages CLOSED bill IDs in id order (keyset on id).
+func listClosedBillIDsAfter(ctx context.Context, afterID string, limit int) ([]string, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id FROM bills
+		WHERE status = 'CLOSED' AND id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list closed bills").Err()
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan closed bills").Err()
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list closed bills").Err()
+	}
+	return ids, nil
+}
+
+// recomputeClosedBillTotal rebuilds a CLOSED bill's total_minor (and its
+// breakdown) from its line items, discounts and tax rate, touching the row
+// only when the stored total differs; true if it did. Idempotent: a second
+// run finds nothing to correct.
+func recomputeClosedBillTotal(ctx context.Context, billID string) (bool, error) {
+	log := billLog(billID)
+
+	var (
+		subtotal   int64
+		taxRateBps int
+		rounding   RoundingMode
+	)
+	if err := db.QueryRow(ctx, `
+		SELECT
+			(SELECT COALESCE(SUM(amount_minor), 0)::bigint FROM bill_line_items
+			 WHERE bill_id = $1 AND invoice_id IS NULL),
+			COALESCE((SELECT tax_rate_bps FROM bills WHERE id = $1), 0),
+			COALESCE((SELECT rounding_mode FROM bills WHERE id = $1), 'HALF_UP')
+	`, billID).Scan(&subtotal, &taxRateBps, &rounding); err != nil {
+		log.Error("sum line items failed", "err", err)
+		return false, errs.B().Code(errs.Internal).Msg("sum line items").Err()
+	}
+	discounts, err := listDiscounts(ctx, billID)
+	if err != nil {
+		return false, err
+	}
+	discount, tax, total, err := billTotals(subtotal, discounts, taxRateBps, rounding)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := db.Exec(ctx, `
+		UPDATE bills
+		SET total_minor = $2, subtotal_minor = $3, discount_minor = $4, tax_minor = $5, updated_at = now()
+		WHERE id = $1 AND status = 'CLOSED' AND total_minor <> $2
+	`, billID, total, subtotal, discount, tax)
+	if err != nil {
+		log.Error("recompute total failed", "err", err)
+		return false, errs.B().Code(errs.Internal).Msg("recompute total").Err()
+	}
+	corrected := res.RowsAffected() > 0
+	if corrected {
+		log.Info("bill total corrected", "total_minor", total)
+	}
+	return corrected, nil
+}
+
+type billIDStatus struct {
+	ID     string
+	Status BillStatus
+}
+
+// listBillStatusesAfter pages (id, status) in id order (keyset on id).
+func listBillStatusesAfter(ctx context.Context, afterID string, limit int) ([]billIDStatus, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, status FROM bills
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list bill statuses").Err()
+	}
+	defer rows.Close()
+
+	var out []billIDStatus
+	for rows.Next() {
+		var b billIDStatus
+		if err := rows.Scan(&b.ID, &b.Status); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan bill statuses").Err()
+		}
+		out = append(out, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list bill statuses").Err()
+	}
+	return out, nil
+}
+
+// existingBillIDs returns the subset of ids that have a bill row.
+func existingBillIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	rows, err := db.Query(ctx, `SELECT id FROM bills WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("lookup bills").Err()
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool, len(ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan bills").Err()
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("lookup bills").Err()
+	}
+	return found, nil
+}
+
+type lineItemStats struct {
+	Count int
+	Min   int64
+	Max   int64
+	Avg   int64 // rounded half away from zero
+	Total int64
+}
+
+// getLineItemStats aggregates a bill's items (of one kind, unless kind is
+// empty) in one query; zeros when empty.
+func getLineItemStats(ctx context.Context, billID string, kind LineItemKind) (*lineItemStats, error) {
+	row := db.QueryRow(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(MIN(amount_minor), 0),
+			COALESCE(MAX(amount_minor), 0),
+			COALESCE(ROUND(AVG(amount_minor)), 0)::BIGINT,
+			COALESCE(SUM(amount_minor), 0)::BIGINT
+		FROM bill_line_items
+		WHERE bill_id = $1 AND ($2 = '' OR kind = $2)
+	`, billID, string(kind))
+
+	var st lineItemStats
+	if err := row.Scan(&st.Count, &st.Min, &st.Max, &st.Avg, &st.Total); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("line item stats").Err()
+	}
+	return &st, nil
+}
+
+type billReportRow struct {
+	Currency   Currency
+	Status     BillStatus
+	BillCount  int
+	TotalMinor int64
+}
+
+// getBillReport totals bills per (currency, status). Closed bills count
+// their charged total_minor; open ones have no total yet, so their items
+// are summed instead.
+func getBillReport(ctx context.Context, f billFilter) ([]billReportRow, error) {
+	conds, args := f.where(nil)
+	cond := ""
+	if len(conds) > 0 {
+		cond = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := guardedQuery(ctx, `
+		SELECT
+			b.currency, b.status, COUNT(*),
+			COALESCE(SUM(CASE WHEN b.status = 'CLOSED' THEN b.total_minor + inv.sum ELSE li.sum END), 0)::BIGINT
+		FROM (SELECT id, currency, status, total_minor FROM bills `+cond+`) b
+		LEFT JOIN LATERAL (
+			SELECT COALESCE(SUM(amount_minor), 0) AS sum
+			FROM bill_line_items
+			WHERE bill_id = b.id
+		) li ON true
+		LEFT JOIN LATERAL (
+			SELECT COALESCE(SUM(total_minor), 0) AS sum
+			FROM invoices
+			WHERE bill_id = b.id
+		) inv ON true
+		GROUP BY b.currency, b.status
+		ORDER BY b.currency, b.status
+	`, args...)
+	if err != nil {
+		return nil, readErr(err, "bill report")
+	}
+	defer rows.Close()
+
+	var out []billReportRow
+	for rows.Next() {
+		var r billReportRow
+		if err := rows.Scan(&r.Currency, &r.Status, &r.BillCount, &r.TotalMinor); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan bill report").Err()
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("bill report").Err()
+	}
+	return out, nil
+}
+
+// voidBillRow marks an OPEN bill VOID; false if it was not OPEN (or missing).
+func voidBillRow(ctx context.Context, billID, reason string) (bool, error) {
+	res, err := db.Exec(ctx, `
+		UPDATE bills
+		SET status = $2, void_reason = $3, closed_at = now(), updated_at = now()
+		WHERE id = $1 AND status = 'OPEN'
+	`, billID, string(StatusVoid), reason)
+	if err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("void bill").Err()
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// terminateBillRow records an admin termination: it voids the bill if it is
+// still OPEN and writes a terminated event with the reason and the status
+// it had, in one transaction. The triggers can't record it: a CLOSED bill's
+// row doesn't change.
+func terminateBillRow(ctx context.Context, billID, reason string) (voided bool, err error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("begin terminate").Err()
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow(ctx, `SELECT status FROM bills WHERE id = $1 FOR UPDATE`, billID).Scan(&previous)
+	if err == sqldb.ErrNoRows {
+		return false, errBillNotFound()
+	}
+	if err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("lock bill").Err()
+	}
+
+	if BillStatus(previous) == StatusOpen {
+		if _, err := tx.Exec(ctx, `
+			UPDATE bills
+			SET status = $2, void_reason = $3, closed_at = now(), updated_at = now()
+			WHERE id = $1
+		`, billID, string(StatusVoid), "terminated: "+reason); err != nil {
+			return false, errs.B().Code(errs.Internal).Msg("void bill").Err()
+		}
+		voided = true
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO bill_events (bill_id, type, payload)
+		VALUES ($1, 'terminated', jsonb_build_object('reason', $2::text, 'previous_status', $3::text))
+	`, billID, reason, previous); err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("record termination").Err()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("commit terminate").Err()
+	}
+	return voided, nil
+}
+
+// softDeleteBillRow sets deleted_at, voiding the bill first if it is still
+// OPEN; false if it was already deleted (or missing).
+func softDeleteBillRow(ctx context.Context, billID string) (bool, error) {
+	res, err := db.Exec(ctx, `
+		UPDATE bills
+		SET deleted_at = now(), updated_at = now(),
+			status = CASE WHEN status = 'OPEN' THEN $2 ELSE status END,
+			void_reason = CASE WHEN status = 'OPEN' THEN 'deleted' ELSE void_reason END,
+			closed_at = COALESCE(closed_at, now())
+		WHERE id = $1 AND deleted_at IS NULL
+	`, billID, string(StatusVoid))
+	if err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("delete bill").Err()
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// listLineItemsPage returns one page of a bill's items (of one kind,
+// unless kind is empty) in insertion order.
+func listLineItemsPage(ctx context.Context, billID string, kind LineItemKind, limit, offset int) ([]*LineItem, error) {
+	rows, err := guardedQuery(ctx, `
+		SELECT id, bill_id, description, amount_minor, created_at, proration, kind, category
+		FROM bill_line_items
+		WHERE bill_id = $1 AND ($4 = '' OR kind = $4)
+		ORDER BY created_at ASC, seq ASC
+		LIMIT $2 OFFSET $3
+	`, billID, limit, offset, string(kind))
+	if err != nil {
+		return nil, readErr(err, "list line items")
+	}
+	defer rows.Close()
+
+	var items []*LineItem
+	for rows.Next() {
+		var li LineItem
+		var rawProration []byte
+		if err := rows.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &rawProration, &li.Kind, &li.Category); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan line items").Err()
+		}
+		if li.Proration, err = decodeProration(rawProration); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("decode proration").Err()
+		}
+		items = append(items, &li)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list line items").Err()
+	}
+	return items, nil
+}
+
+// streamLineItems calls fn for each of a bill's items (of one kind, unless
+// kind is empty) in insertion order without holding them all in memory.
+func streamLineItems(ctx context.Context, billID string, kind LineItemKind, fn func(*LineItem) error) error {
+	rows, err := guardedQuery(ctx, `
+		SELECT id, bill_id, description, amount_minor, created_at, kind
+		FROM bill_line_items
+		WHERE bill_id = $1 AND ($2 = '' OR kind = $2)
+		ORDER BY seq ASC
+	`, billID, string(kind))
+	if err != nil {
+		return readErr(err, "stream line items")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var li LineItem
+		if err := rows.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &li.Kind); err != nil {
+			return errs.B().Code(errs.Internal).Msg("scan line items").Err()
+		}
+		if err := fn(&li); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errs.B().Code(errs.Internal).Msg("stream line items").Err()
+	}
+	return nil
+}
+
+func countLineItems(ctx context.Context, billID string) (int, error) {
+	rows, err := guardedQuery(ctx, `SELECT COUNT(*) FROM bill_line_items WHERE bill_id = $1`, billID)
+	if err != nil {
+		return 0, readErr(err, "count line items")
+	}
+	defer rows.Close()
+
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, errs.B().Code(errs.Internal).Msg("scan line item count").Err()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, errs.B().Code(errs.Internal).Msg("count line items").Err()
+	}
+	return n, nil
+}
+
+// countUninvoicedLineItems counts the items no invoice has taken yet: the
+// ones the workflow still holds, which is what the item limit caps.
+func countUninvoicedLineItems(ctx context.Context, billID string) (int, error) {
+	var n int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM bill_line_items WHERE bill_id = $1 AND invoice_id IS NULL
+	`, billID).Scan(&n)
+	if err != nil {
+		return 0, errs.B().Code(errs.Internal).Msg("count line items").Err()
+	}
+	return n, nil
+}
+
+// uninvoicedTotalMinor sums the items no invoice has taken yet: the DB's
+// view of the workflow's running total.
+func uninvoicedTotalMinor(ctx context.Context, billID string) (int64, error) {
+	var total int64
+	err := db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(amount_minor), 0)::bigint
+		FROM bill_line_items WHERE bill_id = $1 AND invoice_id IS NULL
+	`, billID).Scan(&total)
+	if err != nil {
+		return 0, errs.B().Code(errs.Internal).Msg("sum line items").Err()
+	}
+	return total, nil
+}
+
+// lineItemExists reports whether the item exists and is still editable,
+// i.e. not frozen on an invoice.
+func lineItemExists(ctx context.Context, billID, lineItemID string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM bill_line_items
+			WHERE id = $1 AND bill_id = $2 AND invoice_id IS NULL
+		)
+	`, lineItemID, billID).Scan(&exists)
+	if err != nil {
+		return false, errs.B().Code(errs.Internal).Msg("lookup line item").Err()
+	}
+	return exists, nil
+}
+
+// editableLineItem returns an item no invoice has taken yet (description
+// and amount only), or nil when there is no such item.
+func editableLineItem(ctx context.Context, billID, lineItemID string) (*LineItem, error) {
+	li := &LineItem{ID: lineItemID, BillID: billID}
+	err := db.QueryRow(ctx, `
+		SELECT description, amount_minor FROM bill_line_items
+		WHERE id = $1 AND bill_id = $2 AND invoice_id IS NULL
+	`, lineItemID, billID).Scan(&li.Description, &li.AmountMinor)
+	if err == sqldb.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("lookup line item").Err()
+	}
+	return li, nil
+}
+
+// lineItemBillID returns the bill a line item belongs to, or "" if no item
+// has that ID.
+func lineItemBillID(ctx context.Context, lineItemID string) (string, error) {
+	var billID string
+	err := db.QueryRow(ctx, `
+		SELECT bill_id FROM bill_line_items WHERE id = $1
+	`, lineItemID).Scan(&billID)
+	if err == sqldb.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errs.B().Code(errs.Internal).Msg("lookup line item").Err()
+	}
+	return billID, nil
+}
+
+// listUninvoicedLineItems returns the items a close charges, in insertion
+// order; earlier ones were charged by invoices.
+func listUninvoicedLineItems(ctx context.Context, billID string) ([]*LineItem, error) {
+	return queryLineItems(ctx, "uninvoiced line items", `
+		SELECT id, bill_id, description, amount_minor, created_at, proration, kind, category
+		FROM bill_line_items
+		WHERE bill_id = $1 AND invoice_id IS NULL
+		ORDER BY seq ASC
+	`, billID)
+}
+
+func queryLineItems(ctx context.Context, what, query string, args ...interface{}) ([]*LineItem, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list " + what).Err()
+	}
+	defer rows.Close()
+
+	var items []*LineItem
+	for rows.Next() {
+		var li LineItem
+		var rawProration []byte
+		if err := rows.Scan(&li.ID, &li.BillID, &li.Description, &li.AmountMinor, &li.CreatedAt, &rawProration, &li.Kind, &li.Category); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan " + what).Err()
+		}
+		if li.Proration, err = decodeProration(rawProration); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("decode proration").Err()
+		}
+		items = append(items, &li)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list " + what).Err()
+	}
+	return items, nil
+}
+
+// listBillEvents returns up to limit of a bill's events after afterID, oldest
+// first, optionally of one type.
+func listBillEvents(ctx context.Context, billID, eventType string, afterID int64, limit int) ([]*BillEvent, error) {
+	rows, err := guardedQuery(ctx, `
+		SELECT id, bill_id, type, payload, created_at
+		FROM bill_events
+		WHERE bill_id = $1 AND id > $2 AND ($3 = '' OR type = $3)
+		ORDER BY id ASC
+		LIMIT $4
+	`, billID, afterID, eventType, limit)
+	if err != nil {
+		return nil, readErr(err, "list bill events")
+	}
+	defer rows.Close()
+
+	var out []*BillEvent
+	for rows.Next() {
+		var e BillEvent
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.BillID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan bill event").Err()
+		}
+		e.Payload = payload
+		out = append(out, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list bill events").Err()
+	}
+	return out, nil
+}
+
+// getInvoice returns an invoice with its frozen items, or NotFound.
+func getInvoice(ctx context.Context, invoiceID string) (*Invoice, error) {
+	var inv Invoice
+	err := db.QueryRow(ctx, `
+		SELECT id, bill_id, currency, total_minor, created_at
+		FROM invoices
+		WHERE id = $1
+	`, invoiceID).Scan(&inv.ID, &inv.BillID, &inv.Currency, &inv.TotalMinor, &inv.CreatedAt)
+	if err == sqldb.ErrNoRows {
+		return nil, errs.B().Code(errs.NotFound).Msg("invoice not found").Err()
+	}
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("get invoice").Err()
+	}
+
+	items, err := queryLineItems(ctx, "invoice items", `
+		SELECT id, bill_id, description, amount_minor, created_at, proration, kind, category
+		FROM bill_line_items
+		WHERE invoice_id = $1
+		ORDER BY seq ASC
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	inv.Items = items
+	return &inv, nil
+}
+
+// listInvoices returns a bill's invoices, oldest first, without items.
+func listInvoices(ctx context.Context, billID string) ([]*Invoice, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, bill_id, currency, total_minor, created_at
+		FROM invoices
+		WHERE bill_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, billID)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list invoices").Err()
+	}
+	defer rows.Close()
+
+	var out []*Invoice
+	for rows.Next() {
+		var inv Invoice
+		if err := rows.Scan(&inv.ID, &inv.BillID, &inv.Currency, &inv.TotalMinor, &inv.CreatedAt); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan invoice").Err()
+		}
+		out = append(out, &inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list invoices").Err()
+	}
+	return out, nil
+}
+
+// listDiscounts returns a bill's discounts in the order they were applied.
+func listDiscounts(ctx context.Context, billID string) ([]Discount, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, bill_id, type, value, created_at
+		FROM bill_discounts
+		WHERE bill_id = $1
+		ORDER BY created_at ASC, id ASC
+	`, billID)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list discounts").Err()
+	}
+	defer rows.Close()
+
+	var out []Discount
+	for rows.Next() {
+		var d Discount
+		if err := rows.Scan(&d.ID, &d.BillID, &d.Type, &d.Value, &d.CreatedAt); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan discount").Err()
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list discounts").Err()
+	}
+	return out, nil
+}
+
+// tenantCurrencies returns a tenant's currency allowlist, sorted; empty
+// when the tenant has none (every currency allowed).
+func tenantCurrencies(ctx context.Context, ownerID string) ([]Currency, error) {
+	rows, err := db.Query(ctx, `
+		SELECT currency FROM tenant_currencies WHERE owner_id = $1 ORDER BY currency
+	`, ownerID)
+	if err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list tenant currencies").Err()
+	}
+	defer rows.Close()
+
+	allowed := []Currency{}
+	for rows.Next() {
+		var c Currency
+		if err := rows.Scan(&c); err != nil {
+			return nil, errs.B().Code(errs.Internal).Msg("scan tenant currency").Err()
+		}
+		allowed = append(allowed, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errs.B().Code(errs.Internal).Msg("list tenant currencies").Err()
+	}
+	return allowed, nil
+}
+
+// setTenantCurrencies replaces a tenant's allowlist in one transaction;
+// an empty list removes it.
+func setTenantCurrencies(ctx context.Context, ownerID string, currencies []Currency) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("begin tx").Err()
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM tenant_currencies WHERE owner_id = $1`, ownerID); err != nil {
+		return errs.B().Code(errs.Internal).Msg("clear tenant currencies").Err()
+	}
+	for _, c := range currencies {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO tenant_currencies (owner_id, currency) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, ownerID, string(c)); err != nil {
+			return errs.B().Code(errs.Internal).Msg("insert tenant currency").Err()
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errs.B().Code(errs.Internal).Msg("commit tx").Err()
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package bill
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"encore.dev/beta/errs"
+	"github.com/google/uuid"
+)
+
+// errCode is errs.OK for a nil error.
+func errCode(err error) errs.ErrCode {
+	if err == nil {
+		return errs.OK
+	}
+	return errs.Code(err)
+}
+
+func TestLineItemAmountCap(t *testing.T) {
+	limit, ok := lineItemAmountCap(CurrencyUSD)
+	if !ok {
+		t.Fatal("USD has no line item cap configured")
+	}
+
+	tests := []struct {
+		name   string
+		amount int64
+		want   errs.ErrCode
+	}{
+		{"below cap", limit - 1, errs.OK},
+		{"at cap", limit, errs.OK},
+		{"over cap", limit + 1, errs.InvalidArgument},
+		{"credit at cap", -limit, errs.OK},
+		{"credit over cap", -limit - 1, errs.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errCode(checkLineItemAmount(CurrencyUSD, tt.amount)); got != tt.want {
+				t.Errorf("checkLineItemAmount(%d) = %v, want %v", tt.amount, got, tt.want)
+			}
+
+			req := &AddLineItemRequest{Description: "item", AmountMinor: tt.amount, Currency: CurrencyUSD}
+			if tt.amount < 0 {
+				return // adds must be positive; credits go through AddCreditRequest
+			}
+			if got := errCode(req.Validate()); got != tt.want {
+				t.Errorf("AddLineItemRequest.Validate(%d) = %v, want %v", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBillTotalCap(t *testing.T) {
+	limit, ok := cfg.MaxBillTotalMinor[string(CurrencyUSD)]
+	if !ok || limit <= 0 {
+		t.Fatal("USD has no bill total cap configured")
+	}
+
+	tests := []struct {
+		name  string
+		total int64
+		delta int64
+		want  errs.ErrCode
+	}{
+		{"to cap-1", limit - 101, 100, errs.OK},
+		{"to cap", limit - 100, 100, errs.OK},
+		{"to cap+1", limit - 99, 100, errs.FailedPrecondition},
+		{"credit over cap", limit + 50, -10, errs.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errCode(checkBillTotalCap(CurrencyUSD, tt.total, tt.delta)); got != tt.want {
+				t.Errorf("checkBillTotalCap(%d, %d) = %v, want %v", tt.total, tt.delta, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineItemUpdateCaps(t *testing.T) {
+	itemCap, _ := lineItemAmountCap(CurrencyUSD)
+	totalCap := cfg.MaxBillTotalMinor[string(CurrencyUSD)]
+
+	tests := []struct {
+		name      string
+		total     int64
+		oldAmount int64
+		newAmount int64
+		want      errs.ErrCode
+	}{
+		{"item to cap-1", 1000, 1000, itemCap - 1, errs.OK},
+		{"item to cap", 1000, 1000, itemCap, errs.OK},
+		{"item to cap+1", 1000, 1000, itemCap + 1, errs.InvalidArgument},
+		{"total to cap-1", totalCap - 1000, 1000, 1999, errs.OK},
+		{"total to cap", totalCap - 1000, 1000, 2000, errs.OK},
+		{"total to cap+1", totalCap - 1000, 1000, 2001, errs.FailedPrecondition},
+		{"lowering over cap", totalCap + 500, 1000, 10, errs.OK},
+		{"retry of landed update", totalCap, 1000, 1000, errs.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkLineItemUpdate(CurrencyUSD, tt.total, tt.oldAmount, tt.newAmount)
+			if got := errCode(err); got != tt.want {
+				t.Errorf("checkLineItemUpdate(%d, %d -> %d) = %v, want %v",
+					tt.total, tt.oldAmount, tt.newAmount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateLineItemRequestAmountCap(t *testing.T) {
+	limit, ok := maxLineItemAmountCap()
+	if !ok {
+		t.Fatal("some currency has no line item cap configured")
+	}
+	for _, tt := range []struct {
+		amount int64
+		want   errs.ErrCode
+	}{
+		{limit - 1, errs.OK},
+		{limit, errs.OK},
+		{limit + 1, errs.InvalidArgument},
+	} {
+		req := &UpdateLineItemRequest{AmountMinor: &tt.amount}
+		if got := errCode(req.Validate()); got != tt.want {
+			t.Errorf("UpdateLineItemRequest.Validate(%d) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFormattedLocale(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency Currency
+		locale   string
+		want     string
+	}{
+		{123456, CurrencyUSD, "", "1,234.56"},
+		{math.MaxInt64, CurrencyUSD, "", "92,233,720,368,547,758.07"},
+		{math.MinInt64, CurrencyUSD, "en-US", "-92,233,720,368,547,758.08"},
+		{5, CurrencyUSD, "", "0.05"},
+		{1234567890, CurrencyJPY, "", "1,234,567,890"},
+		{-1000, CurrencyJPY, "en-US", "-1,000"},
+		{999, CurrencyJPY, "", "999"},
+		{123456789012, CurrencyEUR, "de-DE", "1.234.567.890,12"},
+		{123456789012, CurrencyEUR, "de", "1.234.567.890,12"},
+		{123456789012, CurrencyEUR, "fr_FR", "1\u202f234\u202f567\u202f890,12"},
+		{123456789012, CurrencyGBP, "de-CH", "1’234’567’890.12"},
+		{123456789012, CurrencyUSD, "en-IN", "1,23,45,67,890.12"},
+		{1234567890, CurrencyJPY, "de-DE", "1.234.567.890"},
+		{123456, CurrencyGEL, "ka-GE", "1\u00a0234,56"},
+		{123456789012, CurrencyUSD, "xx-YY", "1,234,567,890.12"},
+	}
+	for _, tt := range tests {
+		if got := FormattedLocale(tt.amount, tt.currency, tt.locale); got != tt.want {
+			t.Errorf("FormattedLocale(%d, %s, %q) = %q, want %q", tt.amount, tt.currency, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestGroupLineItemsByCategory(t *testing.T) {
+	items := []LineItemDTO{
+		{ID: "1", AmountMinor: 1000, Category: "travel"},
+		{ID: "2", AmountMinor: 250},
+		{ID: "3", AmountMinor: 500, Category: "travel"},
+		{ID: "4", AmountMinor: 123456, Category: "hardware"},
+		{ID: "5", AmountMinor: -200, Category: "travel"}, // a credit
+	}
+	groups, total := groupLineItemsByCategory(items, CurrencyUSD, "de-DE")
+
+	want := []struct {
+		category string
+		subtotal int64
+		ids      string
+	}{
+		{"travel", 1300, "1,3,5"},
+		{"", 250, "2"},
+		{"hardware", 123456, "4"},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, w := range want {
+		g := groups[i]
+		var ids []string
+		for _, li := range g.Items {
+			ids = append(ids, li.ID)
+		}
+		if g.Category != w.category || g.Subtotal.AmountMinor != w.subtotal || strings.Join(ids, ",") != w.ids || g.ItemCount != len(ids) {
+			t.Errorf("group %d = %q %d [%s] (count %d), want %q %d [%s]",
+				i, g.Category, g.Subtotal.AmountMinor, strings.Join(ids, ","), g.ItemCount, w.category, w.subtotal, w.ids)
+		}
+	}
+	if total.AmountMinor != 125006 || total.Display != "1.250,06 USD" {
+		t.Errorf("total = %d %q, want 125006 \"1.250,06 USD\"", total.AmountMinor, total.Display)
+	}
+
+	if groups, total := groupLineItemsByCategory(nil, CurrencyJPY, ""); len(groups) != 0 || total.AmountMinor != 0 {
+		t.Errorf("no items: %d groups, total %d; want none, 0", len(groups), total.AmountMinor)
+	}
+}
+
+// No supported currency has three decimals yet; the formatter takes the
+// scale, so the dinars' grouping is checked directly.
+func TestFormatMinorThreeDecimals(t *testing.T) {
+	tests := []struct {
+		amount int64
+		f      numberFormat
+		want   string
+	}{
+		{1234567, enUSNumbers, "1,234.567"},
+		{-1234567890123, enUSNumbers, "-1,234,567,890.123"},
+		{7, enUSNumbers, "0.007"},
+		{1234567890123, localeNumberFormat("de-DE"), "1.234.567.890,123"},
+		{1234567890123, localeNumberFormat("en-IN"), "1,23,45,67,890.123"},
+	}
+	for _, tt := range tests {
+		if got := formatMinor(tt.amount, 3, tt.f); got != tt.want {
+			t.Errorf("formatMinor(%d, 3) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTenantCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []Currency
+		currency Currency
+		want     errs.ErrCode
+	}{
+		{"no allowlist", nil, CurrencyJPY, errs.OK},
+		{"allowed", []Currency{CurrencyEUR, CurrencyUSD}, CurrencyUSD, errs.OK},
+		{"disallowed", []Currency{CurrencyEUR, CurrencyUSD}, CurrencyGEL, errs.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errCode(checkTenantCurrency(tt.allowed, tt.currency)); got != tt.want {
+				t.Errorf("checkTenantCurrency(%v, %s) = %v, want %v", tt.allowed, tt.currency, got, tt.want)
+			}
+		})
+	}
+
+	err := checkTenantCurrency([]Currency{CurrencyEUR, CurrencyUSD}, CurrencyGEL)
+	details, ok := errs.Details(err).(ValidationDetails)
+	if !ok || len(details.Violations) != 1 {
+		t.Fatalf("details = %#v, want one violation", errs.Details(err))
+	}
+	if got := details.Violations[0].Accepted; len(got) != 2 || got[0] != "EUR" || got[1] != "USD" {
+		t.Errorf("accepted = %v, want [EUR USD]", got)
+	}
+}
+
+// Runs against the test database encore test provisions.
+// fakeRows is one row whose Scan fails with scanErr, then iterErr.
+type fakeRows struct {
+	scanErr, iterErr error
+	read             bool
+}
+
+func (r *fakeRows) Next() bool {
+	if r.read {
+		return false
+	}
+	r.read = true
+	return true
+}
+func (r *fakeRows) Scan(...interface{}) error { return r.scanErr }
+func (r *fakeRows) Err() error                { return r.iterErr }
+func (r *fakeRows) Close()                    {}
+
+func TestGuardedRowsRecordReadFailures(t *testing.T) {
+	readFailure := errors.New("connection reset")
+	tests := []struct {
+		name string
+		rows *fakeRows
+		read func(*guardedRows)
+		trip bool
+	}{
+		{"scan fails", &fakeRows{scanErr: readFailure}, func(r *guardedRows) { r.Next(); r.Scan() }, true},
+		{"iteration fails, caller checks Err", &fakeRows{iterErr: readFailure}, func(r *guardedRows) { r.Next(); r.Err() }, true},
+		{"iteration fails, caller stops early", &fakeRows{iterErr: readFailure}, func(r *guardedRows) {}, true},
+		{"rows read cleanly", &fakeRows{}, func(r *guardedRows) { r.Next(); r.Scan(); r.Err() }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := &circuitBreaker{}
+			for i := 0; i < cfg.DBBreakerFailureThreshold; i++ {
+				rows := *tt.rows
+				r := &guardedRows{rows: &rows, ctx: context.Background(), cb: cb}
+				tt.read(r)
+				r.Close()
+				r.Close() // recorded once
+			}
+			want := 0
+			if tt.trip {
+				want = cfg.DBBreakerFailureThreshold
+			}
+			if cb.failures != want {
+				t.Errorf("failures = %d after %d queries, want %d", cb.failures, cfg.DBBreakerFailureThreshold, want)
+			}
+			if open := !cb.allow(); open != tt.trip {
+				t.Errorf("breaker open = %v, want %v", open, tt.trip)
+			}
+		})
+	}
+}
+
+func TestTenantCurrenciesPerTenant(t *testing.T) {
+	ctx := context.Background()
+	euro, open := "tenant-"+uuid.NewString(), "tenant-"+uuid.NewString()
+
+	if err := setTenantCurrencies(ctx, euro, []Currency{CurrencyGBP, CurrencyEUR}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		owner    string
+		currency Currency
+		want     errs.ErrCode
+	}{
+		{euro, CurrencyEUR, errs.OK},
+		{euro, CurrencyGBP, errs.OK},
+		{euro, CurrencyUSD, errs.InvalidArgument},
+		{open, CurrencyUSD, errs.OK},
+		{open, CurrencyJPY, errs.OK},
+	} {
+		allowed, err := tenantCurrencies(ctx, tt.owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := errCode(checkTenantCurrency(allowed, tt.currency)); got != tt.want {
+			t.Errorf("%s in %s = %v, want %v", tt.owner, tt.currency, got, tt.want)
+		}
+	}
+
+	// Clearing the allowlist allows everything again
+	if err := setTenantCurrencies(ctx, euro, nil); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := tenantCurrencies(ctx, euro); err != nil || len(allowed) != 0 {
+		t.Errorf("after clearing = (%v, %v), want no allowlist", allowed, err)
+	}
+}
+
+// Runs against the test database encore test provisions.
+func TestBatchInsertReadsInInsertionOrder(t *testing.T) {
+	ctx := context.Background()
+	billID := "bill-" + uuid.NewString()
+	if _, err := db.Exec(ctx, `INSERT INTO bills (id, status, currency) VALUES ($1, 'OPEN', 'USD')`, billID); err != nil {
+		t.Fatal(err)
+	}
+
+	// One statement, as AddLineItemsActivity inserts a batch: every row
+	// shares created_at, and the IDs sort opposite to insertion order
+	want := []string{billID + "-e", billID + "-d", billID + "-c", billID + "-b", billID + "-a"}
+	if _, err := db.Exec(ctx, `
+		INSERT INTO bill_line_items (id, bill_id, description, amount_minor)
+		VALUES ($1, $6, 'e', 1), ($2, $6, 'd', 1), ($3, $6, 'c', 1), ($4, $6, 'b', 1), ($5, $6, 'a', 1)
+	`, want[0], want[1], want[2], want[3], want[4], billID); err != nil {
+		t.Fatal(err)
+	}
+
+	for read := 0; read < 5; read++ {
+		_, items, err := getBillWithItemsJoin(ctx, billID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != len(want) {
+			t.Fatalf("read %d: %d items, want %d", read, len(items), len(want))
+		}
+		for i, li := range items {
+			if li.ID != want[i] {
+				t.Fatalf("read %d: item %d is %s, want %s (insertion order)", read, i, li.ID, want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package bill
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/google/uuid"
+)
+
+// Idempotency-Key mappings: (owner, key) -> bill, kept for
+// IdempotencyKeyTTLSeconds. A replay within the TTL gets the original bill;
+// after it the key starts a new one. The hourly sweep deletes expired rows
+// so the table stays bounded.
+
+func idempotencyKeyTTL() time.Duration {
+	return time.Duration(cfg.IdempotencyKeyTTLSeconds) * time.Second
+}
+
+// idempotencyKeyHash is what the table stores; keys are client-chosen and
+// unbounded in length.
+func idempotencyKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey maps key to a bill for ownerID as of now. It returns
+// the bill ID the key maps to and whether this call claimed it (a new or
+// expired key, so the caller starts the bill) rather than replaying it.
+//
+// Keys used before mappings were recorded derived the bill ID straight from
+// the key; while such a bill is within the TTL, a retry keeps mapping onto
+// it, and Temporal's workflow ID uniqueness makes the start a replay.
+func claimIdempotencyKey(ctx context.Context, ownerID, key string, now time.Time, ttl time.Duration) (string, bool, error) {
+	candidate := uuid.New().String()
+	createdAt := now
+	var legacyCreatedAt time.Time
+	err := db.QueryRow(ctx, `
+		SELECT created_at FROM bills WHERE id = $1 AND owner_id = $2
+	`, billIDForIdempotencyKey(key), ownerID).Scan(&legacyCreatedAt)
+	switch {
+	case err == sqldb.ErrNoRows:
+	case err != nil:
+		return "", false, errs.B().Code(errs.Internal).Msg("lookup idempotent bill").Err()
+	case legacyCreatedAt.After(now.Add(-ttl)):
+		candidate = billIDForIdempotencyKey(key)
+		createdAt = legacyCreatedAt
+	}
+
+	// Inserts a new key or takes over an expired one; a live key is left
+	// alone and returns no row
+	var billID string
+	err = db.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (owner_id, key_hash, bill_id, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (owner_id, key_hash) DO UPDATE
+			SET bill_id = EXCLUDED.bill_id, created_at = EXCLUDED.created_at
+			WHERE idempotency_keys.created_at <= $5
+		RETURNING bill_id
+	`, ownerID, idempotencyKeyHash(key), candidate, createdAt, now.Add(-ttl)).Scan(&billID)
+	if err == nil {
+		return billID, true, nil
+	}
+	if err != sqldb.ErrNoRows {
+		return "", false, errs.B().Code(errs.Internal).Msg("claim idempotency key").Err()
+	}
+
+	err = db.QueryRow(ctx, `
+		SELECT bill_id FROM idempotency_keys WHERE owner_id = $1 AND key_hash = $2
+	`, ownerID, idempotencyKeyHash(key)).Scan(&billID)
+	if err != nil {
+		return "", false, errs.B().Code(errs.Internal).Msg("lookup idempotency key").Err()
+	}
+	return billID, false, nil
+}
+
+// releaseIdempotencyKey drops a claim whose bill never started, so a retry
+// isn't pointed at a bill that doesn't exist.
+func releaseIdempotencyKey(ctx context.Context, ownerID, key, billID string) {
+	if _, err := db.Exec(ctx, `
+		DELETE FROM idempotency_keys WHERE owner_id = $1 AND key_hash = $2 AND bill_id = $3
+	`, ownerID, idempotencyKeyHash(key), billID); err != nil {
+		billLog(billID).Error("release idempotency key failed", "err", err)
+	}
+}
+
+var _ = cron.NewJob("sweep-idempotency-keys", cron.JobConfig{
+	Title:    "Delete expired idempotency keys",
+	Every:    1 * cron.Hour,
+	Endpoint: SweepIdempotencyKeys,
+})
+
+// SweepIdempotencyKeys deletes mappings older than the TTL. Claims already
+// treat them as expired, so this only bounds the table.
+//
+//encore:api private
+func SweepIdempotencyKeys(ctx context.Context) error {
+	res, err := db.Exec(ctx, `
+		DELETE FROM idempotency_keys WHERE created_at <= $1
+	`, time.Now().Add(-idempotencyKeyTTL()))
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("sweep idempotency keys").Err()
+	}
+	rlog.Info("idempotency keys swept", "deleted", res.RowsAffected())
+	return nil
+}
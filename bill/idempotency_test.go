@@ -0,0 +1,45 @@
+package bill
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Runs against the test database encore test provisions.
+func TestClaimIdempotencyKeyExpiry(t *testing.T) {
+	ctx := context.Background()
+	owner, key := "owner-"+uuid.NewString(), uuid.NewString()
+	ttl := time.Hour
+	start := time.Now().Truncate(time.Millisecond)
+
+	first, claimed, err := claimIdempotencyKey(ctx, owner, key, start, ttl)
+	if err != nil || !claimed {
+		t.Fatalf("first claim = (%q, %v, %v), want a new claim", first, claimed, err)
+	}
+
+	replay, claimed, err := claimIdempotencyKey(ctx, owner, key, start.Add(ttl-time.Millisecond), ttl)
+	if err != nil || claimed || replay != first {
+		t.Fatalf("replay before expiry = (%q, %v, %v), want (%q, false, nil)", replay, claimed, err, first)
+	}
+
+	other, claimed, err := claimIdempotencyKey(ctx, "other-"+owner, key, start, ttl)
+	if err != nil || !claimed || other == first {
+		t.Fatalf("another tenant's claim = (%q, %v, %v), want a new bill", other, claimed, err)
+	}
+
+	fresh, claimed, err := claimIdempotencyKey(ctx, owner, key, start.Add(ttl+time.Millisecond), ttl)
+	if err != nil || !claimed {
+		t.Fatalf("claim after expiry = (%q, %v, %v), want a new claim", fresh, claimed, err)
+	}
+	if fresh == first {
+		t.Fatalf("claim after expiry reused bill %q", first)
+	}
+
+	again, claimed, err := claimIdempotencyKey(ctx, owner, key, start.Add(ttl+time.Second), ttl)
+	if err != nil || claimed || again != fresh {
+		t.Fatalf("replay of the new claim = (%q, %v, %v), want (%q, false, nil)", again, claimed, err, fresh)
+	}
+}
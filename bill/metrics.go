@@ -0,0 +1,84 @@
+package bill
+
+import (
+	"context"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/metrics"
+)
+
+// Lifecycle metrics. Counters are bumped where the DB write actually
+// happens (activities, guarded by RowsAffected), so Temporal retries don't
+// double count.
+
+type currencyLabels struct {
+	Currency string
+}
+
+var billsCreated = metrics.NewCounterGroup[currencyLabels, uint64]("bills_created_total", metrics.CounterConfig{})
+
+var lineItemsAdded = metrics.NewCounterGroup[currencyLabels, uint64]("line_items_added_total", metrics.CounterConfig{})
+
+var billsClosed = metrics.NewCounterGroup[currencyLabels, uint64]("bills_closed_total", metrics.CounterConfig{})
+
+// Closes where the workflow's subtotal disagreed with the stored items and
+// the DB's sum was stored instead; should stay at zero.
+var billCloseTotalDrift = metrics.NewCounterGroup[currencyLabels, uint64]("bill_close_total_drift_total", metrics.CounterConfig{})
+
+// Encore has no histograms: CloseBill's latency (signal until the workflow
+// result) is exported as a running sum and count, so a dashboard plots
+// rate(sum) / rate(count) as the average.
+var closeLatencyMsSum = metrics.NewCounter[uint64]("bill_close_latency_ms_sum", metrics.CounterConfig{})
+
+var closeLatencyCount = metrics.NewCounter[uint64]("bill_close_latency_count", metrics.CounterConfig{})
+
+// Open (non-deleted) bills per currency, refreshed by refreshOpenBillsJob.
+var openBills = metrics.NewGaugeGroup[currencyLabels, int64]("bills_open", metrics.GaugeConfig{})
+
+func observeCloseLatency(d time.Duration) {
+	closeLatencyMsSum.Add(uint64(d.Milliseconds()))
+	closeLatencyCount.Increment()
+}
+
+var _ = cron.NewJob("refresh-open-bills-gauge", cron.JobConfig{
+	Title:    "Refresh the open bills gauge",
+	Every:    1 * cron.Minute,
+	Endpoint: RefreshOpenBillsGauge,
+})
+
+// RefreshOpenBillsGauge recounts open bills per currency. Currencies with
+// none are set to 0 so a gauge doesn't stick at its last value.
+//
+//encore:api private
+func RefreshOpenBillsGauge(ctx context.Context) error {
+	rows, err := db.Query(ctx, `
+		SELECT currency, COUNT(*)
+		FROM bills
+		WHERE status = 'OPEN' AND deleted_at IS NULL
+		GROUP BY currency
+	`)
+	if err != nil {
+		return errs.B().Code(errs.Internal).Msg("count open bills").Err()
+	}
+	defer rows.Close()
+
+	counts := make(map[Currency]int64)
+	for rows.Next() {
+		var c Currency
+		var n int64
+		if err := rows.Scan(&c, &n); err != nil {
+			return errs.B().Code(errs.Internal).Msg("scan open bills").Err()
+		}
+		counts[c] = n
+	}
+	if err := rows.Err(); err != nil {
+		return errs.B().Code(errs.Internal).Msg("count open bills").Err()
+	}
+
+	for _, c := range AllCurrencies() {
+		openBills.With(currencyLabels{Currency: string(c)}).Set(counts[c])
+	}
+	return nil
+}
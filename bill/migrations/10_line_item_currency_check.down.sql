@@ -0,0 +1 @@
+ALTER TABLE bill_line_items DROP CONSTRAINT bill_line_items_currency_check;
@@ -0,0 +1,4 @@
+-- bills.currency already has a CHECK; give line items the same allowlist
+-- so a manual insert can't bypass it before the currency-lock trigger runs
+ALTER TABLE bill_line_items ADD CONSTRAINT bill_line_items_currency_check
+    CHECK (currency IN ('USD', 'GEL', 'EUR', 'GBP', 'JPY'));
@@ -0,0 +1,3 @@
+-- Soft delete: deleted bills drop out of every read path but keep their row
+-- and line items for audit
+ALTER TABLE bills ADD COLUMN deleted_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+DROP TRIGGER bill_line_items_invoiced_lock ON bill_line_items;
+DROP FUNCTION bill_line_items_invoiced_lock();
+ALTER TABLE bill_line_items DROP COLUMN invoice_id;
+DROP TRIGGER invoices_immutable ON invoices;
+DROP FUNCTION invoices_immutable();
+DROP TABLE invoices;
@@ -0,0 +1,44 @@
+-- Partial charges of an open bill. An invoice freezes the items issued on
+-- it (bill_line_items.invoice_id); the bill's lifetime total is the sum of
+-- its invoices plus total_minor at close, which covers only the items
+-- no invoice took.
+CREATE TABLE invoices (
+    id          TEXT PRIMARY KEY,
+    bill_id     TEXT NOT NULL REFERENCES bills(id),
+    currency    TEXT NOT NULL CHECK (currency IN ('USD', 'GEL', 'EUR', 'GBP', 'JPY')),
+    total_minor BIGINT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX invoices_bill_id_idx ON invoices (bill_id, created_at);
+
+ALTER TABLE bill_line_items ADD COLUMN invoice_id TEXT REFERENCES invoices(id);
+
+-- Issued invoices, and the items on them, never change
+CREATE FUNCTION invoices_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'invoice % is immutable', OLD.id
+        USING ERRCODE = 'check_violation';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER invoices_immutable
+    BEFORE UPDATE OR DELETE ON invoices
+    FOR EACH ROW EXECUTE FUNCTION invoices_immutable();
+
+CREATE FUNCTION bill_line_items_invoiced_lock() RETURNS trigger AS $$
+BEGIN
+    IF OLD.invoice_id IS NOT NULL THEN
+        RAISE EXCEPTION 'line item % is on invoice %', OLD.id, OLD.invoice_id
+            USING ERRCODE = 'check_violation';
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bill_line_items_invoiced_lock
+    BEFORE UPDATE OR DELETE ON bill_line_items
+    FOR EACH ROW EXECUTE FUNCTION bill_line_items_invoiced_lock();
@@ -0,0 +1,4 @@
+ALTER TABLE bills
+    DROP COLUMN fx_rate_ppm,
+    DROP COLUMN base_total_minor,
+    DROP COLUMN base_currency;
@@ -0,0 +1,7 @@
+-- Close-time conversion of total_minor into the configured base currency.
+-- fx_rate_ppm is the rate used (base units per bill unit, times 10^6),
+-- kept so base_total_minor can be audited. NULL when conversion was off.
+ALTER TABLE bills
+    ADD COLUMN base_currency    TEXT CHECK (base_currency IN ('USD', 'GEL', 'EUR', 'GBP', 'JPY')),
+    ADD COLUMN base_total_minor BIGINT,
+    ADD COLUMN fx_rate_ppm      BIGINT CHECK (fx_rate_ppm > 0);
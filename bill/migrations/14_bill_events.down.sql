@@ -0,0 +1,9 @@
+DROP TRIGGER invoices_record_event ON invoices;
+DROP FUNCTION invoices_record_event();
+DROP TRIGGER bill_discounts_record_event ON bill_discounts;
+DROP FUNCTION bill_discounts_record_event();
+DROP TRIGGER bill_line_items_record_event ON bill_line_items;
+DROP FUNCTION bill_line_items_record_event();
+DROP TRIGGER bills_record_event ON bills;
+DROP FUNCTION bills_record_event();
+DROP TABLE bill_events;
@@ -0,0 +1,103 @@
+-- Audit trail of every mutation to a bill. Rows are written by triggers,
+-- so an event commits or rolls back with the change it records and no
+-- write path can forget one. id orders events per bill.
+CREATE TABLE bill_events (
+    id         BIGSERIAL PRIMARY KEY,
+    bill_id    TEXT NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    type       TEXT NOT NULL,
+    payload    JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX bill_events_bill_id_idx ON bill_events (bill_id, id);
+
+CREATE FUNCTION bills_record_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'created', jsonb_build_object(
+            'status', NEW.status, 'currency', NEW.currency, 'tax_rate_bps', NEW.tax_rate_bps));
+        RETURN NEW;
+    END IF;
+
+    IF NEW.currency IS DISTINCT FROM OLD.currency THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'currency_changed', jsonb_build_object('from', OLD.currency, 'to', NEW.currency));
+    END IF;
+    IF NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, CASE NEW.status WHEN 'VOID' THEN 'voided' ELSE lower(NEW.status) END, jsonb_build_object(
+            'total_minor', NEW.total_minor, 'void_reason', NEW.void_reason));
+    ELSIF NEW.total_minor IS DISTINCT FROM OLD.total_minor THEN
+        -- admin backfill correcting a closed total
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'total_recomputed', jsonb_build_object('from', OLD.total_minor, 'to', NEW.total_minor));
+    END IF;
+    IF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        INSERT INTO bill_events (bill_id, type) VALUES (NEW.id, 'deleted');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bills_record_event
+    AFTER INSERT OR UPDATE ON bills
+    FOR EACH ROW EXECUTE FUNCTION bills_record_event();
+
+CREATE FUNCTION bill_line_items_record_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.bill_id, 'item_added', jsonb_build_object(
+            'line_item_id', NEW.id, 'description', NEW.description, 'amount_minor', NEW.amount_minor));
+        RETURN NEW;
+    ELSIF TG_OP = 'DELETE' THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (OLD.bill_id, 'item_removed', jsonb_build_object(
+            'line_item_id', OLD.id, 'amount_minor', OLD.amount_minor));
+        RETURN OLD;
+    END IF;
+
+    -- Being frozen on an invoice is recorded as invoice_issued instead
+    IF NEW.description IS DISTINCT FROM OLD.description
+        OR NEW.amount_minor IS DISTINCT FROM OLD.amount_minor THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.bill_id, 'item_updated', jsonb_build_object(
+            'line_item_id', NEW.id,
+            'description', NEW.description,
+            'amount_minor', NEW.amount_minor,
+            'previous_amount_minor', OLD.amount_minor));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bill_line_items_record_event
+    AFTER INSERT OR UPDATE OR DELETE ON bill_line_items
+    FOR EACH ROW EXECUTE FUNCTION bill_line_items_record_event();
+
+CREATE FUNCTION bill_discounts_record_event() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO bill_events (bill_id, type, payload)
+    VALUES (NEW.bill_id, 'discount_applied', jsonb_build_object(
+        'discount_id', NEW.id, 'type', NEW.type, 'value', NEW.value));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bill_discounts_record_event
+    AFTER INSERT ON bill_discounts
+    FOR EACH ROW EXECUTE FUNCTION bill_discounts_record_event();
+
+CREATE FUNCTION invoices_record_event() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO bill_events (bill_id, type, payload)
+    VALUES (NEW.bill_id, 'invoice_issued', jsonb_build_object(
+        'invoice_id', NEW.id, 'total_minor', NEW.total_minor));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER invoices_record_event
+    AFTER INSERT ON invoices
+    FOR EACH ROW EXECUTE FUNCTION invoices_record_event();
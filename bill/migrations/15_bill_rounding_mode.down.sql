@@ -0,0 +1 @@
+ALTER TABLE bills DROP COLUMN rounding_mode;
@@ -0,0 +1,4 @@
+-- Rounding for tax and percent discounts at close, chosen per bill at
+-- creation. Existing bills were computed half-up.
+ALTER TABLE bills ADD COLUMN rounding_mode TEXT NOT NULL DEFAULT 'HALF_UP'
+    CHECK (rounding_mode IN ('HALF_UP', 'HALF_EVEN', 'FLOOR', 'CEIL'));
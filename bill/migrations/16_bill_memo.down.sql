@@ -0,0 +1,31 @@
+-- Back to the bills trigger from 14_bill_events, without memo_changed
+CREATE OR REPLACE FUNCTION bills_record_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'created', jsonb_build_object(
+            'status', NEW.status, 'currency', NEW.currency, 'tax_rate_bps', NEW.tax_rate_bps));
+        RETURN NEW;
+    END IF;
+
+    IF NEW.currency IS DISTINCT FROM OLD.currency THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'currency_changed', jsonb_build_object('from', OLD.currency, 'to', NEW.currency));
+    END IF;
+    IF NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, CASE NEW.status WHEN 'VOID' THEN 'voided' ELSE lower(NEW.status) END, jsonb_build_object(
+            'total_minor', NEW.total_minor, 'void_reason', NEW.void_reason));
+    ELSIF NEW.total_minor IS DISTINCT FROM OLD.total_minor THEN
+        -- admin backfill correcting a closed total
+        INSERT INTO bill_events (bill_id, type, payload)
+        VALUES (NEW.id, 'total_recomputed', jsonb_build_object('from', OLD.total_minor, 'to', NEW.total_minor));
+    END IF;
+    IF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        INSERT INTO bill_events (bill_id, type) VALUES (NEW.id, 'deleted');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE bills DROP COLUMN memo;
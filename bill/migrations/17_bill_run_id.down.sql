@@ -0,0 +1 @@
+ALTER TABLE bills DROP COLUMN run_id;
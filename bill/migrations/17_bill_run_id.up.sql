@@ -0,0 +1,3 @@
+-- Run ID of the bill workflow's first run, for finding the execution in
+-- Temporal; NULL for bills created before it was recorded.
+ALTER TABLE bills ADD COLUMN run_id TEXT;
@@ -0,0 +1,2 @@
+DROP INDEX bills_owner_id_created_at_idx;
+ALTER TABLE bills DROP COLUMN owner_id;
@@ -0,0 +1,6 @@
+-- Tenant each bill belongs to. Bills from before owner scoping, and bills
+-- created by unauthenticated calls, belong to ''.
+ALTER TABLE bills ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+-- Every list is scoped to one owner
+CREATE INDEX bills_owner_id_created_at_idx ON bills (owner_id, created_at);
@@ -0,0 +1 @@
+DROP INDEX bill_line_items_description_trgm_idx;
@@ -0,0 +1,6 @@
+-- GET /bills?search= matches line item descriptions by substring
+-- (ILIKE '%...%'), which a btree index can't serve; a trigram index can.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX bill_line_items_description_trgm_idx
+    ON bill_line_items USING gin (description gin_trgm_ops);
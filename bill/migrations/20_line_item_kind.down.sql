@@ -0,0 +1 @@
+ALTER TABLE bill_line_items DROP COLUMN kind;
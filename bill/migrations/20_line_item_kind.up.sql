@@ -0,0 +1,6 @@
+-- Tells user-entered items from system-generated lines (tax, discount,
+-- rounding). Existing rows and every insert that doesn't say otherwise are
+-- user items. Keep the CHECK in sync with AllLineItemKinds.
+ALTER TABLE bill_line_items
+    ADD COLUMN kind TEXT NOT NULL DEFAULT 'user'
+        CHECK (kind IN ('user', 'tax', 'discount', 'rounding'));
@@ -0,0 +1,12 @@
+-- Idempotency-Key -> bill mappings for CreateBill, per tenant. The key is
+-- stored hashed. A row older than IdempotencyKeyTTLSeconds is expired: a
+-- claim takes it over and the hourly sweep deletes it.
+CREATE TABLE idempotency_keys (
+    owner_id   TEXT NOT NULL,
+    key_hash   TEXT NOT NULL,
+    bill_id    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (owner_id, key_hash)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
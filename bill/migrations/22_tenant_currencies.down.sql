@@ -0,0 +1 @@
+DROP TABLE tenant_currencies;
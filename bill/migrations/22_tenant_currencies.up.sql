@@ -0,0 +1,7 @@
+-- Per-tenant currency allowlist, managed through the admin API. A tenant
+-- with no rows may use every supported currency.
+CREATE TABLE tenant_currencies (
+    owner_id TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    PRIMARY KEY (owner_id, currency)
+);
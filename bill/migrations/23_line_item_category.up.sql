@@ -0,0 +1,3 @@
+-- Optional label items are grouped and subtotalled by. Existing rows and
+-- inserts that don't set one are uncategorized ('').
+ALTER TABLE bill_line_items ADD COLUMN category TEXT NOT NULL DEFAULT '';
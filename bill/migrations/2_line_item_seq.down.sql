@@ -0,0 +1,2 @@
+DROP INDEX bill_line_items_bill_seq_idx;
+ALTER TABLE bill_line_items DROP COLUMN seq;
@@ -0,0 +1,19 @@
+ALTER TABLE bill_line_items ADD COLUMN seq BIGINT;
+
+-- Backfill existing rows in their historical order
+UPDATE bill_line_items li
+SET seq = ordered.rn
+FROM (
+    SELECT id, row_number() OVER (ORDER BY created_at, id) AS rn
+    FROM bill_line_items
+) ordered
+WHERE li.id = ordered.id;
+
+CREATE SEQUENCE bill_line_items_seq_seq OWNED BY bill_line_items.seq;
+SELECT setval('bill_line_items_seq_seq', COALESCE((SELECT MAX(seq) FROM bill_line_items), 0) + 1, false);
+
+ALTER TABLE bill_line_items
+    ALTER COLUMN seq SET DEFAULT nextval('bill_line_items_seq_seq'),
+    ALTER COLUMN seq SET NOT NULL;
+
+CREATE INDEX bill_line_items_bill_seq_idx ON bill_line_items (bill_id, seq);
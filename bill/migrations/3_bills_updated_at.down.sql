@@ -0,0 +1,2 @@
+DROP INDEX bills_updated_at_id_idx;
+ALTER TABLE bills DROP COLUMN updated_at;
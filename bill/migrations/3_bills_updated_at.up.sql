@@ -0,0 +1,15 @@
+ALTER TABLE bills ADD COLUMN updated_at TIMESTAMPTZ;
+
+-- Best-effort change time for existing rows (GREATEST ignores NULLs)
+UPDATE bills b
+SET updated_at = GREATEST(
+    b.created_at,
+    b.closed_at,
+    (SELECT MAX(li.created_at) FROM bill_line_items li WHERE li.bill_id = b.id)
+);
+
+ALTER TABLE bills
+    ALTER COLUMN updated_at SET DEFAULT now(),
+    ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX bills_updated_at_id_idx ON bills (updated_at, id);
@@ -0,0 +1,2 @@
+-- Proration inputs (period, covered range, full amount, rounding), kept for audit
+ALTER TABLE bill_line_items ADD COLUMN proration JSONB;
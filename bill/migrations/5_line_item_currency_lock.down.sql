@@ -0,0 +1,5 @@
+DROP TRIGGER bills_currency_lock ON bills;
+DROP FUNCTION bills_currency_lock();
+DROP TRIGGER bill_line_items_currency_lock ON bill_line_items;
+DROP FUNCTION bill_line_items_currency_lock();
+ALTER TABLE bill_line_items DROP COLUMN currency;
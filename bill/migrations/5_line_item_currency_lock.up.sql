@@ -0,0 +1,44 @@
+ALTER TABLE bill_line_items ADD COLUMN currency TEXT;
+
+UPDATE bill_line_items li
+SET currency = b.currency
+FROM bills b
+WHERE b.id = li.bill_id;
+
+ALTER TABLE bill_line_items ALTER COLUMN currency SET NOT NULL;
+
+-- Items default to their bill's currency and must always match it
+CREATE FUNCTION bill_line_items_currency_lock() RETURNS trigger AS $$
+DECLARE
+    bill_currency TEXT;
+BEGIN
+    SELECT currency INTO bill_currency FROM bills WHERE id = NEW.bill_id;
+    IF NEW.currency IS NULL THEN
+        NEW.currency := bill_currency;
+    ELSIF NEW.currency IS DISTINCT FROM bill_currency THEN
+        RAISE EXCEPTION 'line item currency % does not match bill currency %', NEW.currency, bill_currency
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bill_line_items_currency_lock
+    BEFORE INSERT OR UPDATE OF currency, bill_id ON bill_line_items
+    FOR EACH ROW EXECUTE FUNCTION bill_line_items_currency_lock();
+
+-- A bill's currency can only change while it has no items
+CREATE FUNCTION bills_currency_lock() RETURNS trigger AS $$
+BEGIN
+    IF NEW.currency <> OLD.currency
+        AND EXISTS (SELECT 1 FROM bill_line_items WHERE bill_id = NEW.id) THEN
+        RAISE EXCEPTION 'bill % has line items; currency is locked', NEW.id
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bills_currency_lock
+    BEFORE UPDATE OF currency ON bills
+    FOR EACH ROW EXECUTE FUNCTION bills_currency_lock();
@@ -0,0 +1,3 @@
+ALTER TABLE bills DROP COLUMN void_reason;
+ALTER TABLE bills DROP CONSTRAINT bills_status_check;
+ALTER TABLE bills ADD CONSTRAINT bills_status_check CHECK (status IN ('OPEN', 'CLOSED'));
@@ -0,0 +1,5 @@
+ALTER TABLE bills DROP CONSTRAINT bills_status_check;
+ALTER TABLE bills ADD CONSTRAINT bills_status_check CHECK (status IN ('OPEN', 'CLOSED', 'VOID'));
+
+-- Why a bill was voided (e.g. "terminated: <ops reason>")
+ALTER TABLE bills ADD COLUMN void_reason TEXT;
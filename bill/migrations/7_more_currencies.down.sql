@@ -0,0 +1,2 @@
+ALTER TABLE bills DROP CONSTRAINT bills_currency_check;
+ALTER TABLE bills ADD CONSTRAINT bills_currency_check CHECK (currency IN ('USD', 'GEL'));
@@ -0,0 +1 @@
+DROP TABLE bill_discounts;
@@ -0,0 +1,11 @@
+-- Promotions applied to an open bill; the total at close is the item sum
+-- minus these, floored at zero
+CREATE TABLE bill_discounts (
+    id         TEXT PRIMARY KEY,
+    bill_id    TEXT NOT NULL REFERENCES bills(id) ON DELETE CASCADE,
+    type       TEXT NOT NULL CHECK (type IN ('PERCENT', 'FIXED')),
+    value      BIGINT NOT NULL CHECK (value > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX bill_discounts_bill_id_idx ON bill_discounts (bill_id);
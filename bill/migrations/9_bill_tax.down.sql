@@ -0,0 +1,5 @@
+ALTER TABLE bills
+    DROP COLUMN tax_rate_bps,
+    DROP COLUMN subtotal_minor,
+    DROP COLUMN discount_minor,
+    DROP COLUMN tax_minor;
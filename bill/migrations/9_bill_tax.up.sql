@@ -0,0 +1,10 @@
+-- Tax rate chosen at creation, and the close-time breakdown of total_minor:
+-- total = subtotal - discount + tax
+ALTER TABLE bills
+    ADD COLUMN tax_rate_bps   INT NOT NULL DEFAULT 0 CHECK (tax_rate_bps BETWEEN 0 AND 10000),
+    ADD COLUMN subtotal_minor BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN discount_minor BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN tax_minor      BIGINT NOT NULL DEFAULT 0;
+
+-- Bills closed so far were untaxed and undiscounted
+UPDATE bills SET subtotal_minor = total_minor WHERE status = 'CLOSED';
@@ -0,0 +1,177 @@
+package bill
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"encore.dev/beta/errs"
+)
+
+// RoundingMode controls how a fractional minor-unit result is rounded.
+// All money math uses integers only so workflow code stays replay-safe.
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "HALF_UP"   // ties away from zero
+	RoundHalfEven RoundingMode = "HALF_EVEN" // ties to even (banker's): 2.5 -> 2, 3.5 -> 4
+	RoundFloor    RoundingMode = "FLOOR"
+	RoundCeil     RoundingMode = "CEIL"
+)
+
+func (m RoundingMode) Valid() bool {
+	return m == RoundHalfUp || m == RoundHalfEven || m == RoundFloor || m == RoundCeil
+}
+
+func roundingModeNames() []string {
+	return []string{string(RoundHalfUp), string(RoundHalfEven), string(RoundFloor), string(RoundCeil)}
+}
+
+// divRound returns num/den rounded per mode; an empty mode is HALF_UP.
+// den must be positive.
+func divRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int)) // q truncated toward zero
+	if r.Sign() == 0 {
+		return q
+	}
+
+	switch mode {
+	case RoundFloor:
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		}
+	case RoundCeil:
+		if num.Sign() > 0 {
+			q.Add(q, big.NewInt(1))
+		}
+	case RoundHalfEven:
+		twiceR := new(big.Int).Abs(r)
+		twiceR.Lsh(twiceR, 1)
+		if c := twiceR.Cmp(den); c > 0 || (c == 0 && q.Bit(0) == 1) {
+			if num.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	default: // RoundHalfUp
+		twiceR := new(big.Int).Abs(r)
+		twiceR.Lsh(twiceR, 1)
+		if twiceR.Cmp(den) >= 0 {
+			if num.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return q
+}
+
+// Largest minor amount FromMajor accepts: past 2^53 a float64 no longer
+// holds every integer, so the conversion could silently be off by a unit.
+const maxExactMajorMinor = 1 << 53
+
+// FromMajor converts an amount in major units (10.5 USD, 1000 JPY) to minor
+// units per the currency's scale: 10.5 USD -> 1050, 1000 JPY -> 1000. More
+// decimal places than the currency has (10.005 USD, 10.5 JPY) is an error
+// rather than a rounding, since it usually means a mis-scaled amount.
+func FromMajor(amountMajor float64, currency Currency) (int64, error) {
+	if math.IsNaN(amountMajor) || math.IsInf(amountMajor, 0) {
+		return 0, fmt.Errorf("not a finite number")
+	}
+	// Shortest form that round-trips, i.e. the number the client wrote
+	minor, err := ParseMajor(strconv.FormatFloat(amountMajor, 'f', -1, 64), currency)
+	if err != nil {
+		return 0, err
+	}
+	if minor > maxExactMajorMinor || minor < -maxExactMajorMinor {
+		return 0, fmt.Errorf("too large to convert exactly; send amount_minor")
+	}
+	return minor, nil
+}
+
+// ParseMajor is FromMajor for a decimal string ("10.50", "-3", "1000").
+func ParseMajor(s string, currency Currency) (int64, error) {
+	scale := currency.MinorUnits()
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	neg := strings.HasPrefix(whole, "-")
+	whole = strings.TrimPrefix(whole, "-")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("not a decimal number")
+	}
+	if len(frac) > scale {
+		if scale == 0 {
+			return 0, fmt.Errorf("%s amounts are whole units; no decimal places", currency)
+		}
+		return 0, fmt.Errorf("%s amounts have at most %d decimal places", currency, scale)
+	}
+
+	digits := whole + frac + strings.Repeat("0", scale-len(frac))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("not a decimal number")
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("out of range")
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// checkTotalDelta rejects applying delta to a running total when the result
+// would overflow or underflow int64. Every path that changes a total (add,
+// import, batch and update paths) checks it before mutating.
+func checkTotalDelta(current, delta int64) error {
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return errs.B().Code(errs.InvalidArgument).Msg("total would overflow").Err()
+	}
+	return nil
+}
+
+// billTotals breaks a bill down at close: discounts come off the subtotal
+// first, and tax (basis points) is charged on what remains, both rounded
+// per mode. With no discounts and a zero rate, total == subtotal.
+func billTotals(subtotal int64, discounts []Discount, taxRateBps int, mode RoundingMode) (discount, tax, total int64, err error) {
+	discount = discountMinor(subtotal, discounts, mode)
+	taxable := subtotal - discount
+
+	num := new(big.Int).Mul(big.NewInt(taxable), big.NewInt(int64(taxRateBps)))
+	tax = divRound(num, big.NewInt(10000), mode).Int64()
+	if err := checkTotalDelta(taxable, tax); err != nil {
+		return 0, 0, 0, err
+	}
+	return discount, tax, taxable + tax, nil
+}
+
+// discountMinor is the total discount on a subtotal: every percent discount
+// is taken from the subtotal (rounded per mode), fixed ones are added as is,
+// and the sum is capped at the subtotal so the total never goes negative.
+func discountMinor(subtotal int64, discounts []Discount, mode RoundingMode) int64 {
+	if subtotal <= 0 {
+		return 0
+	}
+
+	sum := new(big.Int)
+	hundred := big.NewInt(100)
+	for _, d := range discounts {
+		switch d.Type {
+		case DiscountPercent:
+			num := new(big.Int).Mul(big.NewInt(subtotal), big.NewInt(d.Value))
+			sum.Add(sum, divRound(num, hundred, mode))
+		case DiscountFixed:
+			sum.Add(sum, big.NewInt(d.Value))
+		}
+	}
+
+	if sum.Cmp(big.NewInt(subtotal)) > 0 {
+		return subtotal
+	}
+	return sum.Int64()
+}
@@ -0,0 +1,133 @@
+package bill
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"encore.dev/beta/errs"
+)
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		mode     RoundingMode
+		want     int64
+	}{
+		// banker's: ties go to the even neighbour, either sign
+		{5, 2, RoundHalfEven, 2},
+		{7, 2, RoundHalfEven, 4},
+		{-5, 2, RoundHalfEven, -2},
+		{-7, 2, RoundHalfEven, -4},
+		{26, 10, RoundHalfEven, 3},
+		{-24, 10, RoundHalfEven, -2},
+
+		// ties away from zero; empty is HALF_UP
+		{5, 2, RoundHalfUp, 3},
+		{-5, 2, RoundHalfUp, -3},
+		{5, 2, "", 3},
+		{-24, 10, RoundHalfUp, -2},
+
+		// FLOOR and CEIL on negatives go toward -inf and +inf, not zero
+		{7, 2, RoundFloor, 3},
+		{-7, 2, RoundFloor, -4},
+		{-1, 3, RoundFloor, -1},
+		{7, 2, RoundCeil, 4},
+		{-7, 2, RoundCeil, -3},
+		{-1, 3, RoundCeil, 0},
+		{1, 3, RoundCeil, 1},
+
+		// exact quotients are never moved
+		{-6, 2, RoundFloor, -3},
+		{-6, 2, RoundCeil, -3},
+		{6, 2, RoundHalfEven, 3},
+	}
+	for _, tt := range tests {
+		got := divRound(big.NewInt(tt.num), big.NewInt(tt.den), tt.mode).Int64()
+		if got != tt.want {
+			t.Errorf("divRound(%d, %d, %q) = %d, want %d", tt.num, tt.den, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestBillTotals(t *testing.T) {
+	tests := []struct {
+		name      string
+		subtotal  int64
+		discounts []Discount
+		taxBps    int
+		mode      RoundingMode
+		discount  int64
+		tax       int64
+		total     int64
+	}{
+		{"no tax or discount", 1234, nil, 0, RoundHalfUp, 0, 0, 1234},
+
+		// 1000 * 8.25% = 82.5
+		{"tax tie half up", 1000, nil, 825, RoundHalfUp, 0, 83, 1083},
+		{"tax tie half even", 1000, nil, 825, RoundHalfEven, 0, 82, 1082},
+		{"tax tie floor", 1000, nil, 825, RoundFloor, 0, 82, 1082},
+		{"tax tie ceil", 1000, nil, 825, RoundCeil, 0, 83, 1083},
+
+		// a negative subtotal (credits over items) gets no discount, and
+		// its tax of -82.5 rounds by mode
+		{"negative half up", -1000, []Discount{{Type: DiscountPercent, Value: 10}}, 825, RoundHalfUp, 0, -83, -1083},
+		{"negative half even", -1000, nil, 825, RoundHalfEven, 0, -82, -1082},
+		{"negative floor", -1000, nil, 825, RoundFloor, 0, -83, -1083},
+		{"negative ceil", -1000, nil, 825, RoundCeil, 0, -82, -1082},
+
+		// 10% of 1005 = 100.5
+		{"percent discount half up", 1005, []Discount{{Type: DiscountPercent, Value: 10}}, 0, RoundHalfUp, 101, 0, 904},
+		{"percent discount half even", 1005, []Discount{{Type: DiscountPercent, Value: 10}}, 0, RoundHalfEven, 100, 0, 905},
+
+		// tax is on what's left after the discount: 900 * 10%
+		{"discount then tax", 1000, []Discount{{Type: DiscountFixed, Value: 100}}, 1000, RoundHalfUp, 100, 90, 990},
+		{"discount capped at subtotal", 500, []Discount{{Type: DiscountFixed, Value: 800}}, 1000, RoundHalfUp, 500, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount, tax, total, err := billTotals(tt.subtotal, tt.discounts, tt.taxBps, tt.mode)
+			if err != nil {
+				t.Fatalf("billTotals: %v", err)
+			}
+			if discount != tt.discount || tax != tt.tax || total != tt.total {
+				t.Errorf("billTotals = (%d, %d, %d), want (%d, %d, %d)",
+					discount, tax, total, tt.discount, tt.tax, tt.total)
+			}
+		})
+	}
+}
+
+func TestBillTotalsOverflow(t *testing.T) {
+	if _, _, _, err := billTotals(math.MaxInt64, nil, 100, RoundHalfUp); err == nil {
+		t.Error("billTotals(MaxInt64, 1% tax) = nil error, want overflow")
+	}
+}
+
+func TestCheckTotalDelta(t *testing.T) {
+	tests := []struct {
+		name           string
+		current, delta int64
+		ok             bool
+	}{
+		{"reaches MaxInt64", math.MaxInt64 - 1, 1, true},
+		{"past MaxInt64", math.MaxInt64, 1, false},
+		{"large delta past MaxInt64", 1, math.MaxInt64, false},
+		{"reaches MinInt64", math.MinInt64 + 1, -1, true},
+		{"past MinInt64", math.MinInt64, -1, false},
+		{"large credit past MinInt64", -2, math.MinInt64 + 1, false},
+		{"zero at MaxInt64", math.MaxInt64, 0, true},
+		{"opposite signs never overflow", math.MaxInt64, math.MinInt64, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTotalDelta(tt.current, tt.delta)
+			if (err == nil) != tt.ok {
+				t.Fatalf("checkTotalDelta(%d, %d) = %v, want ok=%v", tt.current, tt.delta, err, tt.ok)
+			}
+			if err != nil && errCode(err) != errs.InvalidArgument {
+				t.Errorf("code = %v, want InvalidArgument", errCode(err))
+			}
+		})
+	}
+}
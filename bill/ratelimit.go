@@ -0,0 +1,102 @@
+package bill
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+// ==============================
+// Per-caller rate limit
+// ==============================
+
+// Buckets idle this long are checked for removal.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitDetails is attached to ResourceExhausted errors from the limiter.
+type RateLimitDetails struct {
+	Reason            string `json:"reason"`              // RATE_LIMITED
+	RetryAfterSeconds int    `json:"retry_after_seconds"` // when a token is next available
+}
+
+func (RateLimitDetails) ErrDetails() {}
+
+// rateLimiter is a token bucket per caller: a bucket holds up to burst
+// tokens, refills at rate per second, and each request takes one. State is
+// in memory, so each instance limits on its own.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var callerLimiter = &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+// take spends a token from key's bucket. When none is left it returns
+// false and how long until one is.
+func (rl *rateLimiter) take(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(rate, burst, now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely: they behave exactly
+// like a new one, so forgetting them only bounds memory.
+func (rl *rateLimiter) sweep(rate float64, burst int, now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+	full := time.Duration(float64(burst) / rate * float64(time.Second))
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= full {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// limitCaller charges one request to the calling API key (or to all
+// unauthenticated callers together) and returns ResourceExhausted once its
+// bucket is empty. Off when RateLimitPerSecond is 0.
+func limitCaller() error {
+	if cfg.RateLimitPerSecond <= 0 {
+		return nil
+	}
+	key := ""
+	if uid, ok := auth.UserID(); ok {
+		key = string(uid)
+	}
+
+	ok, wait := callerLimiter.take(key, cfg.RateLimitPerSecond, cfg.RateLimitBurst, time.Now())
+	if ok {
+		return nil
+	}
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	return errs.B().Code(errs.ResourceExhausted).
+		Msgf("rate limit exceeded; retry in %ds", retryAfter).
+		Details(RateLimitDetails{Reason: ReasonRateLimited, RetryAfterSeconds: retryAfter}).
+		Err()
+}
@@ -3,9 +3,15 @@ package bill
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 )
 
@@ -13,41 +19,262 @@ var db = sqldb.NewDatabase("feesdb", sqldb.DatabaseConfig{
 	Migrations: "./migrations",
 })
 
-const taskQueueName = "fees-billing"
-
 //encore:service
 type Service struct {
 	temporalClient client.Client
 	worker         worker.Worker
+
+	// In-flight CloseBill waits on run.Get; Shutdown drains them before
+	// closing the client. mu guards shuttingDown and closeWaits.Add.
+	mu           sync.Mutex
+	shuttingDown bool
+	closeWaits   sync.WaitGroup
+
+	// Activities currently executing on this worker
+	inflight *atomic.Int64
+
+	// Degraded mode (TemporalDegradedStart): Temporal was unreachable at
+	// init, so the worker isn't started and endpoints that need a workflow
+	// answer Unavailable until reconnectTemporal gets through. mu guards
+	// workerStarted; stopReconnect ends the reconnector on shutdown.
+	degraded      atomic.Bool
+	workerStarted bool
+	stopReconnect context.CancelFunc
 }
 
+// Backoff between Temporal dial attempts, at init and while degraded
+const (
+	temporalDialInitialBackoff = time.Second
+	temporalDialMaxBackoff     = 30 * time.Second
+)
+
 func initService() (*Service, error) {
-	c, err := client.Dial(client.Options{
-		HostPort: "localhost:7233",
-	})
-	if err != nil {
-		return nil, fmt.Errorf("temporal client: %w", err)
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	opts := client.Options{
+		HostPort:  temporalHostPort(),
+		Namespace: temporalNamespace(),
 	}
+	c, dialErr := dialTemporal(opts)
+	degraded := false
+	if dialErr != nil {
+		if !cfg.TemporalDegradedStart {
+			return nil, fmt.Errorf("temporal client: %w", dialErr)
+		}
+		// Connects on first use, so calls fail (rather than panic) until
+		// Temporal is up and reconnectTemporal promotes the service
+		var err error
+		if c, err = client.NewLazyClient(opts); err != nil {
+			return nil, fmt.Errorf("temporal client: %w", err)
+		}
+		rlog.Error("temporal unreachable; starting degraded, workflow endpoints unavailable", "err", dialErr)
+		degraded = true
+	}
+
+	inflight := new(atomic.Int64)
+	w := worker.New(c, taskQueue(), worker.Options{
+		MaxConcurrentActivityExecutionSize:     cfg.WorkerMaxConcurrentActivities,
+		MaxConcurrentActivityTaskPollers:       cfg.WorkerActivityPollers,
+		MaxConcurrentWorkflowTaskExecutionSize: cfg.WorkerMaxConcurrentWorkflowTasks,
 
-	w := worker.New(c, taskQueueName, worker.Options{})
+		// Stop stops polling, then lets running activities finish for up
+		// to this long before cancelling their contexts
+		WorkerStopTimeout: time.Duration(cfg.WorkerStopTimeoutSeconds) * time.Second,
+		Interceptors:      []interceptor.WorkerInterceptor{&inflightInterceptor{n: inflight}},
+	})
 
 	// Register workflow + activities
 	w.RegisterWorkflow(BillLifecycleWorkflow)
+	w.RegisterWorkflow(AutoCloseStaleBillsWorkflow)
 
 	// register activity functions
 	w.RegisterActivity(CreateBillRowActivity)
 	w.RegisterActivity(AddLineItemActivity)
+	w.RegisterActivity(AddLineItemsActivity)
+	w.RegisterActivity(UpdateLineItemActivity)
+	w.RegisterActivity(RemoveLineItemActivity)
+	w.RegisterActivity(ApplyDiscountActivity)
+	w.RegisterActivity(SetCurrencyActivity)
+	w.RegisterActivity(SetMemoActivity)
 	w.RegisterActivity(CloseBillActivity)
+	w.RegisterActivity(NotifyBillClosedActivity)
+	w.RegisterActivity(VoidBillActivity)
+	w.RegisterActivity(DeleteBillActivity)
+	w.RegisterActivity(IssueInvoiceActivity)
+	w.RegisterActivity(ConvertCurrencyActivity)
+	w.RegisterActivity(ListStaleBillsActivity)
+
+	rctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	logInvalidCurrencies(rctx)
+	cancel()
+
+	s := &Service{temporalClient: c, worker: w, inflight: inflight}
+	if degraded {
+		s.degraded.Store(true)
+		var ctx context.Context
+		ctx, s.stopReconnect = context.WithCancel(context.Background())
+		go s.reconnectTemporal(ctx)
+		return s, nil
+	}
 
 	if err := w.Start(); err != nil {
 		c.Close()
 		return nil, fmt.Errorf("worker start: %w", err)
 	}
+	s.workerStarted = true
+
+	actx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	startAutoClose(actx, c)
+	cancel()
+
+	return s, nil
+}
+
+// dialTemporal dials until it connects or TemporalDialRetrySeconds have
+// passed, backing off between attempts; 0 tries once.
+func dialTemporal(opts client.Options) (client.Client, error) {
+	deadline := time.Now().Add(time.Duration(cfg.TemporalDialRetrySeconds) * time.Second)
+	backoff := temporalDialInitialBackoff
+	for {
+		c, err := client.Dial(opts)
+		if err == nil {
+			return c, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, err
+		}
+		rlog.Warn("temporal dial failed; retrying", "err", err, "retry_in", backoff.String())
+		time.Sleep(backoff)
+		backoff = min(backoff*2, temporalDialMaxBackoff)
+	}
+}
+
+// reconnectTemporal polls Temporal with backoff while the service is
+// degraded. Once it answers, the worker and the auto-close job start and
+// the workflow endpoints open up.
+func (s *Service) reconnectTemporal(ctx context.Context) {
+	backoff := temporalDialInitialBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, temporalDialMaxBackoff)
+
+		if err := s.pingTemporal(ctx); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.shuttingDown {
+			s.mu.Unlock()
+			return
+		}
+		err := s.worker.Start()
+		if err == nil {
+			s.workerStarted = true
+		}
+		s.mu.Unlock()
+		if err != nil {
+			rlog.Warn("worker start failed while degraded; retrying", "err", err)
+			continue
+		}
+
+		actx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		startAutoClose(actx, s.temporalClient)
+		cancel()
+
+		s.degraded.Store(false)
+		rlog.Info("temporal reachable; left degraded mode")
+		return
+	}
+}
+
+// requireTemporal fails fast with Unavailable while the service is
+// degraded, before a handler does any DB work toward a workflow call.
+func (s *Service) requireTemporal() error {
+	if s.degraded.Load() {
+		return reasonErr(errs.Unavailable, ReasonDegraded, "bill workflows unavailable; retry later")
+	}
+	return nil
+}
 
-	return &Service{temporalClient: c, worker: w}, nil
+// beginCloseWait registers an in-flight close; false once shutdown started.
+func (s *Service) beginCloseWait() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+	s.closeWaits.Add(1)
+	return true
 }
 
+// Shutdown lets in-flight close waits finish (until ctx is done) before
+// stopping the worker and closing the client. The worker keeps running
+// meanwhile, since it executes the close activity those waits depend on.
+// Stopping the worker then drains running activities, so a deploy doesn't
+// cut them off mid-write. That is bounded by WorkerStopTimeout, not ctx: the
+// client is only closed once the worker has stopped.
 func (s *Service) Shutdown(ctx context.Context) {
-	s.worker.Stop()
+	s.mu.Lock()
+	s.shuttingDown = true
+	workerStarted := s.workerStarted
+	s.mu.Unlock()
+	if s.stopReconnect != nil {
+		s.stopReconnect()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		s.closeWaits.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		if workerStarted {
+			s.worker.Stop()
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// Closing the client under running activities would fail their
+		// completions, so wait on: WorkerStopTimeout bounds Stop
+		rlog.Warn("shutdown deadline reached before worker drained; waiting for the worker stop timeout",
+			"inflight_activities", s.inflight.Load())
+		<-stopped
+	}
+
 	s.temporalClient.Close()
 }
+
+// inflightInterceptor counts executing activities for Shutdown's log.
+type inflightInterceptor struct {
+	interceptor.WorkerInterceptorBase
+	n *atomic.Int64
+}
+
+func (i *inflightInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	return &inflightActivity{ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next}, n: i.n}
+}
+
+type inflightActivity struct {
+	interceptor.ActivityInboundInterceptorBase
+	n *atomic.Int64
+}
+
+func (a *inflightActivity) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	a.n.Add(1)
+	defer a.n.Add(-1)
+	return a.Next.ExecuteActivity(ctx, in)
+}
@@ -0,0 +1,154 @@
+package bill
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/worker"
+)
+
+// closeWaitService is a Service over a mocked client whose bill-1 result
+// arrives when release is closed. The client records when it is closed.
+func closeWaitService(t *testing.T, release <-chan struct{}, getStarted chan<- struct{}) (*Service, *atomic.Bool) {
+	var clientClosed atomic.Bool
+	run := mocks.NewWorkflowRun(t)
+	run.On("Get", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(getStarted)
+		<-release
+		if clientClosed.Load() {
+			t.Error("client closed while a close wait was still reading its result")
+		}
+		*args.Get(1).(*BillResult) = BillResult{BillID: "bill-1", TotalMinor: 1250}
+	}).Return(nil)
+
+	c := mocks.NewClient(t)
+	c.On("GetWorkflow", mock.Anything, workflowIDForBill("bill-1"), "").Return(run)
+	c.On("Close").Run(func(mock.Arguments) { clientClosed.Store(true) }).Return()
+
+	return &Service{temporalClient: c, inflight: new(atomic.Int64)}, &clientClosed
+}
+
+// awaitClose waits on the bill's result the way CloseBill does.
+func awaitClose(s *Service) (*BillResult, error) {
+	if !s.beginCloseWait() {
+		return nil, context.Canceled
+	}
+	defer s.closeWaits.Done()
+	var res BillResult
+	err := s.temporalClient.GetWorkflow(context.Background(), workflowIDForBill("bill-1"), "").Get(context.Background(), &res)
+	return &res, err
+}
+
+func TestShutdownDrainsCloseWaits(t *testing.T) {
+	release, getStarted := make(chan struct{}), make(chan struct{})
+	s, clientClosed := closeWaitService(t, release, getStarted)
+
+	type closeResult struct {
+		res *BillResult
+		err error
+	}
+	closed := make(chan closeResult, 1)
+	go func() {
+		res, err := awaitClose(s)
+		closed <- closeResult{res, err}
+	}()
+	<-getStarted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownDone := make(chan struct{})
+	go func() {
+		s.Shutdown(ctx)
+		close(shutdownDone)
+	}()
+
+	// New closes are refused once shutdown has begun
+	for s.beginCloseWait() {
+		s.closeWaits.Done()
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-shutdownDone:
+		t.Fatal("Shutdown returned while a close wait was in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	got := <-closed
+	if got.err != nil || got.res.TotalMinor != 1250 {
+		t.Fatalf("close during shutdown = (%+v, %v), want its result", got.res, got.err)
+	}
+	<-shutdownDone
+	if !clientClosed.Load() {
+		t.Error("client not closed after the waits drained")
+	}
+}
+
+func TestShutdownDeadlineBoundsCloseWaits(t *testing.T) {
+	release, getStarted := make(chan struct{}), make(chan struct{})
+	s, clientClosed := closeWaitService(t, release, getStarted)
+
+	done := make(chan struct{})
+	go func() {
+		awaitClose(s)
+		close(done)
+	}()
+	<-getStarted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	s.Shutdown(ctx)
+	if !clientClosed.Load() {
+		t.Error("client not closed once the shutdown deadline passed")
+	}
+
+	clientClosed.Store(false) // the stuck wait's late read is expected now
+	close(release)
+	<-done
+}
+
+// stoppingWorker is a worker whose Stop blocks until release is closed, as
+// when it drains a slow activity.
+type stoppingWorker struct {
+	worker.Worker
+	release <-chan struct{}
+	stopped atomic.Bool
+}
+
+func (w *stoppingWorker) Stop() {
+	<-w.release
+	w.stopped.Store(true)
+}
+
+func TestShutdownDeadlineWaitsForWorkerStop(t *testing.T) {
+	release := make(chan struct{})
+	w := &stoppingWorker{release: release}
+	c := mocks.NewClient(t)
+	c.On("Close").Run(func(mock.Arguments) {
+		if !w.stopped.Load() {
+			t.Error("client closed while the worker was still draining activities")
+		}
+	}).Return()
+	s := &Service{temporalClient: c, worker: w, workerStarted: true, inflight: new(atomic.Int64)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Shutdown(ctx)
+		close(done)
+	}()
+
+	<-ctx.Done()
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned past its deadline before the worker stopped")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+}
@@ -1,16 +1,57 @@
 package bill
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
 
 type Currency string
 
 const (
 	CurrencyUSD Currency = "USD"
 	CurrencyGEL Currency = "GEL"
+	CurrencyEUR Currency = "EUR"
+	CurrencyGBP Currency = "GBP"
+	CurrencyJPY Currency = "JPY"
 )
 
+// AllCurrencies is the source of truth for supported currencies; keep it in
+// step with the CHECK constraints in migrations.
+func AllCurrencies() []Currency {
+	return []Currency{CurrencyUSD, CurrencyGEL, CurrencyEUR, CurrencyGBP, CurrencyJPY}
+}
+
 func (c Currency) Valid() bool {
-	return c == CurrencyUSD || c == CurrencyGEL
+	for _, v := range AllCurrencies() {
+		if c == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCurrency reads a currency code in any case ("usd", "Usd") and
+// returns its canonical uppercase form; unknown codes are an error.
+func ParseCurrency(s string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(s)))
+	if !c.Valid() {
+		return "", fmt.Errorf("unsupported currency %q", s)
+	}
+	return c, nil
+}
+
+// MinorUnits is the number of decimal places in the currency's major unit,
+// i.e. amount_minor / 10^MinorUnits is the major amount. JPY has none, so
+// its amount_minor is whole yen.
+func (c Currency) MinorUnits() int {
+	if c == CurrencyJPY {
+		return 0
+	}
+	return 2
 }
 
 type BillStatus string
@@ -18,8 +59,42 @@ type BillStatus string
 const (
 	StatusOpen   BillStatus = "OPEN"
 	StatusClosed BillStatus = "CLOSED"
+	StatusVoid   BillStatus = "VOID" // cancelled; never charged
 )
 
+// AllStatuses is the source of truth for valid statuses; add new ones here.
+func AllStatuses() []BillStatus {
+	return []BillStatus{StatusOpen, StatusClosed, StatusVoid}
+}
+
+func (s BillStatus) Valid() bool {
+	for _, v := range AllStatuses() {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+type DiscountType string
+
+const (
+	DiscountPercent DiscountType = "PERCENT" // Value is whole percent, 1..100
+	DiscountFixed   DiscountType = "FIXED"   // Value is minor units of the bill currency
+)
+
+func (t DiscountType) Valid() bool {
+	return t == DiscountPercent || t == DiscountFixed
+}
+
+type Discount struct {
+	ID        string
+	BillID    string
+	Type      DiscountType
+	Value     int64
+	CreatedAt time.Time
+}
+
 type Bill struct {
 	ID         string
 	Status     BillStatus
@@ -27,6 +102,36 @@ type Bill struct {
 	TotalMinor int64
 	CreatedAt  time.Time
 	ClosedAt   *time.Time
+	UpdatedAt  time.Time // touched by every mutation
+
+	// TaxRateBps is fixed at creation; the rest is the close-time breakdown
+	// of TotalMinor (all zero while the bill is open)
+	TaxRateBps    int
+	SubtotalMinor int64
+	DiscountMinor int64
+	TaxMinor      int64
+
+	// Rounding for tax and percent discounts, fixed at creation
+	RoundingMode RoundingMode
+
+	// Free-text note (PO number, internal reference); frozen at close
+	Memo string
+
+	// Temporal run ID of the bill workflow's first run; later runs (after
+	// continue-as-new) chain from it. Empty for rows from before it was kept.
+	RunID string
+
+	// Tenant the bill belongs to; "" for bills from before owner scoping
+	OwnerID string
+
+	// Close-time conversion of TotalMinor; zero values when conversion was
+	// off. FXRatePPM is the rate used, times 10^6.
+	BaseCurrency   Currency
+	BaseTotalMinor int64
+	FXRatePPM      int64
+
+	// Derived; populated by the join read queries only
+	ItemCount int
 }
 
 type LineItem struct {
@@ -35,4 +140,104 @@ type LineItem struct {
 	Description string
 	AmountMinor int64
 	CreatedAt   time.Time
+	Proration   *Proration // inputs kept for audit when the amount was prorated
+	Kind        LineItemKind
+	Category    string // optional label for grouping; "" is uncategorized
+}
+
+// LineItemKind tells items a user added from lines the system generates
+// (tax, discount, rounding), so UIs and reports can treat them apart.
+type LineItemKind string
+
+const (
+	LineItemKindUser     LineItemKind = "user"
+	LineItemKindTax      LineItemKind = "tax"
+	LineItemKindDiscount LineItemKind = "discount"
+	LineItemKindRounding LineItemKind = "rounding"
+)
+
+// AllLineItemKinds is the source of truth for valid kinds; the kind column's
+// CHECK constraint must match it.
+func AllLineItemKinds() []LineItemKind {
+	return []LineItemKind{LineItemKindUser, LineItemKindTax, LineItemKindDiscount, LineItemKindRounding}
+}
+
+func (k LineItemKind) Valid() bool {
+	for _, v := range AllLineItemKinds() {
+		if k == v {
+			return true
+		}
+	}
+	return false
+}
+
+// BillEvent is one entry in a bill's audit trail, written by DB triggers
+// in the same transaction as the change it records.
+type BillEvent struct {
+	ID        int64
+	BillID    string
+	Type      string // one of AllEventTypes
+	Payload   json.RawMessage
+	CreatedAt time.Time
+}
+
+// AllEventTypes lists the bill_events.type values the triggers write.
+func AllEventTypes() []string {
+	return []string{
+		"created", "item_added", "item_updated", "item_removed",
+		"discount_applied", "currency_changed", "memo_changed", "invoice_issued",
+		"closed", "voided", "deleted", "total_recomputed",
+	}
+}
+
+// Invoice charges an open bill's items so far without closing it. Issued
+// invoices are immutable; Items are the line items frozen on it.
+type Invoice struct {
+	ID         string
+	BillID     string
+	Currency   Currency
+	TotalMinor int64 // sum of Items
+	CreatedAt  time.Time
+	Items      []*LineItem
+}
+
+// Proration charges FullAmountMinor for the share of [PeriodStart, PeriodEnd)
+// covered by [CoveredStart, CoveredEnd). Stored as JSONB on the line item.
+type Proration struct {
+	PeriodStart     time.Time    `json:"period_start"`
+	PeriodEnd       time.Time    `json:"period_end"`
+	CoveredStart    time.Time    `json:"covered_start"`
+	CoveredEnd      time.Time    `json:"covered_end"`
+	FullAmountMinor int64        `json:"full_amount_minor"`
+	Rounding        RoundingMode `json:"rounding"` // default HALF_UP
+}
+
+func (p *Proration) Validate() error {
+	switch {
+	case !p.PeriodStart.Before(p.PeriodEnd):
+		return errors.New("period_start must be before period_end")
+	case !p.CoveredStart.Before(p.CoveredEnd):
+		return errors.New("covered_start must be before covered_end")
+	case p.CoveredStart.Before(p.PeriodStart) || p.CoveredEnd.After(p.PeriodEnd):
+		return errors.New("covered range must be within the period")
+	case p.FullAmountMinor <= 0:
+		return errors.New("full_amount_minor must be positive")
+	case p.Rounding != "" && !p.Rounding.Valid():
+		return errors.New("unsupported rounding mode")
+	}
+	return nil
+}
+
+// AmountMinor is FullAmountMinor * covered / period, rounded per Rounding.
+func (p *Proration) AmountMinor() int64 {
+	mode := p.Rounding
+	if mode == "" {
+		mode = RoundHalfUp
+	}
+	num := new(big.Int).Mul(
+		big.NewInt(p.FullAmountMinor),
+		big.NewInt(int64(p.CoveredEnd.Sub(p.CoveredStart))),
+	)
+	den := big.NewInt(int64(p.PeriodEnd.Sub(p.PeriodStart)))
+	return divRound(num, den, mode).Int64() // <= FullAmountMinor, cannot overflow
 }
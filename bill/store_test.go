@@ -0,0 +1,82 @@
+package bill
+
+import (
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestProrationAmountMinor(t *testing.T) {
+	tests := []struct {
+		name            string
+		period, covered [2]time.Time
+		full            int64
+		rounding        RoundingMode
+		want            int64
+	}{
+		{"whole month", [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}, [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}, 3100, "", 3100},
+		{"second half of March", [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}, [2]time.Time{day(2026, 3, 16), day(2026, 4, 1)}, 3100, "", 1600},
+		{"last day of January", [2]time.Time{day(2026, 1, 1), day(2026, 2, 1)}, [2]time.Time{day(2026, 1, 31), day(2026, 2, 1)}, 3100, "", 100},
+		{"first day of September", [2]time.Time{day(2026, 9, 1), day(2026, 10, 1)}, [2]time.Time{day(2026, 9, 1), day(2026, 9, 2)}, 3000, "", 100},
+
+		// a period across a month boundary is prorated by its own length
+		{"mid-month period", [2]time.Time{day(2026, 1, 15), day(2026, 2, 15)}, [2]time.Time{day(2026, 2, 1), day(2026, 2, 15)}, 3100, "", 1400},
+
+		// February: 28 days, 29 in a leap year
+		{"half of February", [2]time.Time{day(2026, 2, 1), day(2026, 3, 1)}, [2]time.Time{day(2026, 2, 15), day(2026, 3, 1)}, 1000, "", 500},
+		{"leap February", [2]time.Time{day(2028, 2, 1), day(2028, 3, 1)}, [2]time.Time{day(2028, 2, 20), day(2028, 3, 1)}, 2900, "", 1000},
+		{"leap day half up", [2]time.Time{day(2028, 2, 1), day(2028, 3, 1)}, [2]time.Time{day(2028, 2, 29), day(2028, 3, 1)}, 1000, "", 34},
+		{"leap day ceil", [2]time.Time{day(2028, 2, 1), day(2028, 3, 1)}, [2]time.Time{day(2028, 2, 29), day(2028, 3, 1)}, 1000, RoundCeil, 35},
+
+		// 1000 * 16/31 = 516.13; 1001 * 15/30 = 500.5
+		{"partial floor", [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}, [2]time.Time{day(2026, 3, 16), day(2026, 4, 1)}, 1000, RoundFloor, 516},
+		{"partial ceil", [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}, [2]time.Time{day(2026, 3, 16), day(2026, 4, 1)}, 1000, RoundCeil, 517},
+		{"tie half up", [2]time.Time{day(2026, 9, 1), day(2026, 10, 1)}, [2]time.Time{day(2026, 9, 16), day(2026, 10, 1)}, 1001, RoundHalfUp, 501},
+		{"tie half even", [2]time.Time{day(2026, 9, 1), day(2026, 10, 1)}, [2]time.Time{day(2026, 9, 16), day(2026, 10, 1)}, 1001, RoundHalfEven, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Proration{
+				PeriodStart: tt.period[0], PeriodEnd: tt.period[1],
+				CoveredStart: tt.covered[0], CoveredEnd: tt.covered[1],
+				FullAmountMinor: tt.full, Rounding: tt.rounding,
+			}
+			if err := p.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got := p.AmountMinor(); got != tt.want {
+				t.Errorf("AmountMinor() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProrationValidate(t *testing.T) {
+	march := [2]time.Time{day(2026, 3, 1), day(2026, 4, 1)}
+	tests := []struct {
+		name            string
+		period, covered [2]time.Time
+		full            int64
+	}{
+		{"empty period", [2]time.Time{march[0], march[0]}, march, 100},
+		{"empty covered range", march, [2]time.Time{day(2026, 3, 5), day(2026, 3, 5)}, 100},
+		{"starts before the period", march, [2]time.Time{day(2026, 2, 28), day(2026, 3, 5)}, 100},
+		{"ends after the period", march, [2]time.Time{day(2026, 3, 20), day(2026, 4, 2)}, 100},
+		{"zero full amount", march, march, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Proration{
+				PeriodStart: tt.period[0], PeriodEnd: tt.period[1],
+				CoveredStart: tt.covered[0], CoveredEnd: tt.covered[1],
+				FullAmountMinor: tt.full,
+			}
+			if err := p.Validate(); err == nil {
+				t.Error("Validate() = nil, want an error")
+			}
+		})
+	}
+}
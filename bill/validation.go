@@ -0,0 +1,582 @@
+package bill
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"encore.dev/beta/errs"
+	"github.com/google/uuid"
+)
+
+// Request validation.
+//
+// Public request types implement Validate() error, which Encore invokes
+// before the handler runs, so handlers start from input that is already
+// well-formed and no DB/Temporal work happens for a bad request. Rules for a
+// type live in one place and report every violation at once.
+
+// FieldViolation is one failed rule.
+type FieldViolation struct {
+	Field    string   `json:"field"`
+	Message  string   `json:"message"`
+	Accepted []string `json:"accepted,omitempty"` // for enum-like fields
+}
+
+// ValidationDetails is attached to InvalidArgument errors from validators.
+type ValidationDetails struct {
+	Violations []FieldViolation `json:"violations"`
+}
+
+func (ValidationDetails) ErrDetails() {}
+
+type violations []FieldViolation
+
+func (v *violations) add(field, msg string) {
+	*v = append(*v, FieldViolation{Field: field, Message: msg})
+}
+
+func (v *violations) addEnum(field, msg string, accepted []string) {
+	*v = append(*v, FieldViolation{Field: field, Message: msg, Accepted: accepted})
+}
+
+// amountCap flags a line item amount over its currency's cap (credits by
+// magnitude). Unsupported currencies are reported by currency instead.
+func (v *violations) amountCap(field string, c Currency, amount int64) {
+	if limit, ok := lineItemAmountCap(c); ok && (amount > limit || amount < -limit) {
+		v.add(field, fmt.Sprintf("exceeds the %s cap of %d minor units", c, limit))
+	}
+}
+
+// majorAmount converts an amount given in major units into *minor, so the
+// rules and handler below only ever see amount_minor. Setting both is an
+// error. A bad currency is reported by currency, not here.
+func (v *violations) majorAmount(field string, major *float64, c Currency, minor *int64) {
+	if major == nil {
+		return
+	}
+	if *minor != 0 {
+		v.add(field, "set amount or amount_minor, not both")
+		return
+	}
+	if !c.Valid() {
+		return
+	}
+	n, err := FromMajor(*major, c)
+	if err != nil {
+		v.add(field, err.Error())
+		return
+	}
+	*minor = n
+}
+
+// currency canonicalizes *c in place, so the handler (and everything it
+// stores) only ever sees the uppercase code.
+func (v *violations) currency(field string, c *Currency) {
+	parsed, err := ParseCurrency(string(*c))
+	if err != nil {
+		v.addEnum(field, err.Error(), currencyNames())
+		return
+	}
+	*c = parsed
+}
+
+// err aggregates all violations into one InvalidArgument, or nil.
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	parts := make([]string, len(v))
+	for i, fv := range v {
+		parts[i] = fv.Field + ": " + fv.Message
+	}
+	return errs.B().
+		Code(errs.InvalidArgument).
+		Msg("invalid request: " + strings.Join(parts, "; ")).
+		Details(ValidationDetails{Violations: v}).
+		Err()
+}
+
+func currencyNames() []string {
+	all := AllCurrencies()
+	names := make([]string, len(all))
+	for i, c := range all {
+		names[i] = string(c)
+	}
+	return names
+}
+
+func lineItemKindNames() []string {
+	all := AllLineItemKinds()
+	names := make([]string, len(all))
+	for i, k := range all {
+		names[i] = string(k)
+	}
+	return names
+}
+
+// lineItemKind checks an optional ?kind= filter; empty means every kind.
+func (v *violations) lineItemKind(field, kind string) {
+	if kind != "" && !LineItemKind(kind).Valid() {
+		v.addEnum(field, "invalid line item kind", lineItemKindNames())
+	}
+}
+
+func statusNames() []string {
+	all := AllStatuses()
+	names := make([]string, len(all))
+	for i, st := range all {
+		names[i] = string(st)
+	}
+	return names
+}
+
+// normalizeDescription trims a line item description and drops control
+// characters (tabs and newlines become spaces), which break CSV and
+// line-oriented consumers downstream. The result must be non-empty and at
+// most cfg.MaxDescriptionLength characters.
+func normalizeDescription(s string) (string, error) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return "", errors.New("description is required")
+	}
+	if n := utf8.RuneCountInString(s); n > cfg.MaxDescriptionLength {
+		return "", fmt.Errorf("description is %d characters; max is %d", n, cfg.MaxDescriptionLength)
+	}
+	return s, nil
+}
+
+// normalizeMemo is normalizeDescription for the bill memo, except that it
+// keeps line breaks (a note may span lines) and empty is allowed: it clears
+// the memo.
+func normalizeMemo(s string) (string, error) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+
+	if n := utf8.RuneCountInString(s); n > cfg.MaxMemoLength {
+		return "", fmt.Errorf("memo is %d characters; max is %d", n, cfg.MaxMemoLength)
+	}
+	return s, nil
+}
+
+// Line item categories are short labels ("hardware", "travel") for
+// grouping, not free text.
+const maxCategoryLength = 64
+
+// normalizeCategory cleans a line item category like normalizeDescription
+// does a description. Empty is allowed: the item is uncategorized.
+func normalizeCategory(s string) (string, error) {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+
+	if n := utf8.RuneCountInString(s); n > maxCategoryLength {
+		return "", fmt.Errorf("category is %d characters; max is %d", n, maxCategoryLength)
+	}
+	return s, nil
+}
+
+// ==============================
+// Validators
+// ==============================
+
+// A year; also keeps the seconds -> time.Duration conversion from overflowing.
+const maxAutoCloseAfterSeconds = 365 * 24 * 60 * 60
+
+func (r *CreateBillRequest) Validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	if r.MaxTotalMinor < 0 {
+		v.add("max_total_minor", "must not be negative")
+	}
+	if r.TaxRateBps < 0 || r.TaxRateBps > 10000 {
+		v.add("tax_rate_bps", "must be between 0 and 10000")
+	}
+	if r.AutoCloseAfterSeconds < 0 || r.AutoCloseAfterSeconds > maxAutoCloseAfterSeconds {
+		v.add("auto_close_after_seconds", fmt.Sprintf("must be between 0 and %d", maxAutoCloseAfterSeconds))
+	}
+	if r.RoundingMode != "" && !r.RoundingMode.Valid() {
+		v.addEnum("rounding_mode", "invalid rounding mode", roundingModeNames())
+	}
+	return v.err()
+}
+
+func (r *AddLineItemRequest) Validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	if _, err := normalizeDescription(r.Description); err != nil {
+		v.add("description", err.Error())
+	}
+	if _, err := normalizeCategory(r.Category); err != nil {
+		v.add("category", err.Error())
+	}
+	if r.LineItemID != "" {
+		if _, err := uuid.Parse(r.LineItemID); err != nil {
+			v.add("line_item_id", "must be a UUID")
+		}
+	}
+
+	if r.Proration == nil {
+		v.majorAmount("amount", r.Amount, r.Currency, &r.AmountMinor)
+		if r.AmountMinor <= 0 {
+			v.add("amount_minor", "amount must be positive")
+		} else {
+			v.amountCap("amount_minor", r.Currency, r.AmountMinor)
+		}
+		return v.err()
+	}
+
+	if r.AmountMinor != 0 {
+		v.add("amount_minor", "computed from proration; omit it")
+	}
+	if r.Amount != nil {
+		v.add("amount", "computed from proration; omit it")
+	}
+	if err := r.Proration.Validate(); err != nil {
+		v.add("proration", err.Error())
+	} else if r.Proration.AmountMinor() <= 0 {
+		v.add("proration", "prorated amount rounds to zero")
+	} else {
+		v.amountCap("proration", r.Currency, r.Proration.AmountMinor())
+	}
+	return v.err()
+}
+
+func (r *AddCreditRequest) Validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	if _, err := normalizeDescription(r.Description); err != nil {
+		v.add("description", err.Error())
+	}
+	v.majorAmount("amount", r.Amount, r.Currency, &r.AmountMinor)
+	if r.AmountMinor >= 0 {
+		v.add("amount_minor", "credit amount must be negative")
+	} else if r.AmountMinor == math.MinInt64 {
+		v.add("amount_minor", "out of range")
+	} else {
+		v.amountCap("amount_minor", r.Currency, r.AmountMinor)
+	}
+	if r.LineItemID != "" {
+		if _, err := uuid.Parse(r.LineItemID); err != nil {
+			v.add("line_item_id", "must be a UUID")
+		}
+	}
+	return v.err()
+}
+
+// Any bad item rejects the whole batch.
+func (r *BatchAddLineItemsRequest) Validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	switch {
+	case len(r.Items) == 0:
+		v.add("items", "at least one item is required")
+	case len(r.Items) > cfg.MaxBatchLineItems:
+		v.add("items", fmt.Sprintf("at most %d items per batch", cfg.MaxBatchLineItems))
+	}
+	var total int64
+	for i := range r.Items {
+		it := &r.Items[i]
+		if _, err := normalizeDescription(it.Description); err != nil {
+			v.add(fmt.Sprintf("items[%d].description", i), err.Error())
+		}
+		if _, err := normalizeCategory(it.Category); err != nil {
+			v.add(fmt.Sprintf("items[%d].category", i), err.Error())
+		}
+		v.majorAmount(fmt.Sprintf("items[%d].amount", i), it.Amount, r.Currency, &it.AmountMinor)
+		if it.AmountMinor <= 0 {
+			v.add(fmt.Sprintf("items[%d].amount_minor", i), "amount must be positive")
+			continue
+		}
+		v.amountCap(fmt.Sprintf("items[%d].amount_minor", i), r.Currency, it.AmountMinor)
+		if err := checkTotalDelta(total, it.AmountMinor); err != nil {
+			v.add("items", "batch total would overflow")
+			break
+		}
+		total += it.AmountMinor
+	}
+	return v.err()
+}
+
+func (r *BatchGetBillsRequest) Validate() error {
+	var v violations
+	switch {
+	case len(r.IDs) == 0:
+		v.add("ids", "at least one id is required")
+	case len(r.IDs) > cfg.MaxBatchGetBills:
+		v.add("ids", fmt.Sprintf("at most %d ids per request", cfg.MaxBatchGetBills))
+	}
+	for i, id := range r.IDs {
+		if id == "" {
+			v.add(fmt.Sprintf("ids[%d]", i), "required")
+		}
+	}
+	return v.err()
+}
+
+func (r *SetCurrencyRequest) Validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	return v.err()
+}
+
+func (r *SetMemoRequest) Validate() error {
+	var v violations
+	if _, err := normalizeMemo(r.Memo); err != nil {
+		v.add("memo", err.Error())
+	}
+	return v.err()
+}
+
+func (r *ApplyDiscountRequest) Validate() error {
+	var v violations
+	switch r.Type {
+	case DiscountPercent:
+		if r.Value < 1 || r.Value > 100 {
+			v.add("value", "percent must be between 1 and 100")
+		}
+	case DiscountFixed:
+		if r.Value <= 0 {
+			v.add("value", "must be positive")
+		}
+	default:
+		v.addEnum("type", "invalid discount type", []string{string(DiscountPercent), string(DiscountFixed)})
+	}
+	return v.err()
+}
+
+func (r *UpdateLineItemRequest) Validate() error {
+	var v violations
+	if r.Description == nil && r.AmountMinor == nil {
+		v.add("description", "empty patch: set description or amount_minor")
+	}
+	if r.Description != nil {
+		if _, err := normalizeDescription(*r.Description); err != nil {
+			v.add("description", err.Error())
+		}
+	}
+	if r.AmountMinor != nil && *r.AmountMinor <= 0 {
+		v.add("amount_minor", "amount must be positive")
+	}
+	// The bill's currency isn't known here; the handler applies its cap
+	if limit, ok := maxLineItemAmountCap(); ok && r.AmountMinor != nil && *r.AmountMinor > limit {
+		v.add("amount_minor", fmt.Sprintf("exceeds the largest line item cap of %d minor units", limit))
+	}
+	return v.err()
+}
+
+func (r *ItemStatsRequest) Validate() error {
+	var v violations
+	v.lineItemKind("kind", r.Kind)
+	return v.err()
+}
+
+func (r *ListBillsRequest) Validate() error {
+	var v violations
+	if r.Status != "" && !BillStatus(r.Status).Valid() {
+		v.addEnum("status", "invalid status", statusNames())
+	}
+	if r.Currency != "" {
+		c := Currency(r.Currency)
+		v.currency("currency", &c)
+		r.Currency = string(c)
+	}
+	switch r.Shape {
+	case "", shapeNested, shapeFlat:
+	default:
+		v.addEnum("shape", "invalid shape", []string{shapeNested, shapeFlat})
+	}
+	if n := utf8.RuneCountInString(strings.TrimSpace(r.Search)); n > cfg.MaxDescriptionLength {
+		v.add("search", fmt.Sprintf("is %d characters; max is %d", n, cfg.MaxDescriptionLength))
+	}
+	if r.Offset < 0 {
+		v.add("offset", "must not be negative")
+	}
+	if r.Offset != 0 && r.Cursor != "" {
+		v.add("offset", "cannot be combined with cursor")
+	}
+	if _, ok := billSortColumns[r.SortBy]; r.SortBy != "" && !ok {
+		v.addEnum("sort_by", "invalid sort field", []string{sortCreatedAt, sortTotal, sortClosedAt})
+	}
+	switch r.SortDir {
+	case "", sortAsc, sortDesc:
+	default:
+		v.addEnum("sort_dir", "invalid sort direction", []string{sortAsc, sortDesc})
+	}
+	if r.Cursor != "" && !(billSort{By: r.SortBy, Dir: r.SortDir}).isDefault() {
+		v.add("cursor", "only supported with the default sort")
+	}
+	return v.err()
+}
+
+func (r *GetBillWithItemsRequest) Validate() error {
+	var v violations
+	switch r.Consistency {
+	case "", consistencyEventual, consistencyStrong:
+	default:
+		v.addEnum("consistency", "invalid consistency", []string{consistencyEventual, consistencyStrong})
+	}
+	switch r.GroupBy {
+	case "", groupByCategory:
+	default:
+		v.addEnum("group_by", "invalid group_by", []string{groupByCategory})
+	}
+	return v.err()
+}
+
+func (r *ListBillEventsRequest) Validate() error {
+	var v violations
+	if r.Type != "" {
+		known := false
+		for _, t := range AllEventTypes() {
+			known = known || t == r.Type
+		}
+		if !known {
+			v.addEnum("type", "invalid event type", AllEventTypes())
+		}
+	}
+	return v.err()
+}
+
+func (r *ListLineItemsRequest) Validate() error {
+	var v violations
+	if r.Offset < 0 {
+		v.add("offset", "must not be negative")
+	}
+	v.lineItemKind("kind", r.Kind)
+	return v.err()
+}
+
+// Like ImportBillRequest, checked after requireAdmin.
+func (r *SetTenantCurrenciesRequest) validate() error {
+	var v violations
+	for i := range r.Currencies {
+		v.currency(fmt.Sprintf("currencies[%d]", i), &r.Currencies[i])
+	}
+	return v.err()
+}
+
+// Like ImportBillRequest, checked after requireAdmin.
+func (r *BackfillLineItemRequest) validate() error {
+	var v violations
+	v.currency("currency", &r.Currency)
+	if _, err := normalizeDescription(r.Description); err != nil {
+		v.add("description", err.Error())
+	}
+	if r.AmountMinor <= 0 {
+		v.add("amount_minor", "amount must be positive")
+	} else {
+		v.amountCap("amount_minor", r.Currency, r.AmountMinor)
+	}
+	switch {
+	case r.CreatedAt.IsZero():
+		v.add("created_at", "required")
+	case r.CreatedAt.After(time.Now()):
+		v.add("created_at", "must not be in the future")
+	}
+	if r.LineItemID != "" {
+		if _, err := uuid.Parse(r.LineItemID); err != nil {
+			v.add("line_item_id", "must be a UUID")
+		}
+	}
+	return v.err()
+}
+
+// validate is not Encore's Validate hook: admin handlers call it after
+// requireAdmin so unauthenticated callers learn nothing about the payload.
+func (r *ImportBillRequest) validate() error {
+	var v violations
+
+	if r.ID == "" {
+		v.add("id", "required")
+	}
+	v.currency("currency", &r.Currency)
+	if r.CreatedAt.IsZero() {
+		v.add("created_at", "required")
+	}
+
+	switch r.Status {
+	case StatusOpen:
+		if r.ClosedAt != nil {
+			v.add("closed_at", "open bill cannot have closed_at")
+		}
+		if r.TotalMinor != 0 {
+			v.add("total_minor", "open bill total is accrued by the workflow; must be 0")
+		}
+	case StatusClosed:
+		if r.ClosedAt == nil || r.ClosedAt.Before(r.CreatedAt) {
+			v.add("closed_at", "closed bill requires closed_at after created_at")
+		}
+		if r.TotalMinor < 0 {
+			v.add("total_minor", "must not be negative")
+		}
+		if r.StartWorkflow {
+			v.add("start_workflow", "only valid for open bills")
+		}
+	default:
+		v.addEnum("status", "invalid status", []string{string(StatusOpen), string(StatusClosed)})
+	}
+
+	if r.Status == StatusOpen && len(r.Items) > cfg.MaxLineItems {
+		v.add("items", fmt.Sprintf("open bills hold at most %d items", cfg.MaxLineItems))
+	}
+
+	var total int64
+	seen := make(map[string]bool, len(r.Items))
+	for i := range r.Items {
+		it := &r.Items[i]
+		switch {
+		case it.ID == "":
+			v.add("items.id", "required")
+		case seen[it.ID]:
+			v.add("items.id", "duplicate line item id "+it.ID)
+		}
+		seen[it.ID] = true
+		// Imports skip the activities, so clean descriptions here the way
+		// an add would
+		if description, err := normalizeDescription(it.Description); err != nil {
+			v.add("items.description", err.Error())
+		} else {
+			it.Description = description
+		}
+		if it.AmountMinor <= 0 {
+			v.add("items.amount_minor", "amount must be positive")
+		} else if err := checkTotalDelta(total, it.AmountMinor); err != nil {
+			v.add("items.amount_minor", "items total would overflow")
+		} else {
+			total += it.AmountMinor
+		}
+	}
+	return v.err()
+}
@@ -0,0 +1,234 @@
+package bill
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+func TestUpdateLineItemRequestMergePatch(t *testing.T) {
+	description := "  renamed  "
+	amount := int64(500)
+	zero := int64(0)
+
+	tests := []struct {
+		name string
+		req  UpdateLineItemRequest
+		want errs.ErrCode
+	}{
+		{"empty patch", UpdateLineItemRequest{}, errs.InvalidArgument},
+		{"description only", UpdateLineItemRequest{Description: &description}, errs.OK},
+		{"amount only", UpdateLineItemRequest{AmountMinor: &amount}, errs.OK},
+		{"both", UpdateLineItemRequest{Description: &description, AmountMinor: &amount}, errs.OK},
+		{"zero amount", UpdateLineItemRequest{AmountMinor: &zero}, errs.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errCode(tt.req.Validate()); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineItemCategoryValidation(t *testing.T) {
+	long := strings.Repeat("x", maxCategoryLength+1)
+
+	tests := []struct {
+		name string
+		req  interface{ Validate() error }
+		want errs.ErrCode
+	}{
+		{"add without category", &AddLineItemRequest{Description: "a", AmountMinor: 100, Currency: CurrencyUSD}, errs.OK},
+		{"add with category", &AddLineItemRequest{Description: "a", AmountMinor: 100, Currency: CurrencyUSD, Category: " travel "}, errs.OK},
+		{"add category too long", &AddLineItemRequest{Description: "a", AmountMinor: 100, Currency: CurrencyUSD, Category: long}, errs.InvalidArgument},
+		{"batch category too long", &BatchAddLineItemsRequest{Currency: CurrencyUSD, Items: []BatchLineItemInput{
+			{Description: "a", AmountMinor: 100, Category: "travel"},
+			{Description: "b", AmountMinor: 100, Category: long},
+		}}, errs.InvalidArgument},
+		{"flat read", &GetBillWithItemsRequest{}, errs.OK},
+		{"group by category", &GetBillWithItemsRequest{GroupBy: "category"}, errs.OK},
+		{"group by unknown", &GetBillWithItemsRequest{GroupBy: "kind"}, errs.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errCode(tt.req.Validate()); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCategory(t *testing.T) {
+	got, err := normalizeCategory("  office\tsupplies\n")
+	if err != nil || got != "office supplies" {
+		t.Errorf(`normalizeCategory = %q, %v; want "office supplies", nil`, got, err)
+	}
+	if got, err := normalizeCategory("   "); err != nil || got != "" {
+		t.Errorf(`blank category = %q, %v; want "", nil`, got, err)
+	}
+}
+
+// violatedFields lists the fields of a validator's error, in order.
+func violatedFields(err error) []string {
+	if err == nil {
+		return nil
+	}
+	details, _ := errs.Details(err).(ValidationDetails)
+	fields := make([]string, len(details.Violations))
+	for i, fv := range details.Violations {
+		fields[i] = fv.Field
+	}
+	return fields
+}
+
+func TestRequestValidators(t *testing.T) {
+	yesterday := time.Now().Add(-24 * time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+	major, tooPrecise := 10.5, 10.005
+	uuid1 := "6a1f4f6e-2f0a-4c36-9a44-2f3d1b0b8e11"
+
+	tests := []struct {
+		name     string
+		validate func() error
+		want     []string // violated fields; nil when valid
+	}{
+		{"create ok", (&CreateBillRequest{Currency: "usd", TaxRateBps: 825, RoundingMode: RoundHalfEven}).Validate, nil},
+		{"create bad", (&CreateBillRequest{Currency: "XXX", MaxTotalMinor: -1, TaxRateBps: 10001, AutoCloseAfterSeconds: -1, RoundingMode: "UP"}).Validate,
+			[]string{"currency", "max_total_minor", "tax_rate_bps", "auto_close_after_seconds", "rounding_mode"}},
+
+		{"add ok", (&AddLineItemRequest{Description: "seat", Amount: &major, Currency: CurrencyUSD, LineItemID: uuid1}).Validate, nil},
+		{"add bad", (&AddLineItemRequest{Description: " ", AmountMinor: 0, Currency: CurrencyUSD, LineItemID: "not-a-uuid"}).Validate,
+			[]string{"description", "line_item_id", "amount_minor"}},
+		{"add too precise", (&AddLineItemRequest{Description: "seat", Amount: &tooPrecise, Currency: CurrencyUSD}).Validate,
+			[]string{"amount", "amount_minor"}},
+
+		{"credit ok", (&AddCreditRequest{Description: "refund", AmountMinor: -500, Currency: CurrencyUSD}).Validate, nil},
+		{"credit positive", (&AddCreditRequest{Description: "refund", AmountMinor: 500, Currency: CurrencyUSD}).Validate, []string{"amount_minor"}},
+		{"credit MinInt64", (&AddCreditRequest{Description: "refund", AmountMinor: math.MinInt64, Currency: CurrencyUSD}).Validate, []string{"amount_minor"}},
+
+		{"batch ok", (&BatchAddLineItemsRequest{Currency: CurrencyUSD, Items: []BatchLineItemInput{{Description: "a", AmountMinor: 1}}}).Validate, nil},
+		{"batch empty", (&BatchAddLineItemsRequest{Currency: CurrencyUSD}).Validate, []string{"items"}},
+		{"batch bad item", (&BatchAddLineItemsRequest{Currency: CurrencyUSD, Items: []BatchLineItemInput{{Description: "a", AmountMinor: 1}, {Description: "", AmountMinor: -1}}}).Validate,
+			[]string{"items[1].description", "items[1].amount_minor"}},
+
+		{"batch get ok", (&BatchGetBillsRequest{IDs: []string{"a", "b"}}).Validate, nil},
+		{"batch get bad", (&BatchGetBillsRequest{IDs: []string{"a", ""}}).Validate, []string{"ids[1]"}},
+		{"batch get none", (&BatchGetBillsRequest{}).Validate, []string{"ids"}},
+
+		{"set currency ok", (&SetCurrencyRequest{Currency: "eur"}).Validate, nil},
+		{"set currency bad", (&SetCurrencyRequest{Currency: "EURO"}).Validate, []string{"currency"}},
+
+		{"memo ok", (&SetMemoRequest{Memo: "PO 1234\nnet 30"}).Validate, nil},
+		{"memo clear", (&SetMemoRequest{}).Validate, nil},
+		{"memo too long", (&SetMemoRequest{Memo: strings.Repeat("m", cfg.MaxMemoLength+1)}).Validate, []string{"memo"}},
+
+		{"discount percent ok", (&ApplyDiscountRequest{Type: DiscountPercent, Value: 100}).Validate, nil},
+		{"discount percent over", (&ApplyDiscountRequest{Type: DiscountPercent, Value: 101}).Validate, []string{"value"}},
+		{"discount fixed zero", (&ApplyDiscountRequest{Type: DiscountFixed}).Validate, []string{"value"}},
+		{"discount type", (&ApplyDiscountRequest{Type: "BOGO", Value: 1}).Validate, []string{"type"}},
+
+		{"item stats ok", (&ItemStatsRequest{Kind: "tax"}).Validate, nil},
+		{"item stats bad", (&ItemStatsRequest{Kind: "fee"}).Validate, []string{"kind"}},
+
+		{"list ok", (&ListBillsRequest{Status: "CLOSED", Currency: "gel", SortBy: sortTotal, SortDir: sortAsc}).Validate, nil},
+		{"list bad", (&ListBillsRequest{Status: "PAID", Currency: "XXX", Shape: "tree", Offset: -1, SortBy: "id", SortDir: "up"}).Validate,
+			[]string{"status", "currency", "shape", "offset", "sort_by", "sort_dir"}},
+		{"list offset with cursor", (&ListBillsRequest{Offset: 10, Cursor: "c"}).Validate, []string{"offset"}},
+		{"list cursor with sort", (&ListBillsRequest{Cursor: "c", SortBy: sortTotal}).Validate, []string{"cursor"}},
+
+		{"get ok", (&GetBillWithItemsRequest{Consistency: consistencyStrong}).Validate, nil},
+		{"get bad", (&GetBillWithItemsRequest{Consistency: "linearizable"}).Validate, []string{"consistency"}},
+
+		{"events ok", (&ListBillEventsRequest{Type: AllEventTypes()[0]}).Validate, nil},
+		{"events bad", (&ListBillEventsRequest{Type: "renamed"}).Validate, []string{"type"}},
+
+		{"line items ok", (&ListLineItemsRequest{Kind: "user"}).Validate, nil},
+		{"line items bad", (&ListLineItemsRequest{Offset: -1, Kind: "fee"}).Validate, []string{"offset", "kind"}},
+
+		{"tenant currencies ok", (&SetTenantCurrenciesRequest{Currencies: []Currency{"usd", CurrencyEUR}}).validate, nil},
+		{"tenant currencies bad", (&SetTenantCurrenciesRequest{Currencies: []Currency{CurrencyEUR, "XXX"}}).validate, []string{"currencies[1]"}},
+
+		{"backfill ok", (&BackfillLineItemRequest{Description: "seat", AmountMinor: 100, Currency: CurrencyUSD, CreatedAt: yesterday}).validate, nil},
+		{"backfill bad", (&BackfillLineItemRequest{Description: "seat", AmountMinor: 0, Currency: CurrencyUSD, CreatedAt: tomorrow, LineItemID: "x"}).validate,
+			[]string{"amount_minor", "created_at", "line_item_id"}},
+
+		{"import ok", (&ImportBillRequest{ID: "legacy-1", Status: StatusClosed, Currency: CurrencyUSD, TotalMinor: 100, CreatedAt: yesterday, ClosedAt: &yesterday,
+			Items: []ImportLineItem{{ID: "i1", Description: "seat", AmountMinor: 100}}}).validate, nil},
+		{"import open with total", (&ImportBillRequest{ID: "legacy-2", Status: StatusOpen, Currency: CurrencyUSD, TotalMinor: 100, CreatedAt: yesterday}).validate,
+			[]string{"total_minor"}},
+		{"import bad items", (&ImportBillRequest{ID: "legacy-3", Status: StatusClosed, Currency: CurrencyUSD, CreatedAt: yesterday, ClosedAt: &yesterday,
+			Items: []ImportLineItem{{ID: "i1", Description: "a", AmountMinor: 1}, {ID: "i1", Description: "b", AmountMinor: 0}}}).validate,
+			[]string{"items.id", "items.amount_minor"}},
+		{"import bad description", (&ImportBillRequest{ID: "legacy-4", Status: StatusClosed, Currency: CurrencyUSD, CreatedAt: yesterday, ClosedAt: &yesterday,
+			Items: []ImportLineItem{{ID: "i1", Description: " \n\t", AmountMinor: 1}}}).validate,
+			[]string{"items.description"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validate()
+			if err != nil && errs.Code(err) != errs.InvalidArgument {
+				t.Fatalf("code = %v, want InvalidArgument", errs.Code(err))
+			}
+			if got := violatedFields(err); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("violated fields = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestImportNormalizesDescriptions(t *testing.T) {
+	now := time.Now()
+	req := &ImportBillRequest{ID: "legacy-1", Status: StatusOpen, Currency: CurrencyUSD, CreatedAt: now,
+		Items: []ImportLineItem{{ID: "i1", Description: "  seat\tfee\x00 ", AmountMinor: 100}}}
+	if err := req.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Items[0].Description; got != "seat fee" {
+		t.Errorf("description = %q, want %q", got, "seat fee")
+	}
+}
+
+func TestBatchAddOverLimit(t *testing.T) {
+	batch := func(n int) *BatchAddLineItemsRequest {
+		req := &BatchAddLineItemsRequest{Currency: CurrencyUSD, Items: make([]BatchLineItemInput, n)}
+		for i := range req.Items {
+			req.Items[i] = BatchLineItemInput{Description: "seat", AmountMinor: 1}
+		}
+		return req
+	}
+
+	if err := batch(cfg.MaxBatchLineItems).Validate(); err != nil {
+		t.Fatalf("batch at the limit: %v", err)
+	}
+	err := batch(cfg.MaxBatchLineItems + 1).Validate()
+	if errCode(err) != errs.InvalidArgument {
+		t.Fatalf("batch over the limit = %v, want InvalidArgument", err)
+	}
+	if got := violatedFields(err); strings.Join(got, ",") != "items" {
+		t.Errorf("violated fields = %v, want [items]", got)
+	}
+}
+
+func TestBatchSignalPayloadLimit(t *testing.T) {
+	signal := func(description string) BatchAddLineItemsSignal {
+		sig := BatchAddLineItemsSignal{Currency: CurrencyUSD, Items: make([]BatchLineItem, cfg.MaxBatchLineItems)}
+		for i := range sig.Items {
+			sig.Items[i] = BatchLineItem{LineItemID: "6a1f4f6e-2f0a-4c36-9a44-2f3d1b0b8e11", Description: description, AmountMinor: 1}
+		}
+		return sig
+	}
+
+	if err := checkSignalPayload(signal("seat")); err != nil {
+		t.Fatalf("small batch: %v", err)
+	}
+	// Every item within the description limit, but three bytes per rune
+	// take the batch past the payload limit
+	err := checkSignalPayload(signal(strings.Repeat("€", cfg.MaxDescriptionLength)))
+	if errCode(err) != errs.InvalidArgument {
+		t.Errorf("oversized batch signal = %v, want InvalidArgument", err)
+	}
+}
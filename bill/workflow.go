@@ -3,41 +3,278 @@ package bill
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 )
 
 const (
-	signalAddLineItem = "add-line-item"
-	signalCloseBill   = "close-bill"
+	signalAddLineItem    = "add-line-item"
+	signalBatchAddItems  = "batch-add-line-items"
+	signalUpdateLineItem = "update-line-item"
+	signalRemoveLineItem = "remove-line-item"
+	signalApplyDiscount  = "apply-discount"
+	signalSetCurrency    = "set-currency"
+	signalCloseBill      = "close-bill"
+	signalVoidBill       = "void-bill"
+	signalDeleteBill     = "delete-bill"
+	signalIssueInvoice   = "issue-invoice"
+	signalSetMemo        = "set-memo"
+
+	queryBillState  = "bill-state"
+	queryBillStatus = "status"
+	queryBillTotals = "bill-totals"
 )
 
+// Lifecycle as the workflow sees it; CLOSING spans the close signal until
+// CloseBillActivity has committed.
+const (
+	workflowStatusOpen    = "OPEN"
+	workflowStatusClosing = "CLOSING"
+	workflowStatusClosed  = "CLOSED"
+	workflowStatusVoid    = "VOID"
+	workflowStatusDeleted = "DELETED"
+)
+
+// Answer to the bill-totals query: just the running total, cheap enough
+// for a UI to poll. LastUpdated is when the workflow last handled a signal
+// (or the run started), so a client can tell a stale value from a fresh one.
+type BillTotals struct {
+	TotalMinor  int64     `json:"total_minor"`
+	ItemCount   int       `json:"item_count"`
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+type BillWorkflowStatus struct {
+	Status    string `json:"status"`
+	ItemCount int    `json:"item_count"`
+
+	// Set once the bill holds MaxLineItems; further adds are rejected
+	ItemLimitReached bool `json:"item_limit_reached"`
+
+	// Adds the workflow dropped after the API accepted them; Rejections
+	// holds the most recent, so a client can look up its line_item_id
+	RejectedLineItems int                `json:"rejected_line_items"`
+	Rejections        []RejectedLineItem `json:"rejections"`
+}
+
+// RejectedLineItem is one add the workflow refused. Reason is one of the
+// Reason* constants; LineItemID is empty for a direct signal without one.
+type RejectedLineItem struct {
+	LineItemID string `json:"line_item_id,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// CarriedLineItem is what a continued run keeps of an earlier run's item:
+// enough to dedupe, count, edit, remove and invoice it.
+type CarriedLineItem struct {
+	ID          string
+	AmountMinor int64
+}
+
+// Rejections kept in BillResult; older ones are only counted.
+const maxRecordedRejections = 50
+
 // Start params must include BillID (generated by handler).
 type BillWorkflowParams struct {
 	BillID   string
 	Currency Currency
+
+	// Optional: seeds the running state, e.g. for imported open bills
+	// whose line items already exist in the DB.
+	Initial *BillResult
+
+	// Optional: adds that would push TotalMinor above this are rejected
+	// (and counted in BillResult.RejectedLineItems). 0 means no ceiling.
+	MaxTotalMinor int64
+
+	// Optional: tax in basis points, charged on the discounted subtotal at
+	// close. 0 means untaxed.
+	TaxRateBps int
+
+	// Optional: adds beyond this many items are rejected (and counted in
+	// BillResult.RejectedLineItems) to bound the workflow history. Taken
+	// from config at start so replays see a fixed value. 0 means no limit.
+	MaxLineItems int
+
+	// Optional: close the bill after this long without an add signal.
+	// 0 means never auto-close.
+	AutoCloseAfter time.Duration
+
+	// Optional: rounding for tax and percent discounts at close. Empty is
+	// HALF_UP, which is what runs started without it computed.
+	RoundingMode RoundingMode
+
+	// Optional: convert the closed total into this currency via
+	// ConvertCurrencyActivity. Empty skips it, so older runs replay
+	// unchanged.
+	BaseCurrency Currency
+
+	// Tenant the bill belongs to, stored on the row at creation. Adds that
+	// name a different owner are rejected. Empty for older runs, whose
+	// signals carry none either.
+	OwnerID string
+
+	// Optional: continue as new after handling this many signals, carrying
+	// the state over in Initial. 0 leaves only the history length trigger
+	// (continueAsNewHistoryLength), which older runs have too.
+	ContinueAsNewAfterSignals int
+}
+
+// History length (events) at which a bill continues as new regardless of
+// its signal count; well under Temporal's hard limit.
+const continueAsNewHistoryLength = 10000
+
+// continueAsNewDue reports whether a run has grown enough to continue as
+// new: limit handled signals, when a limit is set, or
+// continueAsNewHistoryLength events either way.
+func continueAsNewDue(limit, handled, historyLength int) bool {
+	return (limit > 0 && handled >= limit) || historyLength >= continueAsNewHistoryLength
 }
 
 // Signals also include LineItemID for idempotency.
 type AddLineItemSignal struct {
 	LineItemID  string
 	Description string
-	AmountMinor int64
+	Category    string // optional; "" is uncategorized
+	AmountMinor int64  // negative for a credit
 	Currency    Currency
+	Proration   *Proration
+
+	// Credits (refunds, adjustments) carry a negative amount and may not
+	// take the running total below zero
+	Credit bool
+
+	// Caller's tenant. The API checks it against the row, except right
+	// after CreateBill when the row may not exist yet; the workflow checks.
+	OwnerID string
+
+	// Original timestamp of a backfilled item; nil stamps it now
+	CreatedAt *time.Time
 }
 
-type CloseBillSignal struct{}
+// Items are accepted or rejected together.
+type BatchAddLineItemsSignal struct {
+	Currency Currency
+	Items    []BatchLineItem
+}
+
+type BatchLineItem struct {
+	LineItemID  string
+	Description string
+	Category    string
+	AmountMinor int64
+}
+
+// Nil fields are left unchanged. Unknown IDs are ignored.
+type UpdateLineItemSignal struct {
+	LineItemID  string
+	Description *string
+	AmountMinor *int64
+}
+
+// Unknown (or already removed) IDs are ignored, so resending is safe.
+type RemoveLineItemSignal struct {
+	LineItemID string
+}
+
+// Carries DiscountID for idempotency, like line items.
+type ApplyDiscountSignal struct {
+	DiscountID string
+	Type       DiscountType
+	Value      int64
+}
+
+// Ignored once the bill has items; the activity re-checks against the DB.
+type SetCurrencySignal struct {
+	Currency Currency
+}
+
+// RequestID identifies the CloseBill call; the first close the workflow
+// receives wins and its ID is echoed in BillResult.CloseRequestID.
+type CloseBillSignal struct {
+	RequestID string
+}
+
+// Ends the bill without a charge.
+type VoidBillSignal struct {
+	Reason string
+}
+
+// Soft-deletes the bill (voiding it if still open) and ends the workflow.
+type DeleteBillSignal struct{}
+
+// Invoices the items so far and restarts the running total; the bill stays
+// open. InvoiceID names the invoice, so activity retries don't issue twice.
+type IssueInvoiceSignal struct {
+	InvoiceID string
+}
+
+// Replaces the bill's memo; empty clears it. Only the DB row holds it.
+type SetMemoSignal struct {
+	Memo string
+}
 
 type BillResult struct {
-	BillID      string
-	Currency    Currency
-	TotalMinor  int64
-	LineItemIDs []string
+	BillID     string
+	Currency   Currency
+	TotalMinor int64
+	Items      []LineItem // persisted items, in insertion order
+	Discounts  []Discount
+
+	// Items from before the run continued as new, as ID and amount only so
+	// the carried state stays small; Items holds those added since. Both
+	// only cover uninvoiced items.
+	CarriedItems []CarriedLineItem
+
+	// Items charged by invoices so far. They leave Items and CarriedItems,
+	// but a re-sent add for one is still a duplicate.
+	InvoicedLineItemIDs []string
+
+	// Set at close: TotalMinor is the item sum while the bill is open and
+	// SubtotalMinor - DiscountMinor + TaxMinor once it is closed.
+	SubtotalMinor int64
+	DiscountMinor int64
+	TaxMinor      int64
+
+	// Voided bills are never charged; TotalMinor is what would have been
+	Voided bool
+
+	// Deleted bills were soft-deleted while open, and are voided too
+	Deleted bool
+
+	// Sum of invoices issued so far. Items and TotalMinor only cover what
+	// no invoice took, so the lifetime total is InvoicedMinor + TotalMinor.
+	InvoicedMinor int64
+
+	// Set at close when params.BaseCurrency is: TotalMinor converted at
+	// FXRatePPM (base units per bill unit, times 10^6)
+	BaseCurrency   Currency
+	BaseTotalMinor int64
+	FXRatePPM      int64
+
+	// RequestID of the close signal that closed the bill; empty when it
+	// auto-closed. Lets racing CloseBill calls tell which one won.
+	CloseRequestID string
+
+	// Add signals dropped by a currency mismatch, the MaxTotalMinor
+	// ceiling, the MaxLineItems limit or the overflow guard; a rejected
+	// batch counts each of its items. Rejections holds the latest few.
+	RejectedLineItems int
+	Rejections        []RejectedLineItem
+
+	// Items removed so far, so a resent removal is recognised and the
+	// total only drops once
+	RemovedLineItemIDs []string
 }
 
 func BillLifecycleWorkflow(ctx workflow.Context, params BillWorkflowParams) (*BillResult, error) {
+	// Transient (DB) errors retry with backoff until either the attempts or
+	// the overall ScheduleToClose budget run out; business errors are
+	// returned as nonRetryable and fail on the first attempt.
 	ao := workflow.ActivityOptions{
-		StartToCloseTimeout: 10 * time.Second,
+		StartToCloseTimeout:    10 * time.Second,
+		ScheduleToCloseTimeout: time.Minute,
 		RetryPolicy: &temporal.RetryPolicy{
 			InitialInterval:    200 * time.Millisecond,
 			BackoffCoefficient: 2.0,
@@ -51,32 +288,210 @@ func BillLifecycleWorkflow(ctx workflow.Context, params BillWorkflowParams) (*Bi
 	var bill Bill
 	if err := workflow.ExecuteActivity(ctx,
 		CreateBillRowActivity,
-		CreateBillRowInput{BillID: params.BillID, Currency: params.Currency},
+		CreateBillRowInput{
+			BillID:       params.BillID,
+			Currency:     params.Currency,
+			TaxRateBps:   params.TaxRateBps,
+			RoundingMode: params.RoundingMode,
+			OwnerID:      params.OwnerID,
+		},
 	).Get(ctx, &bill); err != nil {
 		return nil, err
 	}
 
 	state := &BillResult{
-		BillID:      params.BillID,
-		Currency:    params.Currency,
-		TotalMinor:  0,
-		LineItemIDs: make([]string, 0),
+		BillID:     params.BillID,
+		Currency:   params.Currency,
+		TotalMinor: 0,
+		Items:      make([]LineItem, 0),
+	}
+	if params.Initial != nil {
+		state.TotalMinor = params.Initial.TotalMinor
+		state.Items = append(state.Items, params.Initial.Items...)
+		state.Discounts = params.Initial.Discounts
+		state.RejectedLineItems = params.Initial.RejectedLineItems
+		state.Rejections = params.Initial.Rejections
+		state.InvoicedMinor = params.Initial.InvoicedMinor
+		state.RemovedLineItemIDs = params.Initial.RemovedLineItemIDs
+		state.CarriedItems = params.Initial.CarriedItems
+		state.InvoicedLineItemIDs = params.Initial.InvoicedLineItemIDs
+	}
+
+	// running state as the workflow sees it (only successfully persisted items)
+	if err := workflow.SetQueryHandler(ctx, queryBillState, func() (*BillResult, error) {
+		return state, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// workflow.Now is the time of the current workflow task, taken from
+	// history, so it is replay-safe and issues no commands
+	lastUpdated := workflow.Now(ctx)
+	if err := workflow.SetQueryHandler(ctx, queryBillTotals, func() (BillTotals, error) {
+		return BillTotals{
+			TotalMinor:  state.TotalMinor,
+			ItemCount:   state.itemCount(),
+			LastUpdated: lastUpdated,
+		}, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	lifecycle := workflowStatusOpen
+	if err := workflow.SetQueryHandler(ctx, queryBillStatus, func() (BillWorkflowStatus, error) {
+		return BillWorkflowStatus{
+			Status:            lifecycle,
+			ItemCount:         state.itemCount(),
+			ItemLimitReached:  params.MaxLineItems > 0 && state.itemCount() >= params.MaxLineItems,
+			RejectedLineItems: state.RejectedLineItems,
+			Rejections:        append([]RejectedLineItem{}, state.Rejections...),
+		}, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// reject counts and records a dropped add. Pure state, no commands, so
+	// replays of older histories are unaffected.
+	reject := func(lineItemID, reason string) {
+		state.RejectedLineItems++
+		state.Rejections = append(state.Rejections, RejectedLineItem{LineItemID: lineItemID, Reason: reason})
+		if n := len(state.Rejections); n > maxRecordedRejections {
+			state.Rejections = append([]RejectedLineItem{}, state.Rejections[n-maxRecordedRejections:]...)
+		}
 	}
 
 	addCh := workflow.GetSignalChannel(ctx, signalAddLineItem)
+	batchCh := workflow.GetSignalChannel(ctx, signalBatchAddItems)
+	updateCh := workflow.GetSignalChannel(ctx, signalUpdateLineItem)
+	removeCh := workflow.GetSignalChannel(ctx, signalRemoveLineItem)
 	closeCh := workflow.GetSignalChannel(ctx, signalCloseBill)
+	voidCh := workflow.GetSignalChannel(ctx, signalVoidBill)
+	discountCh := workflow.GetSignalChannel(ctx, signalApplyDiscount)
+	currencyCh := workflow.GetSignalChannel(ctx, signalSetCurrency)
+	deleteCh := workflow.GetSignalChannel(ctx, signalDeleteBill)
+	invoiceCh := workflow.GetSignalChannel(ctx, signalIssueInvoice)
+	memoCh := workflow.GetSignalChannel(ctx, signalSetMemo)
 
+	// Idle timer; re-armed after every add signal. Only created when
+	// AutoCloseAfter is set, so existing histories replay unchanged.
+	var (
+		idleTimer       workflow.Future
+		cancelIdleTimer workflow.CancelFunc
+	)
+
+	// pendingSignals reports whether any signal is buffered; continuing as
+	// new with one pending would drop it.
+	pendingSignals := func() bool {
+		for _, ch := range []workflow.ReceiveChannel{
+			addCh, batchCh, updateCh, removeCh, closeCh, voidCh, discountCh, currencyCh, deleteCh, invoiceCh, memoCh,
+		} {
+			if ch.Len() > 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	var voidSig *VoidBillSignal
+	deleted := false
+	handled := 0
 	for {
 		shouldClose := false
 		sel := workflow.NewSelector(ctx)
 
+		if params.AutoCloseAfter > 0 {
+			if idleTimer == nil {
+				var timerCtx workflow.Context
+				timerCtx, cancelIdleTimer = workflow.WithCancel(ctx)
+				idleTimer = workflow.NewTimer(timerCtx, params.AutoCloseAfter)
+			}
+			sel.AddFuture(idleTimer, func(f workflow.Future) {
+				if err := f.Get(ctx, nil); err != nil {
+					// cancelled by an add signal; re-armed next iteration
+					return
+				}
+				workflow.GetLogger(ctx).Info("auto-closing idle bill", "AutoCloseAfter", params.AutoCloseAfter)
+				shouldClose = true
+			})
+		}
+
 		// 2) Add line item signal -> activity insert + accrue
 		sel.AddReceive(addCh, func(c workflow.ReceiveChannel, more bool) {
 			var sig AddLineItemSignal
 			c.Receive(ctx, &sig)
 
-			// ignore mismatched currency
+			if idleTimer != nil {
+				cancelIdleTimer()
+				idleTimer = nil
+			}
+
+			// Another tenant's add: reported as if the bill didn't exist.
+			// Pure state, and both sides are empty in older histories.
+			if sig.OwnerID != params.OwnerID {
+				reject(sig.LineItemID, ReasonBillNotFound)
+				workflow.GetLogger(ctx).Warn("line item rejected: owner mismatch",
+					"LineItemID", sig.LineItemID)
+				return
+			}
+
+			// reject (and record) mismatched currency; the API checks the
+			// DB first, but a currency change can land in between
 			if sig.Currency != state.Currency {
+				reject(sig.LineItemID, ReasonCurrencyMismatch)
+				workflow.GetLogger(ctx).Warn("line item rejected: currency mismatch",
+					"LineItemID", sig.LineItemID, "Currency", sig.Currency)
+				return
+			}
+
+			// The API always sends an ID; a signal sent straight to Temporal
+			// may not
+			if sig.LineItemID == "" {
+				sig.LineItemID = newDeterministicID(ctx)
+			}
+
+			// A client retry with its own ID: the item is already counted.
+			// IDs used to be server-minted only, so no earlier history holds
+			// a duplicate and replays are unaffected.
+			if state.itemIndex(sig.LineItemID) >= 0 || state.carriedIndex(sig.LineItemID) >= 0 {
+				workflow.GetLogger(ctx).Info("ignoring duplicate line item", "LineItemID", sig.LineItemID)
+				return
+			}
+			// Re-sent after an invoice charged it. Earlier runs sent these
+			// to the activity, so they keep doing so on replay.
+			if state.invoiced(sig.LineItemID) &&
+				workflow.GetVersion(ctx, "dedupe-invoiced-items", workflow.DefaultVersion, 1) >= 1 {
+				workflow.GetLogger(ctx).Info("ignoring duplicate of an invoiced line item", "LineItemID", sig.LineItemID)
+				return
+			}
+
+			// reject (and count) adds beyond the item limit
+			if params.MaxLineItems > 0 && state.itemCount() >= params.MaxLineItems {
+				reject(sig.LineItemID, ReasonItemLimit)
+				workflow.GetLogger(ctx).Warn("line item rejected: item limit",
+					"LineItemID", sig.LineItemID, "MaxLineItems", params.MaxLineItems)
+				return
+			}
+
+			// reject (and count) adds that would overflow the total
+			if err := checkTotalDelta(state.TotalMinor, sig.AmountMinor); err != nil {
+				reject(sig.LineItemID, ReasonTotalOverflow)
+				workflow.GetLogger(ctx).Warn("line item rejected: total overflow", "LineItemID", sig.LineItemID)
+				return
+			}
+
+			// reject (and count) credits that would overdraw the bill
+			if sig.Credit && state.TotalMinor+sig.AmountMinor < 0 {
+				reject(sig.LineItemID, ReasonCreditOverdraw)
+				workflow.GetLogger(ctx).Warn("line item rejected: credit overdraws total",
+					"LineItemID", sig.LineItemID, "TotalMinor", state.TotalMinor)
+				return
+			}
+
+			// reject (and count) adds over the bill-level ceiling
+			if params.MaxTotalMinor > 0 && state.TotalMinor+sig.AmountMinor > params.MaxTotalMinor {
+				reject(sig.LineItemID, ReasonTotalCeiling)
+				workflow.GetLogger(ctx).Warn("line item rejected: bill total ceiling",
+					"LineItemID", sig.LineItemID, "MaxTotalMinor", params.MaxTotalMinor)
 				return
 			}
 
@@ -87,41 +502,523 @@ func BillLifecycleWorkflow(ctx workflow.Context, params BillWorkflowParams) (*Bi
 					LineItemID:  sig.LineItemID,
 					BillID:      state.BillID,
 					Description: sig.Description,
+					Category:    sig.Category,
 					AmountMinor: sig.AmountMinor,
 					Currency:    sig.Currency,
+					Proration:   sig.Proration,
+					Credit:      sig.Credit,
+					CreatedAt:   sig.CreatedAt,
 				},
 			).Get(ctx, &li)
 			if err != nil {
-				// letting the workflow error here is reasonable for take-home;
-				// you could also log and continue depending on your semantics.
-				panic(err)
+				// retries are exhausted by now; the item was never persisted,
+				// so leave state untouched and keep the bill open
+				workflow.GetLogger(ctx).Error("add line item failed",
+					"LineItemID", sig.LineItemID, "Error", err)
+				return
 			}
 
 			state.TotalMinor += li.AmountMinor
-			state.LineItemIDs = append(state.LineItemIDs, li.ID)
+			state.Items = append(state.Items, li)
+		})
+
+		// 3) Batch add signal -> one activity insert + accrue all or nothing
+		sel.AddReceive(batchCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig BatchAddLineItemsSignal
+			c.Receive(ctx, &sig)
+
+			if idleTimer != nil {
+				cancelIdleTimer()
+				idleTimer = nil
+			}
+
+			rejectBatch := func(reason string) {
+				for _, it := range sig.Items {
+					reject(it.LineItemID, reason)
+				}
+			}
+
+			if len(sig.Items) == 0 {
+				return
+			}
+			if sig.Currency != state.Currency {
+				rejectBatch(ReasonCurrencyMismatch)
+				workflow.GetLogger(ctx).Warn("line item batch rejected: currency mismatch",
+					"Items", len(sig.Items), "Currency", sig.Currency)
+				return
+			}
+			for i := range sig.Items {
+				if sig.Items[i].LineItemID == "" {
+					sig.Items[i].LineItemID = newDeterministicID(ctx)
+				}
+			}
+
+			if params.MaxLineItems > 0 && state.itemCount()+len(sig.Items) > params.MaxLineItems {
+				rejectBatch(ReasonItemLimit)
+				workflow.GetLogger(ctx).Warn("line item batch rejected: item limit",
+					"Items", len(sig.Items), "MaxLineItems", params.MaxLineItems)
+				return
+			}
+
+			total := state.TotalMinor
+			for _, it := range sig.Items {
+				if err := checkTotalDelta(total, it.AmountMinor); err != nil {
+					rejectBatch(ReasonTotalOverflow)
+					workflow.GetLogger(ctx).Warn("line item batch rejected: total overflow", "Items", len(sig.Items))
+					return
+				}
+				total += it.AmountMinor
+			}
+			if params.MaxTotalMinor > 0 && total > params.MaxTotalMinor {
+				rejectBatch(ReasonTotalCeiling)
+				workflow.GetLogger(ctx).Warn("line item batch rejected: bill total ceiling",
+					"Items", len(sig.Items), "MaxTotalMinor", params.MaxTotalMinor)
+				return
+			}
+
+			var items []LineItem
+			err := workflow.ExecuteActivity(ctx,
+				AddLineItemsActivity,
+				AddLineItemsInput{BillID: state.BillID, Currency: sig.Currency, Items: sig.Items},
+			).Get(ctx, &items)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("batch add line items failed",
+					"Items", len(sig.Items), "Error", err)
+				return
+			}
+
+			for _, li := range items {
+				state.TotalMinor += li.AmountMinor
+			}
+			state.Items = append(state.Items, items...)
+		})
+
+		// 4) Update line item signal -> activity update + accrue the delta
+		sel.AddReceive(updateCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig UpdateLineItemSignal
+			c.Receive(ctx, &sig)
+
+			idx, carried := state.itemIndex(sig.LineItemID), state.carriedIndex(sig.LineItemID)
+			var oldAmount int64
+			switch {
+			case idx >= 0:
+				oldAmount = state.Items[idx].AmountMinor
+			case carried >= 0:
+				oldAmount = state.CarriedItems[carried].AmountMinor
+			default:
+				return
+			}
+
+			// An unchanged amount is not an amount change: the total stays
+			// and the item keeps its proration
+			if sig.AmountMinor != nil && *sig.AmountMinor == oldAmount {
+				sig.AmountMinor = nil
+			}
+
+			if sig.AmountMinor != nil {
+				if oldAmount < 0 {
+					workflow.GetLogger(ctx).Warn("line item update rejected: credit amounts are fixed", "LineItemID", sig.LineItemID)
+					return
+				}
+				delta := *sig.AmountMinor - oldAmount
+				if state.TotalMinor+delta < 0 {
+					workflow.GetLogger(ctx).Warn("line item update rejected: credits would overdraw total", "LineItemID", sig.LineItemID)
+					return
+				}
+				if err := checkTotalDelta(state.TotalMinor, delta); err != nil {
+					workflow.GetLogger(ctx).Warn("line item update rejected: total overflow", "LineItemID", sig.LineItemID)
+					return
+				}
+				if params.MaxTotalMinor > 0 && delta > 0 && state.TotalMinor+delta > params.MaxTotalMinor {
+					workflow.GetLogger(ctx).Warn("line item update rejected: bill total ceiling",
+						"LineItemID", sig.LineItemID, "MaxTotalMinor", params.MaxTotalMinor)
+					return
+				}
+			}
+
+			var li LineItem
+			err := workflow.ExecuteActivity(ctx,
+				UpdateLineItemActivity,
+				UpdateLineItemInput{
+					BillID:      state.BillID,
+					LineItemID:  sig.LineItemID,
+					Description: sig.Description,
+					AmountMinor: sig.AmountMinor,
+				},
+			).Get(ctx, &li)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("update line item failed",
+					"LineItemID", sig.LineItemID, "Error", err)
+				return
+			}
+
+			state.TotalMinor += li.AmountMinor - oldAmount
+			if carried >= 0 {
+				state.CarriedItems[carried].AmountMinor = li.AmountMinor
+			} else {
+				state.Items[idx] = li
+			}
 		})
 
-		// 3) Close signal -> break loop
+		// 5) Remove line item signal -> activity delete + un-accrue
+		sel.AddReceive(removeCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig RemoveLineItemSignal
+			c.Receive(ctx, &sig)
+
+			// A resent removal: the total already dropped. Pure state, so
+			// histories from before the set existed replay unchanged.
+			for _, removed := range state.RemovedLineItemIDs {
+				if removed == sig.LineItemID {
+					workflow.GetLogger(ctx).Info("ignoring repeated removal", "LineItemID", sig.LineItemID)
+					return
+				}
+			}
+
+			idx, carried := state.itemIndex(sig.LineItemID), state.carriedIndex(sig.LineItemID)
+			var amount int64
+			switch {
+			case idx >= 0:
+				amount = state.Items[idx].AmountMinor
+			case carried >= 0:
+				amount = state.CarriedItems[carried].AmountMinor
+			default:
+				return
+			}
+			if state.TotalMinor-amount < 0 {
+				workflow.GetLogger(ctx).Warn("line item removal rejected: credits would overdraw total", "LineItemID", sig.LineItemID)
+				return
+			}
+
+			err := workflow.ExecuteActivity(ctx,
+				RemoveLineItemActivity,
+				RemoveLineItemInput{BillID: state.BillID, LineItemID: sig.LineItemID},
+			).Get(ctx, nil)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("remove line item failed",
+					"LineItemID", sig.LineItemID, "Error", err)
+				return
+			}
+
+			state.TotalMinor -= amount
+			if carried >= 0 {
+				state.CarriedItems = append(state.CarriedItems[:carried], state.CarriedItems[carried+1:]...)
+			} else {
+				state.Items = append(state.Items[:idx], state.Items[idx+1:]...)
+			}
+			state.RemovedLineItemIDs = append(state.RemovedLineItemIDs, sig.LineItemID)
+		})
+
+		// 6) Discount signal -> activity insert; applied at close
+		sel.AddReceive(discountCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig ApplyDiscountSignal
+			c.Receive(ctx, &sig)
+
+			var d Discount
+			err := workflow.ExecuteActivity(ctx,
+				ApplyDiscountActivity,
+				ApplyDiscountInput{
+					DiscountID: sig.DiscountID,
+					BillID:     state.BillID,
+					Type:       sig.Type,
+					Value:      sig.Value,
+				},
+			).Get(ctx, &d)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("apply discount failed",
+					"DiscountID", sig.DiscountID, "Error", err)
+				return
+			}
+
+			state.Discounts = append(state.Discounts, d)
+		})
+
+		// 7) Currency signal -> activity update while the bill has no items
+		sel.AddReceive(currencyCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig SetCurrencySignal
+			c.Receive(ctx, &sig)
+
+			if state.itemCount() > 0 || sig.Currency == state.Currency {
+				return
+			}
+
+			err := workflow.ExecuteActivity(ctx,
+				SetCurrencyActivity,
+				SetCurrencyInput{BillID: state.BillID, Currency: sig.Currency},
+			).Get(ctx, nil)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("set currency failed",
+					"Currency", sig.Currency, "Error", err)
+				return
+			}
+
+			state.Currency = sig.Currency
+		})
+
+		// 8) Close signal -> break loop
 		sel.AddReceive(closeCh, func(c workflow.ReceiveChannel, more bool) {
 			var sig CloseBillSignal
 			c.Receive(ctx, &sig)
 			shouldClose = true
+			state.CloseRequestID = sig.RequestID
+		})
+
+		// 9) Void signal -> break loop without a charge
+		sel.AddReceive(voidCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig VoidBillSignal
+			c.Receive(ctx, &sig)
+			voidSig = &sig
+		})
+
+		// 10) Delete signal -> break loop; the row is soft-deleted
+		sel.AddReceive(deleteCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig DeleteBillSignal
+			c.Receive(ctx, &sig)
+			deleted = true
+		})
+
+		// 11) Invoice signal -> activity snapshot, then restart the period
+		sel.AddReceive(invoiceCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig IssueInvoiceSignal
+			c.Receive(ctx, &sig)
+
+			if state.itemCount() == 0 {
+				return
+			}
+			ids := make([]string, 0, state.itemCount())
+			for _, li := range state.CarriedItems {
+				ids = append(ids, li.ID)
+			}
+			for _, li := range state.Items {
+				ids = append(ids, li.ID)
+			}
+
+			var inv Invoice
+			err := workflow.ExecuteActivity(ctx,
+				IssueInvoiceActivity,
+				IssueInvoiceInput{
+					InvoiceID:   sig.InvoiceID,
+					BillID:      state.BillID,
+					Currency:    state.Currency,
+					LineItemIDs: ids,
+				},
+			).Get(ctx, &inv)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("issue invoice failed",
+					"InvoiceID", sig.InvoiceID, "Error", err)
+				return
+			}
+
+			state.InvoicedMinor += inv.TotalMinor
+			state.InvoicedLineItemIDs = append(state.InvoicedLineItemIDs, ids...)
+			state.TotalMinor = 0
+			state.Items = make([]LineItem, 0)
+			state.CarriedItems = nil
+		})
+
+		// 12) Memo signal -> activity update; no running state to change
+		sel.AddReceive(memoCh, func(c workflow.ReceiveChannel, more bool) {
+			var sig SetMemoSignal
+			c.Receive(ctx, &sig)
+
+			err := workflow.ExecuteActivity(ctx,
+				SetMemoActivity,
+				SetMemoInput{BillID: state.BillID, Memo: sig.Memo},
+			).Get(ctx, nil)
+			if err != nil {
+				workflow.GetLogger(ctx).Error("set memo failed", "Error", err)
+			}
 		})
 
 		sel.Select(ctx)
+		lastUpdated = workflow.Now(ctx)
+		if voidSig != nil || deleted {
+			break
+		}
 		if shouldClose {
+			lifecycle = workflowStatusClosing
 			break
 		}
+
+		// Long-lived bills: start a fresh run under the same workflow ID
+		// with the state so far, once nothing is waiting to be handled.
+		// Items are carried as ID and amount only, so the new run's input
+		// doesn't grow with every description. The idle timer restarts in
+		// the new run.
+		// Runs without a signal limit continue on history length alone;
+		// replays of those from before that change keep running on.
+		handled++
+		if continueAsNewDue(params.ContinueAsNewAfterSignals, handled, workflow.GetInfo(ctx).GetCurrentHistoryLength()) &&
+			!pendingSignals() &&
+			(params.ContinueAsNewAfterSignals > 0 ||
+				workflow.GetVersion(ctx, "continue-as-new-on-history-length", workflow.DefaultVersion, 1) >= 1) {
+			next := params
+			next.Currency = state.Currency
+			next.Initial = state.carryOver()
+			return nil, workflow.NewContinueAsNewError(ctx, BillLifecycleWorkflow, next)
+		}
+	}
+
+	// Closes racing the winning close/void are ignored; draining them just
+	// logs which calls lost (no commands, so replay-safe)
+	for {
+		var sig CloseBillSignal
+		if !closeCh.ReceiveAsync(&sig) {
+			break
+		}
+		workflow.GetLogger(ctx).Info("ignoring duplicate close", "RequestID", sig.RequestID)
+	}
+
+	// 13) Soft-delete bill row via activity
+	if deleted {
+		if err := workflow.ExecuteActivity(ctx,
+			DeleteBillActivity,
+			DeleteBillInput{BillID: state.BillID},
+		).Get(ctx, nil); err != nil {
+			return nil, err
+		}
+		lifecycle = workflowStatusDeleted
+		state.Voided = true
+		state.Deleted = true
+		return state, nil
+	}
+
+	// 14) Void bill row via activity
+	if voidSig != nil {
+		if err := workflow.ExecuteActivity(ctx,
+			VoidBillActivity,
+			VoidBillInput{BillID: state.BillID, Reason: voidSig.Reason},
+		).Get(ctx, nil); err != nil {
+			return nil, err
+		}
+		lifecycle = workflowStatusVoid
+		state.Voided = true
+		return state, nil
+	}
+
+	// 15) Apply discounts and tax (pure integer math, replay-safe), then
+	// close bill row via activity
+	discount, tax, total, err := billTotals(state.TotalMinor, state.Discounts, params.TaxRateBps, params.RoundingMode)
+	if err != nil {
+		return nil, err
+	}
+	state.SubtotalMinor = state.TotalMinor
+	state.DiscountMinor = discount
+	state.TaxMinor = tax
+	state.TotalMinor = total
+	lastUpdated = workflow.Now(ctx)
+
+	if params.BaseCurrency != "" {
+		var conv ConvertCurrencyResult
+		if err := workflow.ExecuteActivity(ctx,
+			ConvertCurrencyActivity,
+			ConvertCurrencyInput{AmountMinor: state.TotalMinor, From: state.Currency, To: params.BaseCurrency},
+		).Get(ctx, &conv); err != nil {
+			return nil, err
+		}
+		state.BaseCurrency = params.BaseCurrency
+		state.BaseTotalMinor = conv.AmountMinor
+		state.FXRatePPM = conv.RatePPM
 	}
 
-	// 4) Close bill row via activity
 	var closed Bill
 	if err := workflow.ExecuteActivity(ctx,
 		CloseBillActivity,
-		CloseBillInput{BillID: state.BillID, TotalMinor: state.TotalMinor},
+		CloseBillInput{
+			BillID:         state.BillID,
+			TotalMinor:     state.TotalMinor,
+			SubtotalMinor:  state.SubtotalMinor,
+			DiscountMinor:  state.DiscountMinor,
+			TaxMinor:       state.TaxMinor,
+			BaseCurrency:   state.BaseCurrency,
+			BaseTotalMinor: state.BaseTotalMinor,
+			FXRatePPM:      state.FXRatePPM,
+		},
 	).Get(ctx, &closed); err != nil {
 		return nil, err
 	}
+	// The activity stores the DB's item sum if it disagrees with ours, so
+	// report what was stored. Results from before it reconciled echo the
+	// input, so replays are unchanged.
+	state.SubtotalMinor = closed.SubtotalMinor
+	state.DiscountMinor = closed.DiscountMinor
+	state.TaxMinor = closed.TaxMinor
+	state.TotalMinor = closed.TotalMinor
+	if state.BaseCurrency != "" {
+		state.BaseTotalMinor = closed.BaseTotalMinor
+	}
+	lifecycle = workflowStatusClosed
+
+	// 16) Notify downstream. Versioned so bills closed before the webhook
+	// existed replay without it. The bill is closed either way, so a
+	// delivery that exhausts its retries is logged, not returned. CloseBill
+	// waits on the workflow, so a down receiver slows its response by up to
+	// the retry budget.
+	if workflow.GetVersion(ctx, "notify-bill-closed", workflow.DefaultVersion, 1) >= 1 {
+		if err := workflow.ExecuteActivity(ctx, NotifyBillClosedActivity, *state).Get(ctx, nil); err != nil {
+			workflow.GetLogger(ctx).Error("bill closed webhook failed", "Error", err)
+		}
+	}
 
 	return state, nil
 }
+
+// itemCount is how many uninvoiced items the bill holds.
+func (r *BillResult) itemCount() int {
+	return len(r.Items) + len(r.CarriedItems)
+}
+
+// carriedIndex returns the position of a line item in CarriedItems, or -1.
+func (r *BillResult) carriedIndex(lineItemID string) int {
+	for i := range r.CarriedItems {
+		if r.CarriedItems[i].ID == lineItemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// invoiced reports whether an invoice already charged the line item.
+func (r *BillResult) invoiced(lineItemID string) bool {
+	for _, id := range r.InvoicedLineItemIDs {
+		if id == lineItemID {
+			return true
+		}
+	}
+	return false
+}
+
+// carryOver is the state a continued-as-new run starts from: everything
+// but the items, which are reduced to CarriedItems in insertion order.
+func (r *BillResult) carryOver() *BillResult {
+	next := *r
+	next.Items = nil
+	next.CarriedItems = make([]CarriedLineItem, 0, r.itemCount())
+	next.CarriedItems = append(next.CarriedItems, r.CarriedItems...)
+	for _, li := range r.Items {
+		next.CarriedItems = append(next.CarriedItems, CarriedLineItem{ID: li.ID, AmountMinor: li.AmountMinor})
+	}
+	return &next
+}
+
+// itemIndex returns the position of a line item in Items, or -1.
+func (r *BillResult) itemIndex(lineItemID string) int {
+	for i := range r.Items {
+		if r.Items[i].ID == lineItemID {
+			return i
+		}
+	}
+	return -1
+}
+
+// newDeterministicID returns a fresh UUID for IDs the workflow mints itself.
+// The value is recorded as a side effect, so a replay reads it back from
+// history instead of generating a different one.
+func newDeterministicID(ctx workflow.Context) string {
+	var id string
+	if err := workflow.SideEffect(ctx, func(workflow.Context) interface{} {
+		return uuid.New().String()
+	}).Get(&id); err != nil {
+		panic(err) // only fails if the recorded value can't be decoded
+	}
+	return id
+}
@@ -0,0 +1,602 @@
+package bill
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Workflow tests run BillLifecycleWorkflow in the SDK's test environment
+// with every activity mocked, so they need neither Temporal nor the DB.
+type billWorkflowSuite struct {
+	suite.Suite
+	testsuite.WorkflowTestSuite
+
+	env *testsuite.TestWorkflowEnvironment
+
+	added   []AddLineItemInput // AddLineItemActivity calls, in order
+	addErrs []error            // returned by the next AddLineItemActivity calls
+}
+
+func TestBillWorkflow(t *testing.T) {
+	suite.Run(t, new(billWorkflowSuite))
+}
+
+func (s *billWorkflowSuite) SetupTest() {
+	s.env = s.NewTestWorkflowEnvironment()
+	s.added, s.addErrs = nil, nil
+	s.env.RegisterWorkflow(BillLifecycleWorkflow)
+
+	// Activities echo their input the way the DB would store it.
+	s.env.OnActivity(CreateBillRowActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in CreateBillRowInput) (*Bill, error) {
+			return &Bill{ID: in.BillID, Status: StatusOpen, Currency: in.Currency}, nil
+		}).Maybe()
+	s.env.OnActivity(AddLineItemActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in AddLineItemInput) (*LineItem, error) {
+			s.added = append(s.added, in)
+			if len(s.addErrs) > 0 {
+				err := s.addErrs[0]
+				s.addErrs = s.addErrs[1:]
+				return nil, err
+			}
+			return &LineItem{ID: in.LineItemID, BillID: in.BillID, Description: in.Description, AmountMinor: in.AmountMinor, Kind: LineItemKindUser}, nil
+		}).Maybe()
+	s.env.OnActivity(AddLineItemsActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in AddLineItemsInput) ([]LineItem, error) {
+			items := make([]LineItem, len(in.Items))
+			for i, it := range in.Items {
+				items[i] = LineItem{ID: it.LineItemID, BillID: in.BillID, Description: it.Description, AmountMinor: it.AmountMinor, Kind: LineItemKindUser}
+			}
+			return items, nil
+		}).Maybe()
+	s.env.OnActivity(CloseBillActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in CloseBillInput) (*Bill, error) {
+			return &Bill{
+				ID: in.BillID, Status: StatusClosed, TotalMinor: in.TotalMinor,
+				SubtotalMinor: in.SubtotalMinor, DiscountMinor: in.DiscountMinor, TaxMinor: in.TaxMinor,
+			}, nil
+		}).Maybe()
+	s.env.OnActivity(VoidBillActivity, mock.Anything, mock.Anything).Return(nil).Maybe()
+	s.env.OnActivity(NotifyBillClosedActivity, mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
+func (s *billWorkflowSuite) AfterTest(_, _ string) {
+	s.env.AssertExpectations(s.T())
+}
+
+func (s *billWorkflowSuite) params() BillWorkflowParams {
+	return BillWorkflowParams{BillID: "bill-1", Currency: CurrencyUSD}
+}
+
+// signal delivers a signal after delay of workflow time.
+func (s *billWorkflowSuite) signal(delay time.Duration, name string, arg interface{}) {
+	s.env.RegisterDelayedCallback(func() {
+		s.env.SignalWorkflow(name, arg)
+	}, delay)
+}
+
+func (s *billWorkflowSuite) add(delay time.Duration, id string, amount int64) {
+	s.signal(delay, signalAddLineItem, AddLineItemSignal{
+		LineItemID: id, Description: "item " + id, AmountMinor: amount, Currency: CurrencyUSD,
+	})
+}
+
+func (s *billWorkflowSuite) result() *BillResult {
+	s.Require().True(s.env.IsWorkflowCompleted())
+	s.Require().NoError(s.env.GetWorkflowError())
+	var res BillResult
+	s.Require().NoError(s.env.GetWorkflowResult(&res))
+	return &res
+}
+
+func (s *billWorkflowSuite) TestAddAndClose() {
+	s.add(time.Minute, "li-1", 1000)
+	s.add(2*time.Minute, "li-2", 250)
+	s.signal(3*time.Minute, signalCloseBill, CloseBillSignal{RequestID: "close-1"})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(1250), res.TotalMinor)
+	s.Equal(int64(1250), res.SubtotalMinor)
+	s.Len(res.Items, 2)
+	s.Equal("close-1", res.CloseRequestID)
+	s.False(res.Voided)
+	s.env.AssertNumberOfCalls(s.T(), "CloseBillActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestDuplicateAddCountedOnce() {
+	s.add(time.Minute, "li-1", 1000)
+	s.add(2*time.Minute, "li-1", 1000)
+	s.signal(3*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(1000), res.TotalMinor)
+	s.Len(res.Items, 1)
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestDuplicateOfInvoicedItemIgnored() {
+	s.env.OnActivity(IssueInvoiceActivity, mock.Anything, mock.Anything).Return(
+		&Invoice{ID: "inv-1", BillID: "bill-1", TotalMinor: 1000}, nil).Once()
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalIssueInvoice, IssueInvoiceSignal{InvoiceID: "inv-1"})
+	s.add(3*time.Minute, "li-1", 1000)
+	s.signal(4*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Zero(res.TotalMinor)
+	s.Equal(int64(1000), res.InvoicedMinor)
+	s.Equal([]string{"li-1"}, res.InvoicedLineItemIDs)
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestInvoicedItemIDsSurviveContinueAsNew() {
+	p := s.params()
+	p.Initial = &BillResult{BillID: "bill-1", Currency: CurrencyUSD, InvoicedLineItemIDs: []string{"li-1"}}
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	res := s.result()
+	s.Zero(res.TotalMinor)
+	s.env.AssertNotCalled(s.T(), "AddLineItemActivity", mock.Anything, mock.Anything)
+}
+
+func (s *billWorkflowSuite) TestDuplicateOfInvoicedItemOnDefaultVersion() {
+	// Histories from before the dedupe sent the add to the activity.
+	s.env.OnGetVersion("dedupe-invoiced-items", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	p := s.params()
+	p.Initial = &BillResult{BillID: "bill-1", Currency: CurrencyUSD, InvoicedLineItemIDs: []string{"li-1"}}
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	s.result()
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestOwnedCreditLands() {
+	p := s.params()
+	p.OwnerID = "acme"
+	s.signal(time.Minute, signalAddLineItem, AddLineItemSignal{
+		LineItemID: "li-1", Description: "seat", AmountMinor: 1000, Currency: CurrencyUSD, OwnerID: "acme",
+	})
+	s.signal(2*time.Minute, signalAddLineItem, AddLineItemSignal{
+		LineItemID: "cr-1", Description: "refund", AmountMinor: -300, Currency: CurrencyUSD, Credit: true, OwnerID: "acme",
+	})
+	s.signal(3*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	res := s.result()
+	s.Equal(int64(700), res.TotalMinor)
+	s.Zero(res.RejectedLineItems)
+}
+
+func (s *billWorkflowSuite) TestVoid() {
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalVoidBill, VoidBillSignal{Reason: "duplicate order"})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.True(res.Voided)
+	s.Equal(int64(1000), res.TotalMinor)
+	s.env.AssertNumberOfCalls(s.T(), "VoidBillActivity", 1)
+	s.env.AssertNotCalled(s.T(), "CloseBillActivity", mock.Anything, mock.Anything)
+	s.env.AssertNotCalled(s.T(), "NotifyBillClosedActivity", mock.Anything, mock.Anything)
+}
+
+func (s *billWorkflowSuite) TestIdleAutoClose() {
+	p := s.params()
+	p.AutoCloseAfter = time.Hour
+
+	// The second add re-arms the timer, so the bill closes an hour after
+	// it rather than an hour after the start.
+	s.add(30*time.Minute, "li-1", 100)
+	s.add(80*time.Minute, "li-2", 200)
+
+	start := s.env.Now()
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	res := s.result()
+	s.Equal(int64(300), res.TotalMinor)
+	s.Empty(res.CloseRequestID)
+	s.GreaterOrEqual(s.env.Now().Sub(start), 140*time.Minute)
+	s.env.AssertNumberOfCalls(s.T(), "CloseBillActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestContinueAsNewCarriesState() {
+	p := s.params()
+	p.ContinueAsNewAfterSignals = 2
+	p.MaxLineItems = 10
+
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalAddLineItem, AddLineItemSignal{
+		LineItemID: "li-gel", AmountMinor: 5, Currency: CurrencyGEL,
+	})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	s.Require().True(s.env.IsWorkflowCompleted())
+	var can *workflow.ContinueAsNewError
+	s.Require().True(errors.As(s.env.GetWorkflowError(), &can))
+
+	var next BillWorkflowParams
+	s.Require().NoError(converter.GetDefaultDataConverter().FromPayloads(can.Input, &next))
+	s.Equal(p.BillID, next.BillID)
+	s.Equal(p.MaxLineItems, next.MaxLineItems)
+	s.Require().NotNil(next.Initial)
+	s.Equal(int64(1000), next.Initial.TotalMinor)
+	s.Equal(1, next.Initial.RejectedLineItems)
+	s.Empty(next.Initial.Items, "full items stay in the DB")
+	s.Equal([]CarriedLineItem{{ID: "li-1", AmountMinor: 1000}}, next.Initial.CarriedItems)
+}
+
+func (s *billWorkflowSuite) TestCarriedItemsAfterContinueAsNew() {
+	s.env.OnActivity(UpdateLineItemActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in UpdateLineItemInput) (*LineItem, error) {
+			return &LineItem{ID: in.LineItemID, BillID: in.BillID, AmountMinor: *in.AmountMinor}, nil
+		}).Once()
+	s.env.OnActivity(RemoveLineItemActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	var invoiced IssueInvoiceInput
+	s.env.OnActivity(IssueInvoiceActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in IssueInvoiceInput) (*Invoice, error) {
+			invoiced = in
+			return &Invoice{ID: in.InvoiceID, BillID: in.BillID, TotalMinor: 1500}, nil
+		}).Once()
+
+	p := s.params()
+	p.MaxLineItems = 3
+	p.Initial = &BillResult{
+		BillID: "bill-1", Currency: CurrencyUSD, TotalMinor: 1300,
+		CarriedItems: []CarriedLineItem{{ID: "li-1", AmountMinor: 1000}, {ID: "li-2", AmountMinor: 300}},
+	}
+	amount := int64(1200)
+	s.add(time.Minute, "li-1", 1000) // already carried
+	s.signal(2*time.Minute, signalUpdateLineItem, UpdateLineItemSignal{LineItemID: "li-1", AmountMinor: &amount})
+	s.signal(3*time.Minute, signalRemoveLineItem, RemoveLineItemSignal{LineItemID: "li-2"})
+	s.add(4*time.Minute, "li-3", 300)
+	s.add(5*time.Minute, "li-4", 400)
+	s.add(6*time.Minute, "li-5", 500) // over the limit of 3
+	s.signal(7*time.Minute, signalIssueInvoice, IssueInvoiceSignal{InvoiceID: "inv-1"})
+	s.signal(8*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	res := s.result()
+	s.Equal([]string{"li-1", "li-3", "li-4"}, invoiced.LineItemIDs)
+	s.Equal(int64(1500), res.InvoicedMinor)
+	s.Zero(res.TotalMinor)
+	s.Empty(res.CarriedItems)
+	s.Equal(1, res.RejectedLineItems)
+	s.Equal([]string{"li-2"}, res.RemovedLineItemIDs)
+	s.Len(s.added, 2, "neither the carried duplicate nor the add over the limit reaches the activity")
+}
+
+func (s *billWorkflowSuite) TestNotifyOnClose() {
+	s.signal(time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	s.result()
+	s.env.AssertNumberOfCalls(s.T(), "NotifyBillClosedActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestNotifySkippedOnDefaultVersion() {
+	// Bills closed before the webhook existed replay without it.
+	s.env.OnGetVersion("notify-bill-closed", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	s.signal(time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	s.result()
+	s.env.AssertNumberOfCalls(s.T(), "CloseBillActivity", 1)
+	s.env.AssertNotCalled(s.T(), "NotifyBillClosedActivity", mock.Anything, mock.Anything)
+}
+
+func (s *billWorkflowSuite) TestCurrencyMismatchDropped() {
+	s.signal(time.Minute, signalAddLineItem, AddLineItemSignal{
+		LineItemID: "li-gel", AmountMinor: 500, Currency: CurrencyGEL,
+	})
+	s.add(2*time.Minute, "li-usd", 700)
+	s.signal(3*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(700), res.TotalMinor)
+	s.Len(res.Items, 1)
+	s.Equal(1, res.RejectedLineItems)
+	s.Equal([]RejectedLineItem{{LineItemID: "li-gel", Reason: ReasonCurrencyMismatch}}, res.Rejections)
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestUpdateOverCapLeavesTotal() {
+	// The activity is authoritative for the caps; its rejection must not
+	// move the running total.
+	s.env.OnActivity(UpdateLineItemActivity, mock.Anything, mock.Anything).
+		Return(nil, nonRetryable(checkLineItemAmount(CurrencyUSD, 1<<40))).Once()
+	amount := int64(1 << 40)
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalUpdateLineItem, UpdateLineItemSignal{LineItemID: "li-1", AmountMinor: &amount})
+	s.signal(3*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(1000), res.TotalMinor)
+	s.Equal(int64(1000), res.Items[0].AmountMinor)
+}
+
+func (s *billWorkflowSuite) TestResentRemoveCountedOnce() {
+	s.env.OnActivity(RemoveLineItemActivity, mock.Anything, mock.Anything).Return(nil).Once()
+	s.add(time.Minute, "li-1", 1000)
+	s.add(2*time.Minute, "li-2", 300)
+	s.signal(3*time.Minute, signalRemoveLineItem, RemoveLineItemSignal{LineItemID: "li-1"})
+	s.signal(4*time.Minute, signalRemoveLineItem, RemoveLineItemSignal{LineItemID: "li-1"})
+	s.signal(5*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(300), res.TotalMinor)
+	s.Len(res.Items, 1)
+	s.Equal([]string{"li-1"}, res.RemovedLineItemIDs)
+	s.env.AssertNumberOfCalls(s.T(), "RemoveLineItemActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestUpdateRecomputesOnlyOnAmountChange() {
+	var inputs []UpdateLineItemInput
+	s.env.OnActivity(UpdateLineItemActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in UpdateLineItemInput) (*LineItem, error) {
+			inputs = append(inputs, in)
+			li := &LineItem{ID: in.LineItemID, BillID: in.BillID, Description: "item", AmountMinor: 1000}
+			if len(inputs) > 1 {
+				li.AmountMinor = 1500
+			}
+			if in.Description != nil {
+				li.Description = *in.Description
+			}
+			return li, nil
+		}).Twice()
+
+	same, changed, renamed := int64(1000), int64(1500), "renamed"
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalUpdateLineItem, UpdateLineItemSignal{LineItemID: "li-1", Description: &renamed, AmountMinor: &same})
+	s.signal(3*time.Minute, signalUpdateLineItem, UpdateLineItemSignal{LineItemID: "li-1", AmountMinor: &changed})
+	s.signal(4*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal(int64(1500), res.TotalMinor)
+	s.Require().Len(inputs, 2)
+	s.Nil(inputs[0].AmountMinor, "an unchanged amount is dropped from the patch")
+	s.Equal(&renamed, inputs[0].Description)
+	s.Equal(&changed, inputs[1].AmountMinor)
+	s.Nil(inputs[1].Description)
+}
+
+func (s *billWorkflowSuite) TestBatchItemsApplyInOrder() {
+	s.add(time.Minute, "li-0", 100)
+	s.signal(2*time.Minute, signalBatchAddItems, BatchAddLineItemsSignal{
+		Currency: CurrencyUSD,
+		Items: []BatchLineItem{
+			{LineItemID: "li-c", Description: "third by id", AmountMinor: 300},
+			{LineItemID: "li-a", Description: "first by id", AmountMinor: 100},
+			{LineItemID: "li-b", Description: "second by id", AmountMinor: 200},
+		},
+	})
+	s.add(3*time.Minute, "li-9", 900)
+	s.signal(4*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	var ids []string
+	for _, li := range res.Items {
+		ids = append(ids, li.ID)
+	}
+	s.Equal([]string{"li-0", "li-c", "li-a", "li-b", "li-9"}, ids, "batch items keep request order, between the adds around them")
+	s.Equal(int64(1600), res.TotalMinor)
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemsActivity", 1)
+}
+
+func (s *billWorkflowSuite) TestAddOverCeilingRejectedAndCounted() {
+	p := s.params()
+	p.MaxTotalMinor = 1000
+
+	s.add(time.Minute, "li-1", 600)
+	s.add(2*time.Minute, "li-2", 500) // 1100: over
+	s.add(3*time.Minute, "li-3", 400) // exactly the ceiling
+	s.signal(4*time.Minute, signalBatchAddItems, BatchAddLineItemsSignal{
+		Currency: CurrencyUSD,
+		Items:    []BatchLineItem{{LineItemID: "li-4", AmountMinor: 1}, {LineItemID: "li-5", AmountMinor: 1}},
+	})
+	s.signal(5*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, p)
+
+	res := s.result()
+	s.Equal(int64(1000), res.TotalMinor)
+	s.Len(res.Items, 2)
+	s.Equal(3, res.RejectedLineItems, "the add and both batch items")
+	s.Equal([]RejectedLineItem{
+		{LineItemID: "li-2", Reason: ReasonTotalCeiling},
+		{LineItemID: "li-4", Reason: ReasonTotalCeiling},
+		{LineItemID: "li-5", Reason: ReasonTotalCeiling},
+	}, res.Rejections)
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 2)
+	s.env.AssertNotCalled(s.T(), "AddLineItemsActivity", mock.Anything, mock.Anything)
+}
+
+func (s *billWorkflowSuite) TestAddsPersistedAndQueryable() {
+	s.add(time.Minute, "li-1", 100)
+	s.add(2*time.Minute, "li-2", 200)
+	s.add(3*time.Minute, "li-3", 300)
+	var queried BillResult
+	s.env.RegisterDelayedCallback(func() {
+		val, err := s.env.QueryWorkflow(queryBillState)
+		s.Require().NoError(err)
+		s.Require().NoError(val.Get(&queried))
+	}, 4*time.Minute)
+	s.signal(5*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	s.result()
+	s.Require().Len(s.added, 3, "each add goes through the activity")
+	s.Equal(int64(600), queried.TotalMinor)
+	s.Require().Len(queried.Items, 3)
+	for i, li := range queried.Items {
+		s.Equal(s.added[i].LineItemID, li.ID)
+		s.Equal(s.added[i].AmountMinor, li.AmountMinor)
+	}
+}
+
+// Runs the workflow over the real create and add activities, against the
+// test database encore test provisions.
+func TestWorkflowAddsReachDB(t *testing.T) {
+	var ts testsuite.WorkflowTestSuite
+	env := ts.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(BillLifecycleWorkflow)
+	env.RegisterActivity(CreateBillRowActivity)
+	env.RegisterActivity(AddLineItemActivity)
+	env.OnActivity(CloseBillActivity, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, in CloseBillInput) (*Bill, error) {
+			return &Bill{ID: in.BillID, Status: StatusClosed, TotalMinor: in.TotalMinor}, nil
+		})
+	env.OnActivity(NotifyBillClosedActivity, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	billID := "bill-" + uuid.NewString()
+	ids := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+	for i, id := range ids {
+		sig := AddLineItemSignal{LineItemID: id, Description: "item", AmountMinor: int64(i+1) * 100, Currency: CurrencyUSD}
+		env.RegisterDelayedCallback(func() { env.SignalWorkflow(signalAddLineItem, sig) }, time.Duration(i+1)*time.Minute)
+	}
+	var queried BillResult
+	var stored []*LineItem
+	env.RegisterDelayedCallback(func() {
+		val, err := env.QueryWorkflow(queryBillState)
+		if err == nil {
+			err = val.Get(&queried)
+		}
+		if err != nil {
+			t.Errorf("query: %v", err)
+		}
+		if _, stored, err = getBillWithItemsJoin(context.Background(), billID); err != nil {
+			t.Errorf("read bill: %v", err)
+		}
+	}, 4*time.Minute)
+	env.RegisterDelayedCallback(func() { env.SignalWorkflow(signalCloseBill, CloseBillSignal{}) }, 5*time.Minute)
+
+	env.ExecuteWorkflow(BillLifecycleWorkflow, BillWorkflowParams{BillID: billID, Currency: CurrencyUSD})
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queried.Items) != 3 || queried.TotalMinor != 600 {
+		t.Errorf("query: %d items, total %d; want 3, 600", len(queried.Items), queried.TotalMinor)
+	}
+	if len(stored) != 3 {
+		t.Fatalf("DB holds %d items, want 3", len(stored))
+	}
+	for i, li := range stored {
+		if li.ID != ids[i] || li.AmountMinor != int64(i+1)*100 {
+			t.Errorf("DB item %d = %s %d, want %s %d", i, li.ID, li.AmountMinor, ids[i], (i+1)*100)
+		}
+	}
+}
+
+func (s *billWorkflowSuite) TestTransientAddErrorRetried() {
+	s.addErrs = []error{errors.New("connection reset"), errors.New("connection reset")}
+	s.add(time.Minute, "li-1", 500)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 3)
+	s.Equal(int64(500), res.TotalMinor)
+	s.Len(res.Items, 1)
+}
+
+func (s *billWorkflowSuite) TestAddRetriesExhausted() {
+	s.addErrs = make([]error, 10)
+	for i := range s.addErrs {
+		s.addErrs[i] = errors.New("connection refused")
+	}
+	s.add(time.Minute, "li-1", 500)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 5) // MaximumAttempts
+	s.Equal(int64(0), res.TotalMinor)
+	s.Empty(res.Items)
+}
+
+func (s *billWorkflowSuite) TestCurrencyMismatchNotRetried() {
+	s.addErrs = []error{nonRetryable(errCurrencyMismatch())}
+	s.add(time.Minute, "li-1", 500)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.env.AssertNumberOfCalls(s.T(), "AddLineItemActivity", 1)
+	s.Equal(int64(0), res.TotalMinor)
+	s.Empty(res.Items)
+}
+
+func (s *billWorkflowSuite) TestSecondCloseKeepsFirst() {
+	s.add(time.Minute, "li-1", 1000)
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{RequestID: "close-1"})
+	s.signal(2*time.Minute, signalCloseBill, CloseBillSignal{RequestID: "close-2"})
+
+	s.env.ExecuteWorkflow(BillLifecycleWorkflow, s.params())
+
+	res := s.result()
+	s.Equal("close-1", res.CloseRequestID, "the losing caller answers from the DB as already closed")
+	s.Equal(int64(1000), res.TotalMinor)
+	s.env.AssertNumberOfCalls(s.T(), "CloseBillActivity", 1)
+}
+
+func TestContinueAsNewDue(t *testing.T) {
+	tests := []struct {
+		name                    string
+		limit, handled, history int
+		want                    bool
+	}{
+		{"below both", 500, 10, 100, false},
+		{"signal limit reached", 500, 500, 100, true},
+		{"history limit reached", 500, 10, continueAsNewHistoryLength, true},
+		{"no signal limit, short history", 0, 5000, 100, false},
+		{"no signal limit, long history", 0, 10, continueAsNewHistoryLength, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := continueAsNewDue(tt.limit, tt.handled, tt.history); got != tt.want {
+				t.Errorf("continueAsNewDue(%d, %d, %d) = %v, want %v", tt.limit, tt.handled, tt.history, got, tt.want)
+			}
+		})
+	}
+}